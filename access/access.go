@@ -0,0 +1,133 @@
+// Package access decides which actions a user may take on which resources.
+// Grants combine an action with a scope: all resources, or one resource group.
+package access
+
+import (
+	"sort"
+
+	"app/model"
+
+	"gorm.io/gorm"
+)
+
+// Grants are the effective permissions of one user
+type Grants struct {
+	admin  bool
+	all    map[string]bool          // Actions allowed on every resource
+	groups map[string]map[uint]bool // Groups each action is allowed in
+}
+
+// Load collects the grants of a user and of their role in the organization
+// they act in
+func Load(db *gorm.DB, user model.User, role string) (Grants, error) {
+	if admin(user, role) {
+		return Collect(user, role, nil), nil
+	}
+	var rows []model.PermissionGrant
+	if err := db.Where("user_id = ? OR (user_id IS NULL AND role = ?)", user.ID, role).
+		Find(&rows).Error; err != nil {
+		return Collect(user, role, nil), err
+	}
+	return Collect(user, role, rows), nil
+}
+
+// Collect combines the rows granted to a user and to their role, skipping
+// those of other grantees; admins are allowed everything whatever the rows
+func Collect(user model.User, role string, rows []model.PermissionGrant) Grants {
+	g := Grants{
+		admin:  admin(user, role),
+		all:    map[string]bool{},
+		groups: map[string]map[uint]bool{},
+	}
+	if g.admin {
+		return g
+	}
+	for _, row := range rows {
+		if (row.UserID != nil && *row.UserID != user.ID) || (row.UserID == nil && row.Role != role) {
+			continue
+		}
+		if row.GroupID == nil {
+			g.all[row.Action] = true
+			continue
+		}
+		if g.groups[row.Action] == nil {
+			g.groups[row.Action] = map[uint]bool{}
+		}
+		g.groups[row.Action][*row.GroupID] = true
+	}
+	return g
+}
+
+// admin reports whether the user is an admin everywhere or in the
+// organization they act in
+func admin(user model.User, role string) bool {
+	return user.Role == model.RoleAdmin || role == model.RoleAdmin
+}
+
+// Allows reports whether the action is allowed on a resource of the group;
+// resources without a group are covered by grants on all resources only
+func (g Grants) Allows(action string, groupID *uint) bool {
+	if g.admin || g.all[action] {
+		return true
+	}
+	return groupID != nil && g.groups[action][*groupID]
+}
+
+// Admin reports whether the grants are those of an admin
+func (g Grants) Admin() bool {
+	return g.admin
+}
+
+// AllowsEvery reports whether the action is allowed on every resource
+func (g Grants) AllowsEvery(action string) bool {
+	return g.admin || g.all[action]
+}
+
+// AllowsAny reports whether the action is allowed on at least some resources
+func (g Grants) AllowsAny(action string) bool {
+	return g.admin || g.all[action] || len(g.groups[action]) > 0
+}
+
+// Filter limits a query on resources to those the action is allowed on
+func (g Grants) Filter(db *gorm.DB, action string) *gorm.DB {
+	if g.admin || g.all[action] {
+		return db
+	}
+	ids := make([]uint, 0, len(g.groups[action]))
+	for id := range g.groups[action] {
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return db.Where("1 = 0")
+	}
+	return db.Where("resources.group_id IN ?", ids)
+}
+
+// FilterRelated limits a query on a table with a resource_id column, such as
+// lots or history, to the rows of resources the action is allowed on
+func (g Grants) FilterRelated(db *gorm.DB, table, action string) *gorm.DB {
+	if g.AllowsEvery(action) {
+		return db
+	}
+	resources := db.Session(&gorm.Session{NewDB: true}).Unscoped().Model(&model.Resource{}).Select("resources.id")
+	return db.Where(table+".resource_id IN (?)", g.Filter(resources, action))
+}
+
+// Summary lists the scopes of every action for display: "all" or group ids
+func (g Grants) Summary() map[string]interface{} {
+	summary := map[string]interface{}{}
+	for _, action := range model.Actions {
+		switch {
+		case g.admin || g.all[action]:
+			summary[action] = "all"
+		default:
+			ids := []uint{}
+			for id := range g.groups[action] {
+				ids = append(ids, id)
+			}
+			sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+			summary[action] = ids
+		}
+	}
+	return summary
+}
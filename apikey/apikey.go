@@ -0,0 +1,127 @@
+// Package apikey issues and checks the API keys that programs use instead of
+// a session token. A key acts as its owner, limited by its scopes.
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"app/model"
+
+	"gorm.io/gorm"
+)
+
+// Prefix starts every key so that keys are recognisable, e.g. by secret scanners
+const Prefix = "ik_"
+
+// Scopes
+const (
+	ScopeRead  = "read"  // GET requests
+	ScopeWrite = "write" // Requests that change data
+	ScopeAdmin = "admin" // Admin endpoints, if the owner is an admin
+)
+
+// touchInterval limits how often last_used_at is written
+const touchInterval = time.Minute
+
+var ErrInvalidKey = errors.New("invalid, expired or revoked API key")
+
+// Hash is the stored form of a key
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Generate returns a new key and its display prefix
+func Generate() (key, prefix string, err error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	key = Prefix + hex.EncodeToString(raw)
+	return key, key[:len(Prefix)+8], nil
+}
+
+// Looks reports whether a bearer token is an API key rather than a JWT
+func Looks(token string) bool {
+	return strings.HasPrefix(token, Prefix)
+}
+
+// NormalizeScopes validates a space-separated scope list and returns it
+// deduplicated in canonical order
+func NormalizeScopes(scopes string) (string, error) {
+	seen := map[string]bool{}
+	for _, scope := range strings.Fields(scopes) {
+		switch scope {
+		case ScopeRead, ScopeWrite, ScopeAdmin:
+			seen[scope] = true
+		default:
+			return "", fmt.Errorf("unknown scope %q, expected read, write or admin", scope)
+		}
+	}
+	var normalized []string
+	for _, scope := range []string{ScopeRead, ScopeWrite, ScopeAdmin} {
+		if seen[scope] {
+			normalized = append(normalized, scope)
+		}
+	}
+	if len(normalized) == 0 {
+		return "", errors.New("at least one scope is required")
+	}
+	return strings.Join(normalized, " "), nil
+}
+
+// Has reports whether a space-separated scope list contains scope
+func Has(scopes, scope string) bool {
+	for _, s := range strings.Fields(scopes) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// MethodScope is the scope a request with the HTTP method needs
+func MethodScope(method string) string {
+	switch method {
+	case "GET", "HEAD", "OPTIONS":
+		return ScopeRead
+	default:
+		return ScopeWrite
+	}
+}
+
+// Authenticate returns a usable key and its owner, and records the use
+func Authenticate(db *gorm.DB, key string) (model.APIKey, model.User, error) {
+	var (
+		apiKey model.APIKey
+		owner  model.User
+	)
+	now := time.Now()
+	if err := db.Where("key_hash = ?", Hash(key)).Limit(1).Find(&apiKey).Error; err != nil {
+		return apiKey, owner, err
+	}
+	if apiKey.ID == 0 || !apiKey.Usable(now) {
+		return apiKey, owner, ErrInvalidKey
+	}
+
+	// Keys of deleted users stop working with them
+	err := db.First(&owner, apiKey.UserID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return apiKey, owner, ErrInvalidKey
+	}
+	if err != nil {
+		return apiKey, owner, err
+	}
+
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) >= touchInterval {
+		err = db.Model(&model.APIKey{}).Where("id = ?", apiKey.ID).Update("last_used_at", now).Error
+		apiKey.LastUsedAt = &now
+	}
+	return apiKey, owner, err
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+
+	"app/database"
+	"app/inventory"
+	"app/tenant"
+)
+
+// runHistory runs "history verify [-org slug]", which checks the history of
+// every resource, in all organizations unless one is given
+func runHistory(ctx context.Context, args []string) error {
+	if len(args) == 0 || args[0] != "verify" {
+		return errors.New("usage: history verify [-org slug]")
+	}
+	fs := flag.NewFlagSet("history verify", flag.ContinueOnError)
+	slug := fs.String("org", "", "organization `slug`, all when empty")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	if err := database.ConnectDB(ctx); err != nil {
+		return err
+	}
+	ctx = tenant.AllOrganizations(ctx)
+	if *slug != "" {
+		var err error
+		if ctx, err = organizationContext(ctx, *slug); err != nil {
+			return err
+		}
+	}
+
+	found, err := inventory.Verify(database.DB.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	for _, d := range found {
+		fmt.Println(d)
+	}
+	if len(found) > 0 {
+		return fmt.Errorf("history has %d discrepancies", len(found))
+	}
+	fmt.Println("History is consistent")
+	return nil
+}
@@ -1,27 +1,76 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
+	"app/config"
 	"app/database"
-	"app/router"
-
-	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/cors"
+	"app/model"
+	"app/tenant"
 )
 
+// commands are the subcommands of the binary; without one it serves the API
+var commands = map[string]func(ctx context.Context, args []string) error{
+	"serve":    runServe,
+	"migrate":  runMigrate,
+	"seed":     runSeed,
+	"user":     runUser,
+	"resource": runResource,
+	"history":  runHistory,
+}
+
+const usage = `usage: main [settings] [command]
+
+commands:
+  serve                                    start the API server (default)
+  migrate up | down [steps] | status       apply, revert or list schema migrations
+  seed -profile name | -file fixture       load seed data, see README
+  user create | set-password | set-role    manage users
+  resource import | export                 exchange the resources of an organization as CSV
+  history verify                           check that resource history adds up
+
+settings are flags such as -db-port=5432, see README`
+
 func main() {
-	app := fiber.New(fiber.Config{
-		Prefork:       true,
-		CaseSensitive: true,
-		StrictRouting: true,
-		ServerHeader:  "Fiber",
-		AppName:       "App Name",
-	})
-	app.Use(cors.New())
-
-	database.ConnectDB()
-
-	router.SetupRoutes(app)
-	log.Fatal(app.Listen(":3000"))
+	args, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	name := "serve"
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+	run, ok := commands[name]
+	if !ok {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	// SIGINT and SIGTERM cancel the context: commands stop what they are doing
+	// and the server drains its requests before exiting
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	err = run(ctx, args)
+	stop()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// organizationContext derives from ctx a context naming the organization with
+// the slug for tenant queries
+func organizationContext(ctx context.Context, slug string) (context.Context, error) {
+	var organization model.Organization
+	if err := database.DB.WithContext(ctx).Where("slug = ?", slug).Limit(1).Find(&organization).Error; err != nil {
+		return nil, err
+	}
+	if organization.ID == 0 {
+		return nil, fmt.Errorf("organization %q not found", slug)
+	}
+	return tenant.WithOrganization(ctx, organization.ID), nil
 }
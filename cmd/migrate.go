@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"app/database"
+	"app/migrate"
+)
+
+const migrateUsage = "usage: migrate up | down [steps] | status"
+
+// runMigrate runs "migrate up", "migrate down [steps]" (one step by default)
+// or "migrate status" against the configured database
+func runMigrate(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+	if err := database.Open(ctx); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrate.Up(database.DB)
+		for _, m := range applied {
+			fmt.Printf("Applied %d_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("Database is up to date")
+		}
+		return err
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("steps must be a positive integer, got %q", args[1])
+			}
+			steps = n
+		}
+		reverted, err := migrate.Down(database.DB, steps)
+		for _, m := range reverted {
+			fmt.Printf("Reverted %d_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(reverted) == 0 {
+			fmt.Println("No migration to revert")
+		}
+		return err
+
+	case "status":
+		states, err := migrate.Status(database.DB)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+		for _, s := range states {
+			applied := "pending"
+			switch {
+			case s.AppliedAt != nil && s.Name == "":
+				applied = s.AppliedAt.Format("2006-01-02 15:04:05") + " (not in this build)"
+			case s.Changed:
+				applied = s.AppliedAt.Format("2006-01-02 15:04:05") + " (changed since applied)"
+			case s.AppliedAt != nil:
+				applied = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return w.Flush()
+
+	default:
+		return errors.New(migrateUsage)
+	}
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"app/database"
+	"app/model"
+
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+)
+
+const resourceUsage = `usage:
+  resource export [-org slug] [file]
+  resource import -user name [-org slug] [file]
+files are CSV with the columns name, description, unit, quantity, serialized,
+price, currency and group; standard input or output when no file is given.
+an import only changes the columns present in the file, and needs the name
+and unit of new resources`
+
+// resourceColumns are the CSV columns, in export order
+var resourceColumns = []string{"name", "description", "unit", "quantity", "serialized", "price", "currency", "group"}
+
+// resourceRow is a resource read from CSV, validated like the API input
+type resourceRow struct {
+	Name        string `validate:"required,min=2,max=100"`
+	Description string
+	Unit        string `validate:"omitempty,min=1,max=20"`
+	Quantity    int    `validate:"min=0"`
+	Serialized  bool
+	Price       *float64 `validate:"omitempty,min=0"`
+	Currency    string   `validate:"omitempty,iso4217"`
+	Group       string
+
+	columns map[string]bool // Columns present in the file; updates leave the others unchanged
+}
+
+// runResource exports the resources of an organization to CSV or imports them
+// from it. Imported rows create resources or update the one with the same name,
+// with history recorded in the name of the given user.
+func runResource(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New(resourceUsage)
+	}
+	fs := flag.NewFlagSet("resource "+args[0], flag.ContinueOnError)
+	slug := fs.String("org", database.DefaultOrganizationSlug, "organization `slug`")
+	username := fs.String("user", "", "user `name` recorded in the history of imported changes")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 || (args[0] == "import" && *username == "") {
+		return errors.New(resourceUsage)
+	}
+
+	switch args[0] {
+	case "export":
+		out := os.Stdout
+		if fs.NArg() == 1 {
+			f, err := os.Create(fs.Arg(0))
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			out = f
+		}
+		if err := database.ConnectDB(ctx); err != nil {
+			return err
+		}
+		ctx, err := organizationContext(ctx, *slug)
+		if err != nil {
+			return err
+		}
+		return exportResources(database.DB.WithContext(ctx), out)
+
+	case "import":
+		in := os.Stdin
+		if fs.NArg() == 1 {
+			f, err := os.Open(fs.Arg(0))
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			in = f
+		}
+		if err := database.ConnectDB(ctx); err != nil {
+			return err
+		}
+		ctx, err := organizationContext(ctx, *slug)
+		if err != nil {
+			return err
+		}
+		user, err := findUser(database.DB, *username)
+		if err != nil {
+			return err
+		}
+		return importResources(database.DB.WithContext(ctx), in, user)
+
+	default:
+		return errors.New(resourceUsage)
+	}
+}
+
+func exportResources(db *gorm.DB, out io.Writer) error {
+	var resources []model.Resource
+	if err := db.Preload("Group").Order("name").Find(&resources).Error; err != nil {
+		return err
+	}
+
+	w := csv.NewWriter(out)
+	if err := w.Write(resourceColumns); err != nil {
+		return err
+	}
+	for _, r := range resources {
+		price, group := "", ""
+		if r.Price != nil {
+			price = strconv.FormatFloat(*r.Price, 'f', -1, 64)
+		}
+		if r.Group != nil {
+			group = r.Group.Name
+		}
+		record := []string{
+			r.Name, r.Description, r.Unit, strconv.Itoa(r.Quantity), strconv.FormatBool(r.Serialized),
+			price, r.Currency, group,
+		}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// importResources applies every row in one transaction: either all rows are
+// imported or none
+func importResources(db *gorm.DB, in io.Reader, user model.User) error {
+	rows, err := readResourceRows(in)
+	if err != nil {
+		return err
+	}
+
+	var created, updated, unchanged int
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for i, row := range rows {
+			line := i + 2 // After the header, counting from one
+			result, err := importResource(tx, row, user)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", line, err)
+			}
+			switch result {
+			case "CREATE":
+				created++
+			case "UPDATE":
+				updated++
+			default:
+				unchanged++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Imported %d resources: %d created, %d updated, %d unchanged\n", len(rows), created, updated, unchanged)
+	return nil
+}
+
+func readResourceRows(in io.Reader) ([]resourceRow, error) {
+	r := csv.NewReader(in)
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the header: %w", err)
+	}
+	index := map[string]int{}
+	for i, name := range header {
+		index[name] = i
+	}
+	for _, name := range header {
+		known := false
+		for _, c := range resourceColumns {
+			known = known || c == name
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+	}
+	if _, ok := index["name"]; !ok {
+		return nil, errors.New("the name column is required")
+	}
+	columns := map[string]bool{}
+	for name := range index {
+		columns[name] = true
+	}
+
+	validate := validator.New()
+	var rows []resourceRow
+	for line := 2; ; line++ {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		value := func(column string) string {
+			if i, ok := index[column]; ok {
+				return record[i]
+			}
+			return ""
+		}
+
+		row := resourceRow{
+			Name:        value("name"),
+			Description: value("description"),
+			Unit:        value("unit"),
+			Currency:    value("currency"),
+			Group:       value("group"),
+			columns:     columns,
+		}
+		if q := value("quantity"); q != "" {
+			if row.Quantity, err = strconv.Atoi(q); err != nil {
+				return nil, fmt.Errorf("line %d: quantity must be an integer, got %q", line, q)
+			}
+		}
+		if s := value("serialized"); s != "" {
+			if row.Serialized, err = strconv.ParseBool(s); err != nil {
+				return nil, fmt.Errorf("line %d: serialized must be true or false, got %q", line, s)
+			}
+		}
+		if p := value("price"); p != "" {
+			price, err := strconv.ParseFloat(p, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: price must be a number, got %q", line, p)
+			}
+			row.Price = &price
+		}
+		if err := validate.Struct(row); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rows = append(rows, row)
+	}
+}
+
+// importResource creates or updates the resource of a row with its history
+// entry and returns the action taken, empty when nothing changed
+func importResource(tx *gorm.DB, row resourceRow, user model.User) (string, error) {
+	var groupID *uint
+	if row.Group != "" {
+		var group model.ResourceGroup
+		if err := tx.Where("name = ?", row.Group).Limit(1).Find(&group).Error; err != nil {
+			return "", err
+		}
+		if group.ID == 0 {
+			return "", fmt.Errorf("resource group %q not found", row.Group)
+		}
+		groupID = &group.ID
+	}
+
+	var resource model.Resource
+	if err := tx.Where("name = ?", row.Name).Limit(1).Find(&resource).Error; err != nil {
+		return "", err
+	}
+
+	if resource.ID == 0 {
+		if row.Unit == "" {
+			return "", errors.New("unit is required for a new resource")
+		}
+		// Quantity of serialized resources is derived from their items
+		if row.Serialized && row.Quantity != 0 {
+			return "", errors.New("quantity of a serialized resource is derived from its items")
+		}
+		resource = model.Resource{
+			Name: row.Name, Description: row.Description, Unit: row.Unit, Quantity: row.Quantity,
+			Serialized: row.Serialized, Price: row.Price, Currency: row.Currency, GroupID: groupID,
+		}
+		if err := tx.Create(&resource).Error; err != nil {
+			return "", err
+		}
+		return "CREATE", logImport(tx, resource, user, "CREATE", nil, fmt.Sprintf("Resource '%s' imported", resource.Name))
+	}
+
+	if row.columns["serialized"] && row.Serialized != resource.Serialized {
+		return "", errors.New("serialized cannot be changed by an import")
+	}
+	old := resource
+	if row.columns["description"] {
+		resource.Description = row.Description
+	}
+	if row.columns["unit"] && row.Unit != "" {
+		resource.Unit = row.Unit
+	}
+	if row.columns["quantity"] && !resource.Serialized {
+		resource.Quantity = row.Quantity
+	}
+	if row.columns["price"] {
+		resource.Price = row.Price
+	}
+	if row.columns["currency"] {
+		resource.Currency = row.Currency
+	}
+	if row.columns["group"] {
+		resource.GroupID = groupID
+	}
+
+	oldJSON, _ := json.Marshal(old)
+	newJSON, _ := json.Marshal(resource)
+	if string(oldJSON) == string(newJSON) {
+		return "", nil
+	}
+	if err := tx.Save(&resource).Error; err != nil {
+		return "", err
+	}
+	return "UPDATE", logImport(tx, resource, user, "UPDATE", &old, fmt.Sprintf("Resource '%s' updated by import", resource.Name))
+}
+
+func logImport(tx *gorm.DB, resource model.Resource, user model.User, action string, old *model.Resource, description string) error {
+	history := model.ResourceHistory{
+		ResourceID:  resource.ID,
+		Action:      action,
+		UserID:      user.ID,
+		Timestamp:   time.Now(),
+		Description: description,
+	}
+	if old != nil {
+		oldJSON, _ := json.Marshal(old)
+		history.OldData = string(oldJSON)
+	}
+	newJSON, _ := json.Marshal(resource)
+	history.NewData = string(newJSON)
+	return tx.Create(&history).Error
+}
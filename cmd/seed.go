@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"strings"
+
+	"app/database"
+)
+
+// runSeed loads the fixture of a profile, or of a file, into an organization.
+// Seeding is idempotent, so a profile can be loaded again after an upgrade.
+func runSeed(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	opts := database.SeedOptions{}
+	fs.StringVar(&opts.Profile, "profile", "", "seed `profile`: "+strings.Join(database.Profiles(), ", "))
+	fs.StringVar(&opts.File, "file", "", "YAML or JSON fixture `file` loaded instead of a profile")
+	fs.StringVar(&opts.Organization, "org", database.DefaultOrganizationSlug, "organization `slug` receiving the resources")
+	fs.IntVar(&opts.Count, "count", 1000, "resources generated by load-test")
+	fs.IntVar(&opts.HistoryLength, "history", 10, "history entries of each resource generated by load-test")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if (opts.Profile == "") == (opts.File == "") || fs.NArg() > 0 {
+		return errors.New("usage: seed -profile " + strings.Join(database.Profiles(), "|") +
+			" [-org slug] [-count n] [-history n] | seed -file fixture.yaml [-org slug]")
+	}
+
+	if err := database.Open(ctx); err != nil {
+		return err
+	}
+	if err := database.Migrate(); err != nil {
+		return err
+	}
+	// Callbacks are not registered: fixtures notify nobody and carry their
+	// organization themselves
+	return database.Seed(database.DB, opts)
+}
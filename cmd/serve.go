@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"syscall"
+	"time"
+
+	"app/config"
+	"app/database"
+	"app/notify"
+	"app/report"
+	"app/repository"
+	"app/router"
+	"app/service"
+	"app/signing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+	"gorm.io/gorm"
+)
+
+// runServe starts the API server and, in the parent process, the background
+// jobs. When ctx is done it stops accepting connections, waits up to
+// SHUTDOWN_TIMEOUT_SECONDS for the requests in flight and the jobs at work,
+// and closes the database.
+func runServe(ctx context.Context, args []string) error {
+	if len(args) > 0 {
+		return errors.New("usage: serve")
+	}
+	config.WatchReload()
+	cfg := config.Get()
+
+	app := fiber.New(fiber.Config{
+		// A SQLite database is written by a single process
+		Prefork:       cfg.Prefork && cfg.DBDriver != database.DriverSQLite,
+		CaseSensitive: true,
+		StrictRouting: true,
+		ServerHeader:  "Fiber",
+		AppName:       "App Name",
+	})
+	app.Use(cors.New())
+
+	// Prefork children are only told to stop by the parent. They are forked
+	// on the Listen goroutine, so the list is shared with the shutdown below.
+	var (
+		childrenMu sync.Mutex
+		children   []int
+		stopping   bool
+	)
+	app.Hooks().OnFork(func(pid int) error {
+		childrenMu.Lock()
+		defer childrenMu.Unlock()
+		if stopping { // Forked while shutting down, past the loop below
+			if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
+				log.Printf("❌ Cannot stop process %d: %v", pid, err)
+			}
+			return nil
+		}
+		children = append(children, pid)
+		return nil
+	})
+
+	if err := database.ConnectDB(ctx); err != nil {
+		return err
+	}
+	defer func() {
+		if err := database.Close(); err != nil {
+			log.Println("❌ Cannot close the database:", err)
+		}
+	}()
+
+	// Only the parent process runs background jobs when prefork is enabled
+	var jobs backgroundJobs
+	if !fiber.IsChild() {
+		if err := jobs.start(database.DB); err != nil {
+			jobs.stop(context.Background())
+			return err
+		}
+	}
+
+	if err := signing.Init(database.DB); err != nil {
+		jobs.stop(context.Background())
+		return err
+	}
+
+	router.SetupRoutes(app, service.New(repository.NewGorm(database.DB)))
+
+	listening := make(chan error, 1)
+	go func() {
+		listening <- app.Listen(":3000")
+	}()
+	select {
+	case err := <-listening:
+		jobs.stop(context.Background())
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Println("⚠️ Shutting down, waiting for the requests in flight")
+	shutdown, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeoutSeconds)*time.Second)
+	defer cancel()
+
+	childrenMu.Lock()
+	stopping = true
+	forked := children
+	childrenMu.Unlock()
+	for _, pid := range forked {
+		if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
+			log.Printf("❌ Cannot stop process %d: %v", pid, err)
+		}
+	}
+	if err := app.ShutdownWithContext(shutdown); err != nil {
+		log.Println("❌ Requests cut short:", err)
+	}
+	select {
+	case err := <-listening:
+		if err != nil {
+			log.Println("❌ Server stopped:", err)
+		}
+	case <-shutdown.Done():
+	}
+
+	jobs.stop(shutdown)
+	log.Println("✅ Server stopped")
+	return nil
+}
+
+// backgroundJobs are the jobs of the parent process; each is nil when not
+// started
+type backgroundJobs struct {
+	rotator   *signing.Rotator
+	scheduler *report.Scheduler
+	worker    *notify.Worker
+}
+
+// start rotates the signing key if due and starts the key rotation checks, the
+// report scheduler and the notification worker, those last two when configured
+func (j *backgroundJobs) start(db *gorm.DB) error {
+	if _, err := signing.RotateIfDue(db); err != nil {
+		return err
+	}
+	j.rotator = signing.NewRotator(db)
+	j.rotator.Start()
+
+	scheduler, err := report.NewScheduler(db)
+	if err != nil {
+		return err
+	}
+	if scheduler != nil {
+		j.scheduler = scheduler
+		j.scheduler.Start()
+	}
+
+	sender, err := notify.NewSMTPSender()
+	if err != nil {
+		return err
+	}
+	if sender != nil {
+		j.worker = notify.NewWorker(db, sender)
+		j.worker.Start()
+	}
+	return nil
+}
+
+// stop stops the jobs and waits, until ctx is done, for the report being
+// generated and the notifications being sent
+func (j *backgroundJobs) stop(ctx context.Context) {
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		if j.scheduler != nil {
+			<-j.scheduler.Stop().Done()
+		}
+		if j.worker != nil {
+			j.worker.Stop()
+		}
+		if j.rotator != nil {
+			j.rotator.Stop()
+		}
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		log.Println("⚠️ Background jobs still running at shutdown")
+	}
+}
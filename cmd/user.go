@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"app/database"
+	"app/handler"
+	"app/model"
+	"app/notify"
+
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+)
+
+const userUsage = `usage:
+  user create -username name -email address [-names names] [-role user|admin] [-org slug] [-password password]
+  user set-password -username name [-password password]
+  user set-role -username name -role user|admin [-org slug]
+the password is read from standard input when not given`
+
+// runUser creates users, sets their password or their role
+func runUser(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New(userUsage)
+	}
+	fs := flag.NewFlagSet("user "+args[0], flag.ContinueOnError)
+	username := fs.String("username", "", "user `name`")
+	password := fs.String("password", "", "`password`, read from standard input when empty")
+	role := fs.String("role", "", "`role`, user or admin")
+	slug := fs.String("org", "", "organization `slug`")
+	email := fs.String("email", "", "email `address` (create)")
+	names := fs.String("names", "", "full `names` (create)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *username == "" {
+		return errors.New(userUsage)
+	}
+	if *role != "" && *role != model.RoleUser && *role != model.RoleAdmin {
+		return fmt.Errorf("role must be %s or %s", model.RoleUser, model.RoleAdmin)
+	}
+
+	switch args[0] {
+	case "create":
+		if *role == "" {
+			*role = model.RoleUser
+		}
+		if err := readPassword(password); err != nil {
+			return err
+		}
+		if err := database.ConnectDB(ctx); err != nil {
+			return err
+		}
+		return createUser(model.User{Username: *username, Email: *email, Names: *names, Password: *password, Role: *role}, *slug)
+
+	case "set-password":
+		if err := readPassword(password); err != nil {
+			return err
+		}
+		if err := database.ConnectDB(ctx); err != nil {
+			return err
+		}
+		return setPassword(*username, *password)
+
+	case "set-role":
+		if *role == "" {
+			return errors.New(userUsage)
+		}
+		if err := database.ConnectDB(ctx); err != nil {
+			return err
+		}
+		return setRole(*username, *role, *slug)
+
+	default:
+		return errors.New(userUsage)
+	}
+}
+
+// readPassword asks for the password on standard input unless it was given
+func readPassword(password *string) error {
+	if *password == "" {
+		fmt.Fprint(os.Stderr, "Password: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return errors.New("no password given")
+		}
+		*password = strings.TrimRight(line, "\r\n")
+	}
+	return validator.New().Var(*password, "required,min=6,max=50")
+}
+
+// createUser creates a verified user who joins the organization with the slug,
+// or the signup organization when none is given
+func createUser(user model.User, slug string) error {
+	if err := validator.New().Struct(user); err != nil {
+		return err
+	}
+	hash, err := handler.HashPassword(user.Password)
+	if err != nil {
+		return err
+	}
+	user.Password = hash
+	now := time.Now()
+	user.EmailVerifiedAt = &now
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		if slug == "" {
+			return handler.JoinSignupOrganization(tx, user)
+		}
+		return setMembership(tx, user, slug, user.Role)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Created user %s (id %d)\n", user.Username, user.ID)
+	return nil
+}
+
+func setPassword(username, password string) error {
+	hash, err := handler.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		user, err := findUser(tx, username)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&user).Update("password", hash).Error; err != nil {
+			return err
+		}
+		fmt.Printf("Password of %s changed\n", user.Username)
+		return notify.AccountEvent(tx, user, notify.KindPasswordChanged)
+	})
+}
+
+// setRole sets the role of a user, or their role in the organization with the slug
+func setRole(username, role, slug string) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		user, err := findUser(tx, username)
+		if err != nil {
+			return err
+		}
+		if slug != "" {
+			if err := setMembership(tx, user, slug, role); err != nil {
+				return err
+			}
+			fmt.Printf("%s is %s in %s\n", user.Username, role, slug)
+			return nil
+		}
+		if err := tx.Model(&user).Update("role", role).Error; err != nil {
+			return err
+		}
+		fmt.Printf("%s is %s\n", user.Username, role)
+		return nil
+	})
+}
+
+func findUser(tx *gorm.DB, username string) (model.User, error) {
+	var user model.User
+	if err := tx.Where("username = ?", username).Limit(1).Find(&user).Error; err != nil {
+		return user, err
+	}
+	if user.ID == 0 {
+		return user, fmt.Errorf("user %q not found", username)
+	}
+	return user, nil
+}
+
+// setMembership makes the user a member of the organization with the role
+func setMembership(tx *gorm.DB, user model.User, slug, role string) error {
+	var organization model.Organization
+	if err := tx.Where("slug = ?", slug).Limit(1).Find(&organization).Error; err != nil {
+		return err
+	}
+	if organization.ID == 0 {
+		return fmt.Errorf("organization %q not found", slug)
+	}
+	var membership model.Membership
+	return tx.Where(model.Membership{UserID: user.ID, OrganizationID: organization.ID}).
+		Assign(model.Membership{Role: role}).
+		FirstOrCreate(&membership).Error
+}
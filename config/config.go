@@ -1,18 +1,320 @@
+// Package config loads the settings of the application once at startup.
+// Every setting has a key such as DB_PORT and is taken, from lowest to highest
+// precedence, from its default, the configuration file, the environment and
+// the command line (-db-port). Settings marked reloadable are re-read on SIGHUP.
 package config
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
 
 	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
 )
 
-// Config func to get env value
-func Config(key string) string {
-	// load .env file
-	err := godotenv.Load(".env")
+// Config holds every setting. Field tags give the key, the default, whether
+// the setting is required or reloadable, and the allowed values.
+type Config struct {
+	Secret string `key:"SECRET" required:"true"` // Derives the keys of short-lived signed cookies and challenges
+
+	DBDriver   string `key:"DB_DRIVER" default:"postgres" oneof:"postgres sqlite"`
+	DBDSN      string `key:"DB_DSN"` // Connection string used as is instead of the settings below
+	DBHost     string `key:"DB_HOST" default:"localhost"`
+	DBPort     int    `key:"DB_PORT" default:"5432" min:"1" max:"65535"`
+	DBUser     string `key:"DB_USER"`
+	DBPassword string `key:"DB_PASSWORD"`
+	DBName     string `key:"DB_NAME"`
+	DBSSLMode  string `key:"DB_SSLMODE" default:"disable" oneof:"disable allow prefer require verify-ca verify-full"`
+	DBPath     string `key:"DB_PATH" default:"app.db"` // SQLite database file
+
+	DBMaxOpenConns           int `key:"DB_MAX_OPEN_CONNS" default:"25" min:"1"`
+	DBMaxIdleConns           int `key:"DB_MAX_IDLE_CONNS" default:"5" min:"0"`
+	DBConnMaxLifetimeMinutes int `key:"DB_CONN_MAX_LIFETIME_MINUTES" default:"30" min:"0"` // 0 keeps connections open indefinitely
+	DBConnectTimeoutSeconds  int `key:"DB_CONNECT_TIMEOUT_SECONDS" default:"60" min:"0"`   // How long startup waits for the database, 0 tries once
+
+	Prefork                bool `key:"PREFORK"`                                       // One server process per CPU; requests are not drained on shutdown
+	ShutdownTimeoutSeconds int  `key:"SHUTDOWN_TIMEOUT_SECONDS" default:"10" min:"1"` // How long shutdown waits for requests and background jobs
+
+	AppURL             string `key:"APP_URL" default:"http://localhost:3000" reload:"true"` // Frontend address used in emailed links
+	BaseCurrency       string `key:"BASE_CURRENCY" default:"RUB"`                           // Currency the books are kept in
+	SignupOrganization string `key:"SIGNUP_ORGANIZATION" default:"default" reload:"true"`   // Slug of the organization new users join, "none" for none
+
+	RequireEmailVerification bool   `key:"REQUIRE_EMAIL_VERIFICATION" reload:"true"`
+	TOTPIssuer               string `key:"TOTP_ISSUER" default:"Inventory" reload:"true"`
+	LoginMaxFailures         int    `key:"LOGIN_MAX_FAILURES" default:"5" min:"1" reload:"true"`
+	RateLimitStore           string `key:"RATE_LIMIT_STORE" default:"db" oneof:"db memory"`
+	JWTAlgorithm             string `key:"JWT_ALGORITHM" default:"RS256" oneof:"RS256 EdDSA"`
+	JWTKeyRotationDays       int    `key:"JWT_KEY_ROTATION_DAYS" default:"30" min:"1"`
+	JWTKeyOverlapHours       int    `key:"JWT_KEY_OVERLAP_HOURS" default:"72" min:"1"`
+
+	OIDCIssuer       string `key:"OIDC_ISSUER"` // Empty disables single sign-on
+	OIDCClientID     string `key:"OIDC_CLIENT_ID"`
+	OIDCClientSecret string `key:"OIDC_CLIENT_SECRET"`
+	OIDCRedirectURL  string `key:"OIDC_REDIRECT_URL"`
+	OIDCScopes       string `key:"OIDC_SCOPES" default:"openid email profile"`
+	OIDCGroupsClaim  string `key:"OIDC_GROUPS_CLAIM" default:"groups"`
+	OIDCRoleMapping  string `key:"OIDC_ROLE_MAPPING"` // group=role,group=role
+	OIDCDefaultRole  string `key:"OIDC_DEFAULT_ROLE" default:"user" oneof:"user admin none"`
+
+	ReportSchedule    string `key:"REPORT_SCHEDULE"` // Cron expression; empty disables the scheduler
+	ReportFormat      string `key:"REPORT_FORMAT" default:"pdf" oneof:"pdf html"`
+	ReportPeriodDays  int    `key:"REPORT_PERIOD_DAYS" default:"7" min:"1"`
+	LowStockThreshold int    `key:"LOW_STOCK_THRESHOLD" default:"100" min:"0" reload:"true"`
+
+	SMTPHost              string `key:"SMTP_HOST"` // Empty keeps messages in the outbox
+	SMTPPort              int    `key:"SMTP_PORT" default:"587" min:"1" max:"65535"`
+	SMTPUsername          string `key:"SMTP_USERNAME"`
+	SMTPPassword          string `key:"SMTP_PASSWORD"`
+	SMTPFrom              string `key:"SMTP_FROM"`
+	NotifyDefaultLanguage string `key:"NOTIFY_DEFAULT_LANGUAGE" default:"ru" oneof:"ru en" reload:"true"`
+	NotifyMaxAttempts     int    `key:"NOTIFY_MAX_ATTEMPTS" default:"5" min:"1"`
+}
+
+// ValidationError lists every missing or malformed setting
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  " + strings.Join(e.Problems, "\n  ")
+}
+
+var current atomic.Pointer[Config]
+
+// Get returns the current configuration. Before Load it holds the defaults.
+func Get() *Config {
+	if c := current.Load(); c != nil {
+		return c
+	}
+	c := &Config{}
+	_ = apply(c, map[string]setting{})
+	current.CompareAndSwap(nil, c)
+	return current.Load()
+}
+
+// setting is a raw value and where it came from, for error messages
+type setting struct {
+	value  string
+	source string
+}
+
+// loadArgs are the command line arguments of the first Load, used again on reload
+var loadArgs []string
+
+// Load reads the configuration from the command line arguments (without the
+// program name), the environment, a .env file in the working directory, and
+// the YAML file named by -config or CONFIG_FILE (config.yaml if present). It
+// returns the arguments left after the flags. The configuration is only
+// replaced when it is valid.
+func Load(args []string) ([]string, error) {
+	c, rest, err := read(args)
+	if err != nil {
+		return nil, err
+	}
+	loadArgs = args
+	current.Store(c)
+	return rest, nil
+}
+
+func read(args []string) (*Config, []string, error) {
+	fields := settingFields()
+	fs := flag.NewFlagSet("app", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML configuration `file`")
+	flagValues := map[string]*string{}
+	for _, f := range fields {
+		flagValues[f.key] = fs.String(flagName(f.key), "", "sets "+f.key)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	settings := map[string]setting{}
+	var problems []string
+
+	path, explicit := *configFile, *configFile != ""
+	if !explicit {
+		path = "config.yaml"
+	}
+	fileSettings, err := readFile(path, fields)
+	switch {
+	case errors.Is(err, os.ErrNotExist) && !explicit:
+	case err != nil:
+		problems = append(problems, err.Error())
+	}
+	for key, s := range fileSettings {
+		settings[key] = s
+	}
+
+	// .env is optional; it is read every time so that reloads see its changes,
+	// and variables set in the environment take precedence over it
+	dotenv, _ := godotenv.Read()
+	for _, f := range fields {
+		if value := dotenv[f.key]; value != "" {
+			settings[f.key] = setting{value: value, source: ".env"}
+		}
+		if value := os.Getenv(f.key); value != "" {
+			settings[f.key] = setting{value: value, source: "environment"}
+		}
+	}
+	fs.Visit(func(fl *flag.Flag) {
+		for key, value := range flagValues {
+			if flagName(key) == fl.Name {
+				settings[key] = setting{value: *value, source: "flag -" + fl.Name}
+			}
+		}
+	})
+
+	c := &Config{}
+	problems = append(problems, apply(c, settings)...)
+	problems = append(problems, c.check()...)
+	if len(problems) > 0 {
+		return nil, nil, &ValidationError{Problems: problems}
+	}
+	return c, fs.Args(), nil
+}
+
+// field is a setting of Config
+type field struct {
+	index int
+	key   string
+	tag   reflect.StructTag
+}
+
+func settingFields() []field {
+	t := reflect.TypeOf(Config{})
+	fields := make([]field, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		fields = append(fields, field{index: i, key: t.Field(i).Tag.Get("key"), tag: t.Field(i).Tag})
+	}
+	return fields
+}
+
+// flagName is the command line flag of a key: DB_PORT is -db-port
+func flagName(key string) string {
+	return strings.ReplaceAll(strings.ToLower(key), "_", "-")
+}
+
+// readFile reads a flat YAML mapping of keys, written as DB_PORT or db_port
+func readFile(path string, fields []field) (map[string]setting, error) {
+	content, err := os.ReadFile(path)
 	if err != nil {
-		fmt.Print("Error loading .env file")
+		return nil, err
+	}
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(content, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	known := map[string]bool{}
+	for _, f := range fields {
+		known[f.key] = true
+	}
+	settings := map[string]setting{}
+	var problems []string
+	names := make([]string, 0, len(raw))
+	for name := range raw {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := raw[name]
+		key := strings.ToUpper(name)
+		switch {
+		case !known[key]:
+			problems = append(problems, fmt.Sprintf("%s: unknown setting %q", path, name))
+		case value == nil:
+		default:
+			switch value.(type) {
+			case map[string]interface{}, []interface{}:
+				problems = append(problems, fmt.Sprintf("%s: %s must be a single value", path, key))
+			default:
+				settings[key] = setting{value: fmt.Sprint(value), source: path}
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return settings, errors.New(strings.Join(problems, "\n  "))
+	}
+	return settings, nil
+}
+
+// apply sets every field from its setting or default and returns the problems
+func apply(c *Config, settings map[string]setting) []string {
+	var problems []string
+	v := reflect.ValueOf(c).Elem()
+	for _, f := range settingFields() {
+		s, ok := settings[f.key]
+		if !ok {
+			if f.tag.Get("required") == "true" {
+				problems = append(problems, f.key+" is required")
+				continue
+			}
+			s = setting{value: f.tag.Get("default"), source: "default"}
+			if s.value == "" {
+				continue
+			}
+		}
+		if err := setField(v.Field(f.index), f.tag, s.value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s %s, got %q (from %s)", f.key, err, s.value, s.source))
+		}
+	}
+	return problems
+}
+
+func setField(v reflect.Value, tag reflect.StructTag, value string) error {
+	if allowed := tag.Get("oneof"); allowed != "" {
+		valid := false
+		for _, a := range strings.Fields(allowed) {
+			valid = valid || a == value
+		}
+		if !valid {
+			return fmt.Errorf("must be one of %s", strings.ReplaceAll(allowed, " ", ", "))
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.New("must be true or false")
+		}
+		v.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return errors.New("must be an integer")
+		}
+		if min, err := strconv.Atoi(tag.Get("min")); err == nil && n < min {
+			return fmt.Errorf("must be at least %d", min)
+		}
+		if max, err := strconv.Atoi(tag.Get("max")); err == nil && n > max {
+			return fmt.Errorf("must be at most %d", max)
+		}
+		v.SetInt(int64(n))
+	}
+	return nil
+}
+
+// check validates settings that depend on each other
+func (c *Config) check() []string {
+	var problems []string
+	if c.DBDriver == "postgres" && c.DBDSN == "" && (c.DBUser == "" || c.DBName == "") {
+		problems = append(problems, "DB_USER and DB_NAME are required with DB_DRIVER=postgres unless DB_DSN is set")
+	}
+	if c.OIDCIssuer != "" && (c.OIDCClientID == "" || c.OIDCRedirectURL == "") {
+		problems = append(problems, "OIDC_CLIENT_ID and OIDC_REDIRECT_URL are required with OIDC_ISSUER")
+	}
+	if c.SMTPHost != "" && c.SMTPFrom == "" {
+		problems = append(problems, "SMTP_FROM is required with SMTP_HOST")
 	}
-	return os.Getenv(key)
+	return problems
 }
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+)
+
+// Reload reads the configuration again and applies the settings that are safe
+// to change while running (tagged reload). Other changes are logged and take
+// effect on restart. The running configuration is kept when the new one is
+// invalid.
+func Reload() error {
+	next, _, err := read(loadArgs)
+	if err != nil {
+		return err
+	}
+
+	updated := *Get()
+	from := reflect.ValueOf(next).Elem()
+	to := reflect.ValueOf(&updated).Elem()
+	for _, f := range settingFields() {
+		if reflect.DeepEqual(from.Field(f.index).Interface(), to.Field(f.index).Interface()) {
+			continue
+		}
+		if f.tag.Get("reload") != "true" {
+			log.Printf("⚠️ %s changed, restart to apply it", f.key)
+			continue
+		}
+		to.Field(f.index).Set(from.Field(f.index))
+		log.Printf("✅ %s reloaded", f.key)
+	}
+	current.Store(&updated)
+	return nil
+}
+
+// WatchReload reloads the configuration on every SIGHUP. With prefork each
+// process holds its own configuration, so the signal must reach all of them.
+func WatchReload() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for range signals {
+			if err := Reload(); err != nil {
+				log.Println("❌ Configuration not reloaded:", err)
+			}
+		}
+	}()
+}
@@ -1,46 +1,181 @@
 package database
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log"
+	"net"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"app/config"
+	"app/migrate"
 	"app/model"
+	"app/notify"
+	"app/tenant"
 
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
-// ConnectDB connect to db
-func ConnectDB() {
-	var err error
-	p := config.Config("DB_PORT")
-	port, err := strconv.ParseUint(p, 10, 32)
+// Database drivers, chosen by DB_DRIVER
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// Delays between connection attempts, doubled after each failure
+const (
+	firstRetryDelay = 500 * time.Millisecond
+	maxRetryDelay   = 10 * time.Second
+)
+
+// Open connects DB to the configured database without migrating it. A
+// database that cannot be reached yet, as when docker-compose starts Postgres
+// along with the API, is retried for DB_CONNECT_TIMEOUT_SECONDS or until ctx
+// is done.
+func Open(ctx context.Context) error {
+	cfg := config.Get()
+	deadline := time.Now().Add(time.Duration(cfg.DBConnectTimeoutSeconds) * time.Second)
+	delay := firstRetryDelay
+	for {
+		db, err := gorm.Open(Dialector(), &gorm.Config{})
+		if err == nil {
+			DB = db
+			return configurePool(db)
+		}
+		if time.Now().Add(delay).After(deadline) {
+			return fmt.Errorf("cannot connect to the database: %w", err)
+		}
+		log.Printf("⚠️ База данных недоступна, повтор через %s: %v", delay, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxRetryDelay)
+	}
+}
+
+// configurePool applies the DB_MAX_OPEN_CONNS, DB_MAX_IDLE_CONNS and
+// DB_CONN_MAX_LIFETIME_MINUTES settings. With prefork every process has a pool
+// of its own.
+func configurePool(db *gorm.DB) error {
+	cfg := config.Get()
+	sqlDB, err := db.DB()
 	if err != nil {
-		panic("failed to parse database port")
+		return err
 	}
+	sqlDB.SetMaxOpenConns(cfg.DBMaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.DBMaxIdleConns)
+	sqlDB.SetConnMaxLifetime(time.Duration(cfg.DBConnMaxLifetimeMinutes) * time.Minute)
+	return nil
+}
 
-	dsn := fmt.Sprintf(
-		"host=db port=%d user=%s password=%s dbname=%s sslmode=disable",
-		port,
-		config.Config("DB_USER"),
-		config.Config("DB_PASSWORD"),
-		config.Config("DB_NAME"),
-	)
-	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+// Close closes the connection pool once the running queries finish
+func Close() error {
+	sqlDB, err := DB.DB()
 	if err != nil {
-		panic("failed to connect database")
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// Ping checks that the database answers
+func Ping(ctx context.Context) error {
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// Dialector returns the driver of the configured database. DB_DSN is used as
+// is when set; otherwise Postgres is reached through DB_HOST, DB_PORT and the
+// other DB_ settings, and SQLite opens the file DB_PATH.
+func Dialector() gorm.Dialector {
+	cfg := config.Get()
+	if cfg.DBDriver == DriverSQLite {
+		dsn := cfg.DBDSN
+		if dsn == "" {
+			dsn = "file:" + cfg.DBPath
+		}
+		return sqlite.Open(sqlitePragmas(dsn))
+	}
+
+	dsn := cfg.DBDSN
+	if dsn == "" {
+		u := url.URL{
+			Scheme:   "postgres",
+			User:     url.UserPassword(cfg.DBUser, cfg.DBPassword),
+			Host:     net.JoinHostPort(cfg.DBHost, strconv.Itoa(cfg.DBPort)),
+			Path:     "/" + cfg.DBName,
+			RawQuery: url.Values{"sslmode": {cfg.DBSSLMode}}.Encode(),
+		}
+		dsn = u.String()
 	}
+	return postgres.Open(dsn)
+}
 
+// sqlitePragmas enforces foreign keys as Postgres does, waits for locks held
+// by other connections instead of failing, and takes the write lock when a
+// transaction begins, since SQLite ignores SELECT ... FOR UPDATE
+func sqlitePragmas(dsn string) string {
+	separator := "?"
+	if strings.Contains(dsn, "?") {
+		separator = "&"
+	}
+	return dsn + separator + "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_txlock=immediate"
+}
+
+// ConnectDB connects to the database, migrates it and registers the callbacks
+func ConnectDB(ctx context.Context) error {
+	if err := Open(ctx); err != nil {
+		return err
+	}
 	fmt.Println("Connection Opened to Database")
-	if err := DB.AutoMigrate(
-		&model.User{},
-		&model.Resource{},
-		&model.ResourceHistory{},
-	); err != nil {
-		panic("auto-migrate failed")
+
+	if err := Migrate(); err != nil {
+		return fmt.Errorf("migration failed: %w", err)
 	}
 	fmt.Println("Database Migrated")
-	SeedData(DB)
-	fmt.Println("Database Seeded")
+
+	return RegisterCallbacks()
+}
+
+// Migrate applies the pending migrations and creates the default permissions
+// and organization
+func Migrate() error {
+	// Default grants are only seeded on first migration so that admins can revoke them
+	newPermissions := !DB.Migrator().HasTable(&model.PermissionGrant{})
+	applied, err := migrate.Up(DB)
+	if err != nil {
+		return err
+	}
+	for _, m := range applied {
+		fmt.Printf("Applied migration %d_%s\n", m.Version, m.Name)
+	}
+	if newPermissions {
+		SeedPermissions(DB)
+	}
+	SeedOrganizations(DB)
+	return nil
+}
+
+// RegisterCallbacks queues notifications for resource changes and scopes tenant
+// data to organizations. Data written before, such as fixtures, is neither.
+func RegisterCallbacks() error {
+	if err := notify.RegisterCallbacks(DB); err != nil {
+		return errors.New("failed to register notification callbacks")
+	}
+	// From here on, tenant data is only reachable through a context naming
+	// its organization
+	if err := tenant.RegisterCallbacks(DB, TenantModels...); err != nil {
+		return errors.New("failed to register tenant callbacks")
+	}
+	return nil
 }
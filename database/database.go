@@ -1,6 +1,26 @@
 package database
 
-import "gorm.io/gorm"
+import (
+	"app/model"
+
+	"gorm.io/gorm"
+)
 
 // DB gorm connector
 var DB *gorm.DB
+
+// DefaultOrganizationSlug names the organization created on first start
+const DefaultOrganizationSlug = "default"
+
+// TenantModels are owned by an organization: queries on them only see the
+// organization of their context
+var TenantModels = []interface{}{
+	&model.Resource{},
+	&model.ResourceHistory{},
+	&model.Lot{},
+	&model.SerialItem{},
+	&model.Stocktake{},
+	&model.GeneratedReport{},
+	&model.ResourceGroup{},
+	&model.PermissionGrant{},
+}
@@ -0,0 +1,472 @@
+package database
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"math/rand"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"app/model"
+
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+//go:embed fixtures
+var fixtureFiles embed.FS
+
+// Seed profiles besides the fixture files, whose name is their profile
+const (
+	ProfileEmpty    = "empty"     // Nothing beyond the default organization
+	ProfileLoadTest = "load-test" // Generated resources with long histories
+)
+
+// FixtureVersion is the version of the fixture format understood here
+const FixtureVersion = 1
+
+// Fixture is seed data, written as YAML or JSON. Resources get their quantity
+// from their history, which starts with a CREATE entry.
+type Fixture struct {
+	Version   int               `yaml:"version"`
+	Users     []FixtureUser     `yaml:"users"`
+	Groups    []FixtureGroup    `yaml:"groups"`
+	Resources []FixtureResource `yaml:"resources"`
+}
+
+type FixtureUser struct {
+	Username string `yaml:"username"`
+	Email    string `yaml:"email"`
+	Password string `yaml:"password"`
+	Names    string `yaml:"names"`
+	Role     string `yaml:"role"` // user by default
+}
+
+type FixtureGroup struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+}
+
+type FixtureResource struct {
+	Name        string          `yaml:"name"`
+	Description string          `yaml:"description"`
+	Unit        string          `yaml:"unit"`
+	Price       *float64        `yaml:"price"`
+	Currency    string          `yaml:"currency"`
+	Group       string          `yaml:"group"` // Name of a group of the fixture or of the database
+	History     []FixtureChange `yaml:"history"`
+}
+
+// FixtureChange is a history entry setting the quantity of a resource
+type FixtureChange struct {
+	Action      string `yaml:"action"`
+	Quantity    int    `yaml:"quantity"` // Quantity after the change
+	User        string `yaml:"user"`     // Username of a user of the fixture or of the database
+	DaysAgo     int    `yaml:"days_ago"`
+	Description string `yaml:"description"`
+}
+
+// SeedOptions select the data Seed loads
+type SeedOptions struct {
+	Profile       string // empty, load-test or the name of a fixture in database/fixtures
+	File          string // Fixture file loaded instead of a profile
+	Organization  string // Slug of the organization receiving the resources
+	Count         int    // Resources generated by load-test
+	HistoryLength int    // History entries of each generated resource
+}
+
+// Profiles lists the seed profiles
+func Profiles() []string {
+	profiles := []string{ProfileEmpty, ProfileLoadTest}
+	entries, _ := fs.ReadDir(fixtureFiles, "fixtures")
+	for _, entry := range entries {
+		profiles = append(profiles, strings.TrimSuffix(entry.Name(), path.Ext(entry.Name())))
+	}
+	sort.Strings(profiles)
+	return profiles
+}
+
+// ParseFixture reads and checks a fixture
+func ParseFixture(content []byte) (Fixture, error) {
+	var f Fixture
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&f); err != nil {
+		return f, err
+	}
+	return f, f.check()
+}
+
+func (f Fixture) check() error {
+	var problems []string
+	if f.Version != FixtureVersion {
+		problems = append(problems, fmt.Sprintf("version must be %d, got %d", FixtureVersion, f.Version))
+	}
+	for i, u := range f.Users {
+		if u.Username == "" || u.Email == "" || len(u.Password) < 6 {
+			problems = append(problems, fmt.Sprintf("user %d needs a username, an email and a password of 6 characters or more", i+1))
+		}
+		if u.Role != "" && u.Role != model.RoleUser && u.Role != model.RoleAdmin {
+			problems = append(problems, fmt.Sprintf("user %s: role must be user or admin", u.Username))
+		}
+	}
+	for i, g := range f.Groups {
+		if g.Name == "" {
+			problems = append(problems, fmt.Sprintf("group %d needs a name", i+1))
+		}
+	}
+	for i, r := range f.Resources {
+		if r.Name == "" || r.Unit == "" {
+			problems = append(problems, fmt.Sprintf("resource %d needs a name and a unit", i+1))
+		}
+		if len(r.History) == 0 || r.History[0].Action != "CREATE" {
+			problems = append(problems, fmt.Sprintf("resource %s: history must start with CREATE", r.Name))
+		}
+		for _, c := range r.History {
+			if c.Quantity < 0 || c.User == "" {
+				problems = append(problems, fmt.Sprintf("resource %s: history entries need a user and a quantity of 0 or more", r.Name))
+				break
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New("invalid fixture: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Seed loads the fixture of a profile or file into the organization. It is
+// idempotent: users, groups and resources are matched by name, existing ones
+// are updated, and history is only written for the resources it creates, so
+// the quantities of existing resources are left alone.
+func Seed(db *gorm.DB, opts SeedOptions) error {
+	var (
+		fixture Fixture
+		err     error
+		name    = opts.Profile
+	)
+	switch {
+	case opts.File != "":
+		name = opts.File
+		content, readErr := os.ReadFile(opts.File)
+		if readErr != nil {
+			return readErr
+		}
+		fixture, err = ParseFixture(content)
+	case opts.Profile == ProfileEmpty:
+		log.Println("✅ Профиль empty: данные не добавлены")
+		return nil
+	case opts.Profile == ProfileLoadTest:
+		fixture = generateLoadTest(opts.Count, opts.HistoryLength)
+	default:
+		content, readErr := fixtureContent(opts.Profile)
+		if readErr != nil {
+			return readErr
+		}
+		fixture, err = ParseFixture(content)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	var organization model.Organization
+	if err := db.Where("slug = ?", opts.Organization).Limit(1).Find(&organization).Error; err != nil {
+		return err
+	}
+	if organization.ID == 0 {
+		return fmt.Errorf("organization %q not found", opts.Organization)
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		return applyFixture(tx, fixture, organization, name)
+	})
+}
+
+func fixtureContent(profile string) ([]byte, error) {
+	for _, ext := range []string{".yaml", ".yml", ".json"} {
+		content, err := fixtureFiles.ReadFile("fixtures/" + profile + ext)
+		if err == nil {
+			return content, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown seed profile %q, expected one of %s", profile, strings.Join(Profiles(), ", "))
+}
+
+func applyFixture(tx *gorm.DB, f Fixture, organization model.Organization, name string) error {
+	users, err := seedUsers(tx, f.Users, organization)
+	if err != nil {
+		return err
+	}
+	groups, err := seedGroups(tx, f.Groups, organization.ID)
+	if err != nil {
+		return err
+	}
+
+	var existing []model.Resource
+	if err := tx.Unscoped().Where("organization_id = ?", organization.ID).Find(&existing).Error; err != nil {
+		return err
+	}
+	byName := make(map[string]model.Resource, len(existing))
+	for _, r := range existing {
+		byName[r.Name] = r
+	}
+
+	var (
+		created []model.Resource
+		sources []FixtureResource
+		updated int
+		now     = time.Now()
+	)
+	for _, fr := range f.Resources {
+		groupID, err := groupOf(tx, groups, fr.Group, organization.ID)
+		if err != nil {
+			return fmt.Errorf("resource %s: %w", fr.Name, err)
+		}
+		if r, ok := byName[fr.Name]; ok {
+			changes := map[string]interface{}{}
+			if r.Description != fr.Description {
+				changes["description"] = fr.Description
+			}
+			if r.Unit != fr.Unit {
+				changes["unit"] = fr.Unit
+			}
+			if r.Currency != fr.Currency {
+				changes["currency"] = fr.Currency
+			}
+			if (r.Price == nil) != (fr.Price == nil) || (r.Price != nil && *r.Price != *fr.Price) {
+				changes["price"] = fr.Price
+			}
+			if (r.GroupID == nil) != (groupID == nil) || (r.GroupID != nil && *r.GroupID != *groupID) {
+				changes["group_id"] = groupID
+			}
+			if len(changes) > 0 {
+				if err := tx.Unscoped().Model(&r).Updates(changes).Error; err != nil {
+					return err
+				}
+				updated++
+			}
+			continue
+		}
+
+		created = append(created, model.Resource{
+			CreatedAt:      now.AddDate(0, 0, -fr.History[0].DaysAgo),
+			OrganizationID: organization.ID,
+			Name:           fr.Name,
+			Description:    fr.Description,
+			Unit:           fr.Unit,
+			Quantity:       fr.History[len(fr.History)-1].Quantity,
+			Price:          fr.Price,
+			Currency:       fr.Currency,
+			GroupID:        groupID,
+		})
+		sources = append(sources, fr)
+	}
+
+	if len(created) > 0 {
+		if err := tx.CreateInBatches(&created, 500).Error; err != nil {
+			return err
+		}
+	}
+
+	if err := resolveUsers(tx, users, sources); err != nil {
+		return err
+	}
+	var history []model.ResourceHistory
+	for i, r := range created {
+		entries, err := fixtureHistory(r, sources[i].History, users, organization.ID, now)
+		if err != nil {
+			return fmt.Errorf("resource %s: %w", r.Name, err)
+		}
+		history = append(history, entries...)
+	}
+	if len(history) > 0 {
+		if err := tx.CreateInBatches(&history, 1000).Error; err != nil {
+			return err
+		}
+	}
+
+	log.Printf("✅ %s: добавлено %d ресурсов и %d записей истории, обновлено %d ресурсов в организации %s",
+		name, len(created), len(history), updated, organization.Slug)
+	return nil
+}
+
+// seedUsers creates the missing users, verified, and makes every user of the
+// fixture a member of the organization. It returns the IDs by username.
+func seedUsers(tx *gorm.DB, fixtureUsers []FixtureUser, organization model.Organization) (map[string]uint, error) {
+	ids := map[string]uint{}
+	for _, fu := range fixtureUsers {
+		role := fu.Role
+		if role == "" {
+			role = model.RoleUser
+		}
+
+		var user model.User
+		if err := tx.Where("username = ?", fu.Username).Limit(1).Find(&user).Error; err != nil {
+			return nil, err
+		}
+		if user.ID == 0 {
+			hash, err := bcrypt.GenerateFromPassword([]byte(fu.Password), model.PasswordCost)
+			if err != nil {
+				return nil, err
+			}
+			now := time.Now()
+			user = model.User{
+				Username: fu.Username, Email: fu.Email, Password: string(hash), Names: fu.Names,
+				Role: role, EmailVerifiedAt: &now,
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return nil, err
+			}
+			log.Printf("✅ Добавлен пользователь %s", user.Username)
+		}
+
+		membership := model.Membership{UserID: user.ID, OrganizationID: organization.ID}
+		if err := tx.Where(membership).Attrs(model.Membership{Role: role}).FirstOrCreate(&membership).Error; err != nil {
+			return nil, err
+		}
+		ids[user.Username] = user.ID
+	}
+	return ids, nil
+}
+
+// resolveUsers adds the users of the database named in the history but not
+// in the fixture
+func resolveUsers(tx *gorm.DB, users map[string]uint, resources []FixtureResource) error {
+	var missing []string
+	for _, r := range resources {
+		for _, c := range r.History {
+			if _, ok := users[c.User]; !ok {
+				missing = append(missing, c.User)
+			}
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	var found []model.User
+	if err := tx.Where("username IN ?", missing).Find(&found).Error; err != nil {
+		return err
+	}
+	for _, u := range found {
+		users[u.Username] = u.ID
+	}
+	return nil
+}
+
+// seedGroups creates or updates the groups in the organization and returns
+// their IDs by name
+func seedGroups(tx *gorm.DB, fixtureGroups []FixtureGroup, organizationID uint) (map[string]uint, error) {
+	ids := map[string]uint{}
+	for _, fg := range fixtureGroups {
+		var group model.ResourceGroup
+		if err := tx.Where(model.ResourceGroup{OrganizationID: organizationID, Name: fg.Name}).
+			Assign(model.ResourceGroup{Description: fg.Description}).
+			FirstOrCreate(&group).Error; err != nil {
+			return nil, err
+		}
+		ids[group.Name] = group.ID
+	}
+	return ids, nil
+}
+
+// groupOf finds a group of the fixture or, failing that, of the organization
+func groupOf(tx *gorm.DB, groups map[string]uint, name string, organizationID uint) (*uint, error) {
+	if name == "" {
+		return nil, nil
+	}
+	if id, ok := groups[name]; ok {
+		return &id, nil
+	}
+	var group model.ResourceGroup
+	if err := tx.Where("organization_id = ? AND name = ?", organizationID, name).Limit(1).Find(&group).Error; err != nil {
+		return nil, err
+	}
+	if group.ID == 0 {
+		return nil, fmt.Errorf("resource group %q not found", name)
+	}
+	groups[name] = group.ID
+	return &group.ID, nil
+}
+
+// fixtureHistory builds the history entries of a created resource with
+// snapshots of the resource before and after each change
+func fixtureHistory(r model.Resource, changes []FixtureChange, users map[string]uint, organizationID uint, now time.Time) ([]model.ResourceHistory, error) {
+	entries := make([]model.ResourceHistory, 0, len(changes))
+	before := r
+	for _, c := range changes {
+		userID, ok := users[c.User]
+		if !ok {
+			return nil, fmt.Errorf("user %q not found", c.User)
+		}
+		after := r
+		after.Quantity = c.Quantity
+
+		description := c.Description
+		if description == "" && c.Action == "CREATE" {
+			description = "Ресурс '" + r.Name + "' создан"
+		} else if description == "" {
+			description = "Количество ресурса '" + r.Name + "' обновлено"
+		}
+		entry := model.ResourceHistory{
+			OrganizationID: organizationID,
+			ResourceID:     r.ID,
+			Action:         c.Action,
+			UserID:         userID,
+			Timestamp:      now.AddDate(0, 0, -c.DaysAgo),
+			Description:    description,
+		}
+		if c.Action != "CREATE" {
+			oldJSON, _ := json.Marshal(before)
+			entry.OldData = string(oldJSON)
+		}
+		newJSON, _ := json.Marshal(after)
+		entry.NewData = string(newJSON)
+
+		entries = append(entries, entry)
+		before = after
+	}
+	return entries, nil
+}
+
+// generateLoadTest makes count resources with historyLength entries each. The
+// data only depends on its size, so seeding it again changes nothing.
+func generateLoadTest(count, historyLength int) Fixture {
+	if historyLength < 1 {
+		historyLength = 1
+	}
+	random := rand.New(rand.NewSource(1))
+	f := Fixture{
+		Version: FixtureVersion,
+		Users: []FixtureUser{
+			{Username: "loadtest", Email: "loadtest@example.com", Password: "loadtest", Names: "Нагрузочный тест"},
+		},
+		Resources: make([]FixtureResource, 0, count),
+	}
+	for i := 1; i <= count; i++ {
+		quantity := random.Intn(1000)
+		history := []FixtureChange{{Action: "CREATE", Quantity: quantity, User: "loadtest", DaysAgo: historyLength}}
+		for day := historyLength - 1; day > 0; day-- {
+			quantity += random.Intn(201) - 100
+			if quantity < 0 {
+				quantity = 0
+			}
+			history = append(history, FixtureChange{Action: "UPDATE", Quantity: quantity, User: "loadtest", DaysAgo: day})
+		}
+		f.Resources = append(f.Resources, FixtureResource{
+			Name:        fmt.Sprintf("Нагрузочный ресурс %06d", i),
+			Description: "Сгенерирован для нагрузочного тестирования",
+			Unit:        "шт",
+			History:     history,
+		})
+	}
+	return f
+}
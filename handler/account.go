@@ -0,0 +1,270 @@
+package handler
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"app/config"
+	"app/database"
+	"app/model"
+	"app/notify"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ---------------------------------------------------------------------
+//  ENDPOINTS (mounted in router/router.go)
+//  POST /api/auth/forgot-password     – email a password reset link
+//  POST /api/auth/reset-password      – set a new password with a reset token
+//  POST /api/auth/verify-email        – confirm the email address with a token
+//  POST /api/auth/resend-verification – email a new verification link (JWT protected)
+// ---------------------------------------------------------------------
+
+// Lifetimes of emailed tokens
+const (
+	passwordResetTTL     = time.Hour
+	emailVerificationTTL = 72 * time.Hour
+)
+
+var errInvalidUserToken = errors.New("invalid or expired token")
+
+// hashToken is the form in which tokens are stored
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// appURL is the address of the frontend used in emailed links (APP_URL)
+func appURL() string {
+	return strings.TrimRight(config.Get().AppURL, "/")
+}
+
+// emailVerificationRequired reports whether unverified users are refused at login
+// (REQUIRE_EMAIL_VERIFICATION=true)
+func emailVerificationRequired() bool {
+	return config.Get().RequireEmailVerification
+}
+
+// issueUserToken supersedes the unused tokens of the same purpose and returns a new one
+func issueUserToken(tx *gorm.DB, userID uint, purpose string, ttl time.Duration) (string, time.Time, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", time.Time{}, err
+	}
+	token := hex.EncodeToString(raw)
+	now := time.Now()
+
+	if err := tx.Model(&model.UserToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", now).Error; err != nil {
+		return "", time.Time{}, err
+	}
+
+	expiresAt := now.Add(ttl)
+	err := tx.Create(&model.UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: hashToken(token),
+		ExpiresAt: expiresAt,
+	}).Error
+	return token, expiresAt, err
+}
+
+// redeemUserToken marks a valid token as used and returns it
+func redeemUserToken(tx *gorm.DB, token, purpose string) (model.UserToken, error) {
+	var userToken model.UserToken
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", hashToken(token), purpose, time.Now()).
+		First(&userToken).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return userToken, errInvalidUserToken
+	}
+	if err != nil {
+		return userToken, err
+	}
+
+	now := time.Now()
+	userToken.UsedAt = &now
+	return userToken, tx.Save(&userToken).Error
+}
+
+// sendEmailVerification emails the user a link to confirm their address
+func sendEmailVerification(tx *gorm.DB, user model.User) error {
+	token, expiresAt, err := issueUserToken(tx, user.ID, model.TokenEmailVerification, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	link := appURL() + "/verify-email?token=" + url.QueryEscape(token)
+	return notify.AccountLink(tx, user, notify.KindEmailVerification, link, expiresAt)
+}
+
+// ----------  PASSWORD RESET -------------------------------------------
+
+// ForgotPassword emails a reset link. The response is the same whether or not
+// the address belongs to a user so accounts cannot be discovered.
+func ForgotPassword(c *fiber.Ctx) error {
+	type ForgotPasswordInput struct {
+		Email string `json:"email" validate:"required,email"`
+	}
+	var input ForgotPasswordInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "invalid json payload", "data": err.Error()})
+	}
+	if err := validator.New().Struct(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "validation failed", "data": err.Error()})
+	}
+
+	user, err := getUserByEmail(strings.TrimSpace(input.Email))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "Internal Server Error", "data": nil})
+	}
+	if user != nil && !user.ServiceAccount {
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			token, expiresAt, err := issueUserToken(tx, user.ID, model.TokenPasswordReset, passwordResetTTL)
+			if err != nil {
+				return err
+			}
+			link := appURL() + "/reset-password?token=" + url.QueryEscape(token)
+			return notify.AccountLink(tx, *user, notify.KindPasswordReset, link, expiresAt)
+		})
+		if err != nil {
+			log.Println("❌ Cannot queue password reset:", err)
+			return c.Status(fiber.StatusInternalServerError).
+				JSON(fiber.Map{"status": "error", "message": "Internal Server Error", "data": nil})
+		}
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "If the address is registered, a reset link has been sent", "data": nil})
+}
+
+// ResetPassword sets a new password using a reset token. The token proves
+// control of the mailbox, so the address counts as verified afterwards.
+func ResetPassword(c *fiber.Ctx) error {
+	type ResetPasswordInput struct {
+		Token    string `json:"token" validate:"required"`
+		Password string `json:"password" validate:"required,min=6,max=50"`
+	}
+	var input ResetPasswordInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "invalid json payload", "data": err.Error()})
+	}
+	if err := validator.New().Struct(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "validation failed", "data": err.Error()})
+	}
+
+	hash, err := HashPassword(input.Password)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "Couldn't hash password", "data": err.Error()})
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		userToken, err := redeemUserToken(tx, input.Token, model.TokenPasswordReset)
+		if err != nil {
+			return err
+		}
+		var user model.User
+		if err := tx.First(&user, userToken.UserID).Error; err != nil {
+			return errInvalidUserToken
+		}
+		user.Password = hash
+		if user.EmailVerifiedAt == nil {
+			now := time.Now()
+			user.EmailVerifiedAt = &now
+		}
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+		return notify.AccountEvent(tx, user, notify.KindPasswordChanged)
+	})
+	if errors.Is(err, errInvalidUserToken) {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "Invalid or expired token", "data": nil})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "Couldn't reset password", "data": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "Password has been reset", "data": nil})
+}
+
+// ----------  EMAIL VERIFICATION ---------------------------------------
+
+// VerifyEmail confirms the email address of the user the token was sent to
+func VerifyEmail(c *fiber.Ctx) error {
+	type VerifyEmailInput struct {
+		Token string `json:"token" validate:"required"`
+	}
+	var input VerifyEmailInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "invalid json payload", "data": err.Error()})
+	}
+	if err := validator.New().Struct(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "validation failed", "data": err.Error()})
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		userToken, err := redeemUserToken(tx, input.Token, model.TokenEmailVerification)
+		if err != nil {
+			return err
+		}
+		result := tx.Model(&model.User{}).Where("id = ?", userToken.UserID).Update("email_verified_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvalidUserToken
+		}
+		return nil
+	})
+	if errors.Is(err, errInvalidUserToken) {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "Invalid or expired token", "data": nil})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "Couldn't verify email", "data": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "Email address verified", "data": nil})
+}
+
+// ResendVerification emails the current user a new verification link
+func ResendVerification(c *fiber.Ctx) error {
+	db := database.DB
+	var user model.User
+	if err := db.First(&user, getUserIDFromToken(c)).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).
+			JSON(fiber.Map{"status": "error", "message": "User not found", "data": nil})
+	}
+	if user.EmailVerifiedAt != nil {
+		return c.Status(fiber.StatusConflict).
+			JSON(fiber.Map{"status": "error", "message": "Email address already verified", "data": nil})
+	}
+
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		return sendEmailVerification(tx, user)
+	}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "Couldn't send verification email", "data": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "Verification email sent", "data": nil})
+}
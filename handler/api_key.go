@@ -0,0 +1,269 @@
+package handler
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"app/apikey"
+	"app/database"
+	"app/model"
+	"app/tenant"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// ---------------------------------------------------------------------
+//  ENDPOINTS (mounted in router/router.go)
+//  GET    /api/api-keys          – keys of the current user, or ?user_id= (admin) (JWT only)
+//  POST   /api/api-keys          – create a key, shown once (JWT only)
+//  DELETE /api/api-keys/:id      – revoke a key of the current user (admin: any key) (JWT only)
+//  GET    /api/service-accounts  – list service accounts (admin)
+//  POST   /api/service-accounts  – create a service account (admin)
+// ---------------------------------------------------------------------
+
+// apiKeyInput describes the JSON payload for creating API keys
+type apiKeyInput struct {
+	Name      string     `json:"name" validate:"required,min=2,max=100"`
+	Scopes    string     `json:"scopes" validate:"required"`                   // Space-separated: read, write, admin
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`                         // Nil for a key that does not expire
+	UserID    *uint      `json:"user_id,omitempty" validate:"omitempty,min=1"` // Owner other than the current user (admin)
+
+	OrganizationID *uint `json:"organization_id,omitempty" validate:"omitempty,min=1"` // Organization the key acts in, the owner's default when nil
+}
+
+// serviceAccountInput describes the JSON payload for creating service accounts
+type serviceAccountInput struct {
+	Username string `json:"username" validate:"required,min=3,max=50"`
+	Email    string `json:"email" validate:"omitempty,email"` // Contact address, generated when empty
+	Names    string `json:"names"`
+	Role     string `json:"role" validate:"omitempty,oneof=user admin"`
+
+	OrganizationID *uint `json:"organization_id,omitempty" validate:"omitempty,min=1"` // Organization joined, SIGNUP_ORGANIZATION when nil
+}
+
+// isAdmin reports whether the current user has the admin role
+func isAdmin(c *fiber.Ctx) (bool, error) {
+	var user model.User
+	if err := database.DB.First(&user, getUserIDFromToken(c)).Error; err != nil {
+		return false, err
+	}
+	return user.Role == model.RoleAdmin, nil
+}
+
+// ----------  API KEYS -------------------------------------------------
+
+// GetAPIKeys lists API keys, newest first
+func GetAPIKeys(c *fiber.Ctx) error {
+	userID := getUserIDFromToken(c)
+	if requested := c.QueryInt("user_id"); requested > 0 && uint(requested) != userID {
+		admin, err := isAdmin(c)
+		if err != nil || !admin {
+			return c.Status(fiber.StatusForbidden).
+				JSON(fiber.Map{"status": "error", "message": "Admin role required", "data": nil})
+		}
+		userID = uint(requested)
+	}
+
+	var keys []model.APIKey
+	if err := database.DB.Where("user_id = ?", userID).Order("created_at desc").Find(&keys).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot fetch API keys", "data": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "API keys", "data": keys})
+}
+
+// CreateAPIKey creates a key for the current user, or for any user such as a
+// service account when the current user is an admin. The key is returned once.
+func CreateAPIKey(c *fiber.Ctx) error {
+	var input apiKeyInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "invalid json payload", "data": err.Error()})
+	}
+	if err := validator.New().Struct(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "validation failed", "data": err.Error()})
+	}
+	scopes, err := apikey.NormalizeScopes(input.Scopes)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "validation failed", "data": err.Error()})
+	}
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "validation failed", "data": "expires_at must be in the future"})
+	}
+
+	ownerID := getUserIDFromToken(c)
+	if input.UserID != nil && *input.UserID != ownerID {
+		admin, err := isAdmin(c)
+		if err != nil || !admin {
+			return c.Status(fiber.StatusForbidden).
+				JSON(fiber.Map{"status": "error", "message": "Admin role required", "data": nil})
+		}
+		ownerID = *input.UserID
+	}
+	var owner model.User
+	if err := database.DB.First(&owner, ownerID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).
+			JSON(fiber.Map{"status": "error", "message": "user not found", "data": nil})
+	}
+	if input.OrganizationID != nil {
+		_, err := tenant.Resolve(database.DB, owner, *input.OrganizationID)
+		if errors.Is(err, tenant.ErrNotMember) {
+			return c.Status(fiber.StatusBadRequest).
+				JSON(fiber.Map{"status": "error", "message": "validation failed", "data": "the owner is not a member of the organization"})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).
+				JSON(fiber.Map{"status": "error", "message": "cannot create API key", "data": err.Error()})
+		}
+	}
+
+	key, prefix, err := apikey.Generate()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot create API key", "data": err.Error()})
+	}
+	apiKey := model.APIKey{
+		UserID:    owner.ID,
+		Name:      strings.TrimSpace(input.Name),
+		Prefix:    prefix,
+		KeyHash:   apikey.Hash(key),
+		Scopes:    scopes,
+		ExpiresAt: input.ExpiresAt,
+
+		OrganizationID: input.OrganizationID,
+	}
+	if err := database.DB.Create(&apiKey).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot create API key", "data": err.Error()})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"status":  "success",
+		"message": "API key created; store it now, it is not shown again",
+		"data":    fiber.Map{"key": key, "api_key": apiKey},
+	})
+}
+
+// RevokeAPIKey revokes a key at once
+func RevokeAPIKey(c *fiber.Ctx) error {
+	var apiKey model.APIKey
+	if err := database.DB.First(&apiKey, c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).
+			JSON(fiber.Map{"status": "error", "message": "API key not found", "data": nil})
+	}
+	if apiKey.UserID != getUserIDFromToken(c) {
+		// Other users' keys are reported missing unless the caller is an admin
+		if admin, err := isAdmin(c); err != nil || !admin {
+			return c.Status(fiber.StatusNotFound).
+				JSON(fiber.Map{"status": "error", "message": "API key not found", "data": nil})
+		}
+	}
+	if apiKey.RevokedAt != nil {
+		return c.Status(fiber.StatusConflict).
+			JSON(fiber.Map{"status": "error", "message": "API key already revoked", "data": apiKey})
+	}
+
+	now := time.Now()
+	apiKey.RevokedAt = &now
+	if err := database.DB.Model(&apiKey).Update("revoked_at", now).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot revoke API key", "data": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "API key revoked", "data": apiKey})
+}
+
+// ----------  SERVICE ACCOUNTS -----------------------------------------
+
+// GetServiceAccounts lists service accounts
+func GetServiceAccounts(c *fiber.Ctx) error {
+	var users []model.User
+	if err := database.DB.Omit("password").Where("service_account = ?", true).Order("username").Find(&users).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot fetch service accounts", "data": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "service accounts", "data": users})
+}
+
+// CreateServiceAccount creates a user that cannot log in and acts through
+// API keys only, such as an ERP sync job
+func CreateServiceAccount(c *fiber.Ctx) error {
+	var input serviceAccountInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "invalid json payload", "data": err.Error()})
+	}
+	if err := validator.New().Struct(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "validation failed", "data": err.Error()})
+	}
+
+	// The password is random and never shown, so the account cannot log in
+	password, err := randomString(32)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot create service account", "data": err.Error()})
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot create service account", "data": err.Error()})
+	}
+
+	user := model.User{
+		Username:       input.Username,
+		Email:          input.Email,
+		Names:          input.Names,
+		Password:       hash,
+		Role:           input.Role,
+		ServiceAccount: true,
+	}
+	if user.Email == "" {
+		user.Email = input.Username + "@service.invalid"
+	}
+	if user.Role == "" {
+		user.Role = model.RoleUser
+	}
+
+	db := database.DB
+	var taken int64
+	if err := db.Unscoped().Model(&model.User{}).
+		Where("username = ? OR email = ?", user.Username, user.Email).Count(&taken).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot create service account", "data": err.Error()})
+	}
+	if taken > 0 {
+		return c.Status(fiber.StatusConflict).
+			JSON(fiber.Map{"status": "error", "message": "username or email already taken", "data": nil})
+	}
+	if input.OrganizationID != nil {
+		if err := db.First(&model.Organization{}, *input.OrganizationID).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).
+				JSON(fiber.Map{"status": "error", "message": "organization not found", "data": nil})
+		}
+	}
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		if input.OrganizationID == nil {
+			return JoinSignupOrganization(tx, user)
+		}
+		return tx.Create(&model.Membership{UserID: user.ID, OrganizationID: *input.OrganizationID, Role: user.Role}).Error
+	}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot create service account", "data": err.Error()})
+	}
+
+	user.Password = ""
+	return c.Status(fiber.StatusCreated).
+		JSON(fiber.Map{"status": "success", "message": "service account created", "data": user})
+}
@@ -2,13 +2,17 @@ package handler
 
 import (
 	"errors"
+	"log"
 	"net/mail"
+	"strconv"
 	"strings"
 	"time"
 
-	"app/config"
 	"app/database"
 	"app/model"
+	"app/notify"
+	"app/ratelimit"
+	"app/signing"
 
 	"gorm.io/gorm"
 
@@ -88,51 +92,167 @@ func Login(c *fiber.Ctx) error {
 			"message": "Internal Server Error",
 		})
 	}
+
+	// Unknown names are locked too so that lockouts do not reveal which accounts exist
+	lockout := loginLockout()
+	account := "name:" + strings.ToLower(username)
+	if userModel != nil {
+		account = userAccount(userModel.ID)
+	}
+	if wait, err := lockout.Locked(account); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Internal Server Error",
+		})
+	} else if wait > 0 {
+		return tooManyAttempts(c, wait)
+	}
+
 	if userModel == nil || !CheckPasswordHash(pass, userModel.Password) {
+		if _, err := lockout.Fail(account); err != nil {
+			log.Println("❌ Cannot record login failure:", err)
+		}
 		// не раскрываем детали
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"status":  "error",
 			"message": "Invalid username or password",
 		})
 	}
+	if userModel.ServiceAccount {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Service accounts authenticate with API keys",
+		})
+	}
+	if userModel.EmailVerifiedAt == nil && emailVerificationRequired() {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Email address not verified",
+		})
+	}
 
-	token := jwt.New(jwt.SigningMethodHS256)
-	claims := token.Claims.(jwt.MapClaims)
-	claims["username"] = userModel.Username
-	claims["user_id"] = userModel.ID
-	claims["exp"] = time.Now().Add(72 * time.Hour).Unix()
+	if userModel.TOTPEnabledAt != nil {
+		return sendTwoFactorChallenge(c, *userModel, challengeVerify)
+	}
+	required, err := twoFactorRequired(database.DB, userModel.Role)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Internal Server Error",
+		})
+	}
+	if required {
+		return sendTwoFactorChallenge(c, *userModel, challengeEnroll)
+	}
 
-	t, err := token.SignedString([]byte(config.Config("SECRET")))
+	return sendSession(c, *userModel, nil)
+}
+
+// loginLockout locks accounts after repeated wrong passwords or codes
+func loginLockout() *ratelimit.Lockout {
+	return ratelimit.NewLockout(ratelimit.Shared(database.DB))
+}
+
+// userAccount is the lockout key of an existing user
+func userAccount(id uint) string {
+	return "user:" + strconv.FormatUint(uint64(id), 10)
+}
+
+// tooManyAttempts answers a request for a locked account
+func tooManyAttempts(c *fiber.Ctx, wait time.Duration) error {
+	c.Set(fiber.HeaderRetryAfter, ratelimit.RetryAfter(wait))
+	return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+		"status":  "error",
+		"message": "Too many failed attempts, try again later",
+	})
+}
+
+// sendSession issues the JWT of a fully authenticated user and clears their
+// failed attempts. Extra fields are added to the response data.
+func sendSession(c *fiber.Ctx, userModel model.User, extra fiber.Map) error {
+	if err := loginLockout().Succeed(userAccount(userModel.ID)); err != nil {
+		log.Println("❌ Cannot reset login failures:", err)
+	}
+
+	member, err := defaultMember(userModel)
+	if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	t, err := issueToken(userModel, member.OrganizationID)
 	if err != nil {
 		return c.SendStatus(fiber.StatusInternalServerError)
 	}
 
+	data := fiber.Map{
+		"user": fiber.Map{
+			"id":                userModel.ID,
+			"username":          userModel.Username,
+			"email":             userModel.Email,
+			"names":             userModel.Names,
+			"role":              userModel.Role,
+			"email_verified_at": userModel.EmailVerifiedAt,
+			"totp_enabled_at":   userModel.TOTPEnabledAt,
+			"created_at":        userModel.CreatedAt,
+			"updated_at":        userModel.UpdatedAt,
+		},
+		"token": t,
+	}
+	if member.OrganizationID != 0 {
+		data["organization"] = member
+	}
+	for k, v := range extra {
+		data[k] = v
+	}
+
 	// Return both user and token as expected by frontend
 	return c.JSON(fiber.Map{
 		"status":  "success",
 		"message": "Success login",
-		"data": fiber.Map{
-			"user": fiber.Map{
-				"id":         userModel.ID,
-				"username":   userModel.Username,
-				"email":      userModel.Email,
-				"names":      userModel.Names,
-				"created_at": userModel.CreatedAt,
-				"updated_at": userModel.UpdatedAt,
-			},
-			"token": t,
-		},
+		"data":    data,
 	})
 }
 
+// issueToken signs the session token of a user acting in an organization, or
+// in none for organizationID 0
+func issueToken(userModel model.User, organizationID uint) (string, error) {
+	claims := jwt.MapClaims{}
+	claims["username"] = userModel.Username
+	claims["user_id"] = userModel.ID
+	claims["role"] = userModel.Role
+	if organizationID != 0 {
+		claims["org_id"] = organizationID
+	}
+	claims["exp"] = time.Now().Add(signing.TokenTTL).Unix()
+	return signing.Sign(claims)
+}
+
 func Register(c *fiber.Ctx) error {
 	var u model.User
 	if err := c.BodyParser(&u); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": err.Error()})
 	}
-	hash, _ := hashPassword(u.Password)
+	hash, err := HashPassword(u.Password)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": "Couldn't hash password"})
+	}
 	u.Password = hash
-	if err := database.DB.Create(&u).Error; err != nil {
+	u.Role = model.RoleUser // roles are granted by admins only
+	u.EmailVerifiedAt = nil
+	u.TOTPEnabledAt = nil
+	u.OIDCIssuer, u.OIDCSubject = nil, nil
+	u.ServiceAccount = false
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&u).Error; err != nil {
+			return err
+		}
+		if err := JoinSignupOrganization(tx, u); err != nil {
+			return err
+		}
+		if err := notify.AccountEvent(tx, u, notify.KindAccountRegistered); err != nil {
+			return err
+		}
+		return sendEmailVerification(tx, u)
+	}); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"status": "error", "message": err.Error()})
 	}
 	return c.JSON(fiber.Map{"status": "success", "data": map[string]interface{}{
@@ -0,0 +1,215 @@
+package handler
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"app/config"
+	"app/database"
+	"app/model"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ---------------------------------------------------------------------
+//  ENDPOINTS (mounted in router/router.go)
+//  GET    /api/exchange-rates        – list rates, optionally ?currency=
+//  POST   /api/exchange-rates        – add or replace a rate (admin)
+//  POST   /api/exchange-rates/import – load rates from a CSV file (admin)
+//  DELETE /api/exchange-rates/:id    – delete a rate (admin)
+// ---------------------------------------------------------------------
+
+// exchangeRateInput describes the JSON payload for adding a rate
+type exchangeRateInput struct {
+	Currency      string  `json:"currency" validate:"required,iso4217"`
+	EffectiveDate string  `json:"effective_date" validate:"required"` // RFC 3339 or YYYY-MM-DD
+	Rate          float64 `json:"rate" validate:"required,gt=0"`
+}
+
+// baseCurrency is the currency the books are kept in (BASE_CURRENCY, RUB by default)
+func baseCurrency() string {
+	return strings.ToUpper(config.Get().BaseCurrency)
+}
+
+// upsertRates stores rates, replacing existing ones for the same currency and date
+func upsertRates(db *gorm.DB, rates []model.ExchangeRate) error {
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "currency"}, {Name: "effective_date"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate", "updated_at"}),
+	}).Create(&rates).Error
+}
+
+// toExchangeRate validates an input and converts it to a model
+func toExchangeRate(input exchangeRateInput) (model.ExchangeRate, error) {
+	input.Currency = strings.ToUpper(strings.TrimSpace(input.Currency))
+	if err := validator.New().Struct(&input); err != nil {
+		return model.ExchangeRate{}, err
+	}
+	if input.Currency == baseCurrency() {
+		return model.ExchangeRate{}, fmt.Errorf("%s is the base currency", input.Currency)
+	}
+	date, err := parseDate(strings.TrimSpace(input.EffectiveDate))
+	if err != nil {
+		return model.ExchangeRate{}, fmt.Errorf("invalid effective_date: %w", err)
+	}
+	return model.ExchangeRate{Currency: input.Currency, EffectiveDate: date, Rate: input.Rate}, nil
+}
+
+// ----------  LIST -----------------------------------------------------
+
+// GetExchangeRates lists rates, newest first
+func GetExchangeRates(c *fiber.Ctx) error {
+	db := database.DB
+	if currency := strings.ToUpper(c.Query("currency")); currency != "" {
+		db = db.Where("currency = ?", currency)
+	}
+
+	var rates []model.ExchangeRate
+	if err := db.Order("effective_date desc").Order("currency").Find(&rates).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot fetch exchange rates", "data": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "exchange rates", "data": fiber.Map{
+		"base_currency": baseCurrency(),
+		"rates":         rates,
+	}})
+}
+
+// ----------  CREATE ---------------------------------------------------
+
+// CreateExchangeRate adds a rate or replaces the rate of the same currency and date
+func CreateExchangeRate(c *fiber.Ctx) error {
+	var input exchangeRateInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "invalid json payload", "data": err.Error()})
+	}
+
+	rate, err := toExchangeRate(input)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "validation failed", "data": err.Error()})
+	}
+
+	if err := upsertRates(database.DB, []model.ExchangeRate{rate}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot save exchange rate", "data": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "exchange rate saved", "data": rate})
+}
+
+// ImportExchangeRates loads rates from a CSV file uploaded as the "file" form field.
+// Each row is currency,effective_date,rate; a header row, semicolon separators and
+// decimal commas are accepted. The file is rejected as a whole if any row is invalid.
+func ImportExchangeRates(c *fiber.Ctx) error {
+	header, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "missing file", "data": err.Error()})
+	}
+	file, err := header.Open()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "cannot read file", "data": err.Error()})
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "cannot read file", "data": err.Error()})
+	}
+
+	rates, lineErrors := parseRatesCSV(string(content))
+	if len(lineErrors) > 0 {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "invalid rows in file", "data": lineErrors})
+	}
+	if len(rates) == 0 {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "file contains no rates", "data": nil})
+	}
+
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		return upsertRates(tx, rates)
+	}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot save exchange rates", "data": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": fmt.Sprintf("%d exchange rates imported", len(rates)), "data": nil})
+}
+
+// parseRatesCSV reads currency,effective_date,rate rows and reports every invalid line
+func parseRatesCSV(content string) ([]model.ExchangeRate, []string) {
+	reader := csv.NewReader(strings.NewReader(content))
+	firstLine, _, _ := strings.Cut(content, "\n")
+	if strings.Contains(firstLine, ";") {
+		reader.Comma = ';'
+	}
+	reader.FieldsPerRecord = 3
+	reader.TrimLeadingSpace = true
+
+	var (
+		rates      []model.ExchangeRate
+		lineErrors []string
+	)
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			lineErrors = append(lineErrors, err.Error())
+			continue
+		}
+		if line == 1 && strings.EqualFold(strings.TrimSpace(record[0]), "currency") {
+			continue
+		}
+
+		value, err := strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(record[2]), ",", "."), 64)
+		if err != nil {
+			lineErrors = append(lineErrors, fmt.Sprintf("line %d: invalid rate %q", line, record[2]))
+			continue
+		}
+		rate, err := toExchangeRate(exchangeRateInput{Currency: record[0], EffectiveDate: record[1], Rate: value})
+		if err != nil {
+			lineErrors = append(lineErrors, fmt.Sprintf("line %d: %s", line, err))
+			continue
+		}
+		rates = append(rates, rate)
+	}
+	return rates, lineErrors
+}
+
+// ----------  DELETE ---------------------------------------------------
+
+// DeleteExchangeRate removes a rate
+func DeleteExchangeRate(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "invalid exchange rate id", "data": err.Error()})
+	}
+
+	result := database.DB.Delete(&model.ExchangeRate{}, id)
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot delete exchange rate", "data": result.Error.Error()})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).
+			JSON(fiber.Map{"status": "error", "message": "exchange rate not found", "data": nil})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "exchange rate deleted", "data": nil})
+}
@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"app/database"
+	"app/migrate"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ---------------------------------------------------------------------
+//  ENDPOINTS (mounted in router/router.go)
+//  GET /healthz   – the process answers (liveness)
+//  GET /readyz    – the database answers and is migrated (readiness)
+// ---------------------------------------------------------------------
+
+// readyTimeout bounds the database checks of a readiness probe
+const readyTimeout = 2 * time.Second
+
+// Healthz answers as long as the server runs, whatever the state of the database
+func Healthz(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"status": "success", "message": "alive", "data": nil})
+}
+
+// Readyz answers 503 Service Unavailable while the database is unreachable or
+// has pending migrations, so that load balancers hold traffic back
+func Readyz(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), readyTimeout)
+	defer cancel()
+
+	if err := database.Ping(ctx); err != nil {
+		return c.Status(fiber.StatusServiceUnavailable).
+			JSON(fiber.Map{"status": "error", "message": "Database unavailable", "data": err.Error()})
+	}
+	pending, err := migrate.Pending(ctx, database.DB)
+	if err != nil {
+		return c.Status(fiber.StatusServiceUnavailable).
+			JSON(fiber.Map{"status": "error", "message": "Cannot read migrations", "data": err.Error()})
+	}
+	if len(pending) > 0 {
+		versions := make([]int, len(pending))
+		for i, m := range pending {
+			versions[i] = m.Version
+		}
+		return c.Status(fiber.StatusServiceUnavailable).
+			JSON(fiber.Map{"status": "error", "message": "Migrations pending", "data": versions})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "ready", "data": nil})
+}
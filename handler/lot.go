@@ -0,0 +1,349 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"app/model"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ---------------------------------------------------------------------
+//  ENDPOINTS (mounted in router/router.go)
+//  GET  /api/resource/:id/lots  – list lots of a resource (JWT protected)
+//  POST /api/resource/:id/lots  – receive a new lot (JWT protected)
+//  POST /api/resource/:id/issue – issue quantity using FEFO (JWT protected)
+//  GET  /api/lots/expiring      – lots expiring within ?days=N (default 30) (JWT protected)
+// ---------------------------------------------------------------------
+
+var (
+	// errInsufficientStock is returned when an issue exceeds the available stock
+	errInsufficientStock = errors.New("insufficient stock")
+	// errSerializedResource is returned for quantity operations on serialized resources
+	errSerializedResource = errors.New("serialized resource")
+)
+
+// lotReceiveInput describes the JSON payload for receiving a lot
+type lotReceiveInput struct {
+	LotNumber   string   `json:"lot_number" validate:"max=100"`
+	Quantity    int      `json:"quantity" validate:"required,min=1"`
+	ReceivedAt  string   `json:"received_at"` // RFC 3339 or YYYY-MM-DD, defaults to now
+	ExpiresAt   string   `json:"expires_at"`  // RFC 3339 or YYYY-MM-DD, empty if the lot never expires
+	Certificate string   `json:"certificate" validate:"max=255"`
+	UnitCost    *float64 `json:"unit_cost,omitempty" validate:"omitempty,min=0"`
+	Currency    string   `json:"currency" validate:"omitempty,iso4217"` // Defaults to the resource currency
+}
+
+// issueInput describes the JSON payload for issuing stock
+type issueInput struct {
+	Quantity    int    `json:"quantity" validate:"required,min=1"`
+	Description string `json:"description"`
+}
+
+// lotAllocation tells how much of an issue was taken from a lot
+type lotAllocation struct {
+	LotID     uint       `json:"lot_id"`
+	LotNumber string     `json:"lot_number"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Quantity  int        `json:"quantity"`
+}
+
+// parseDate accepts either an RFC 3339 timestamp or a plain YYYY-MM-DD date
+func parseDate(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", s, time.Local)
+}
+
+// fefoOrder sorts lots first-expire-first-out; lots without expiry go last
+func fefoOrder(db *gorm.DB) *gorm.DB {
+	return db.Order("expires_at IS NULL").Order("expires_at").Order("received_at").Order("id")
+}
+
+// allocateFEFO takes qty from the given lots in order, skipping expired ones.
+// It returns the allocations and the quantity that could not be covered by lots.
+func allocateFEFO(lots []model.Lot, qty int, now time.Time) ([]lotAllocation, int) {
+	allocations := []lotAllocation{}
+	for _, lot := range lots {
+		if qty == 0 {
+			break
+		}
+		if lot.Quantity <= 0 || lot.Expired(now) {
+			continue
+		}
+		take := min(lot.Quantity, qty)
+		allocations = append(allocations, lotAllocation{
+			LotID:     lot.ID,
+			LotNumber: lot.LotNumber,
+			ExpiresAt: lot.ExpiresAt,
+			Quantity:  take,
+		})
+		qty -= take
+	}
+	return allocations, qty
+}
+
+// ----------  LIST -----------------------------------------------------
+
+// GetResourceLots returns the lots of a resource in FEFO order
+func GetResourceLots(c *fiber.Ctx) error {
+	db := tenantDB(c)
+
+	resource, _, err := findReadableResource(c, db, c.Params("id"))
+	if err != nil {
+		return resourceLookupError(c, err)
+	}
+
+	var lots []model.Lot
+	if err := fefoOrder(db.Where("resource_id = ?", resource.ID)).Find(&lots).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot fetch lots", "data": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "resource lots", "data": lots})
+}
+
+// ----------  RECEIVE --------------------------------------------------
+
+// ReceiveLot registers a new lot and adds its quantity to the resource stock
+func ReceiveLot(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var input lotReceiveInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "invalid json payload", "data": err.Error()})
+	}
+
+	if err := validator.New().Struct(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "validation failed", "data": err.Error()})
+	}
+
+	lot := model.Lot{
+		LotNumber:       input.LotNumber,
+		InitialQuantity: input.Quantity,
+		Quantity:        input.Quantity,
+		ReceivedAt:      time.Now(),
+		Certificate:     input.Certificate,
+		UnitCost:        input.UnitCost,
+		Currency:        input.Currency,
+	}
+	if input.ReceivedAt != "" {
+		t, err := parseDate(input.ReceivedAt)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).
+				JSON(fiber.Map{"status": "error", "message": "invalid received_at", "data": err.Error()})
+		}
+		lot.ReceivedAt = t
+	}
+	if input.ExpiresAt != "" {
+		t, err := parseDate(input.ExpiresAt)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).
+				JSON(fiber.Map{"status": "error", "message": "invalid expires_at", "data": err.Error()})
+		}
+		lot.ExpiresAt = &t
+	}
+
+	grants, err := callerGrants(c)
+	if err != nil {
+		return grantsError(c, err)
+	}
+
+	by := getActor(c)
+	var resource model.Resource
+	err = tenantDB(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&resource, id).Error; err != nil {
+			return err
+		}
+		if err := checkResourceAction(grants, resource, model.ActionAdjust); err != nil {
+			return err
+		}
+		if resource.Serialized {
+			return errSerializedResource
+		}
+		oldResource := resource
+
+		lot.ResourceID = resource.ID
+		if lot.Currency == "" {
+			lot.Currency = resource.Currency
+		}
+		if err := tx.Create(&lot).Error; err != nil {
+			return err
+		}
+
+		resource.Quantity += lot.Quantity
+		if err := tx.Save(&resource).Error; err != nil {
+			return err
+		}
+
+		history, err := buildHistory(resource.ID, "RECEIVE", by, oldResource, resource,
+			fmt.Sprintf("Lot '%s' of %d %s received for resource '%s'", lot.LotNumber, lot.Quantity, resource.Unit, resource.Name))
+		if err != nil {
+			return err
+		}
+		history.UnitCost = lot.UnitCost
+		history.Currency = lot.Currency
+		return tx.Create(&history).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).
+			JSON(fiber.Map{"status": "error", "message": "resource not found", "data": nil})
+	}
+	if errors.Is(err, errPermissionDenied) {
+		return permissionDenied(c)
+	}
+	if errors.Is(err, errSerializedResource) {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "serialized resources are received as items", "data": nil})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot receive lot", "data": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "lot received", "data": lot})
+}
+
+// ----------  ISSUE ----------------------------------------------------
+
+// IssueResource consumes stock first-expire-first-out across the resource lots.
+// Stock not covered by any lot (e.g. received before lot tracking) is issued last.
+func IssueResource(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var input issueInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "invalid json payload", "data": err.Error()})
+	}
+
+	if err := validator.New().Struct(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "validation failed", "data": err.Error()})
+	}
+
+	grants, err := callerGrants(c)
+	if err != nil {
+		return grantsError(c, err)
+	}
+
+	by := getActor(c)
+	var (
+		resource    model.Resource
+		allocations []lotAllocation
+		untracked   int
+	)
+	err = tenantDB(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&resource, id).Error; err != nil {
+			return err
+		}
+		if err := checkResourceAction(grants, resource, model.ActionAdjust); err != nil {
+			return err
+		}
+		if resource.Serialized {
+			return errSerializedResource
+		}
+		oldResource := resource
+
+		var lots []model.Lot
+		if err := fefoOrder(tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("resource_id = ? AND quantity > 0", resource.ID)).Find(&lots).Error; err != nil {
+			return err
+		}
+
+		inLots := 0
+		for _, lot := range lots {
+			inLots += lot.Quantity
+		}
+
+		var rest int
+		allocations, rest = allocateFEFO(lots, input.Quantity, time.Now())
+		untracked = max(resource.Quantity-inLots, 0)
+		if rest > untracked {
+			return errInsufficientStock
+		}
+		untracked = rest
+
+		for _, a := range allocations {
+			if err := tx.Model(&model.Lot{}).Where("id = ?", a.LotID).
+				Update("quantity", gorm.Expr("quantity - ?", a.Quantity)).Error; err != nil {
+				return err
+			}
+		}
+
+		resource.Quantity -= input.Quantity
+		if err := tx.Save(&resource).Error; err != nil {
+			return err
+		}
+
+		description := input.Description
+		if description == "" {
+			description = fmt.Sprintf("%d %s of resource '%s' issued", input.Quantity, resource.Unit, resource.Name)
+		}
+		return logResourceChange(tx, resource.ID, "ISSUE", by, oldResource, resource, description)
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).
+			JSON(fiber.Map{"status": "error", "message": "resource not found", "data": nil})
+	}
+	if errors.Is(err, errInsufficientStock) {
+		return c.Status(fiber.StatusConflict).
+			JSON(fiber.Map{"status": "error", "message": "insufficient non-expired stock", "data": nil})
+	}
+	if errors.Is(err, errPermissionDenied) {
+		return permissionDenied(c)
+	}
+	if errors.Is(err, errSerializedResource) {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "serialized resources are issued by assigning items", "data": nil})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot issue resource", "data": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "resource issued", "data": fiber.Map{
+		"resource":    resource,
+		"allocations": allocations,
+		"untracked":   untracked,
+	}})
+}
+
+// ----------  EXPIRING -------------------------------------------------
+
+// GetExpiringLots lists non-empty lots expiring within the next N days,
+// including lots that have already expired
+func GetExpiringLots(c *fiber.Ctx) error {
+	days := 30
+	if d := c.Query("days"); d != "" {
+		n, err := strconv.Atoi(d)
+		if err != nil || n < 0 {
+			return c.Status(fiber.StatusBadRequest).
+				JSON(fiber.Map{"status": "error", "message": "days must be a non-negative integer", "data": nil})
+		}
+		days = n
+	}
+
+	grants, err := callerGrants(c)
+	if err != nil {
+		return grantsError(c, err)
+	}
+
+	until := time.Now().AddDate(0, 0, days)
+	var lots []model.Lot
+	if err := grants.FilterRelated(tenantDB(c), "lots", model.ActionRead).Preload("Resource").
+		Where("quantity > 0 AND expires_at IS NOT NULL AND expires_at <= ?", until).
+		Order("expires_at").Find(&lots).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot fetch lots", "data": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": fmt.Sprintf("lots expiring within %d days", days), "data": lots})
+}
@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"strconv"
+	"time"
+
+	"app/database"
+	"app/model"
+	"app/notify"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ---------------------------------------------------------------------
+//  ENDPOINTS (mounted in router/router.go)
+//  GET  /api/notifications/preferences – preferences of the current user (JWT protected)
+//  PUT  /api/notifications/preferences – change them (JWT protected)
+//  GET  /api/notifications             – outbox, optionally ?status= (admin)
+//  POST /api/notifications/:id/retry   – queue a failed notification again (admin)
+// ---------------------------------------------------------------------
+
+// notificationPreferenceInput describes the JSON payload for changing preferences
+type notificationPreferenceInput struct {
+	Language             *string `json:"language,omitempty" validate:"omitempty,oneof=ru en"`
+	StockChanges         *bool   `json:"stock_changes,omitempty"`
+	StockChangeThreshold *int    `json:"stock_change_threshold,omitempty" validate:"omitempty,min=0,max=100"`
+	AccountEvents        *bool   `json:"account_events,omitempty"`
+}
+
+// ----------  PREFERENCES ----------------------------------------------
+
+// GetNotificationPreferences returns the preferences of the current user
+func GetNotificationPreferences(c *fiber.Ctx) error {
+	pref, err := notify.Preference(database.DB, getUserIDFromToken(c))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot fetch notification preferences", "data": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "notification preferences", "data": pref})
+}
+
+// UpdateNotificationPreferences changes the preferences of the current user
+func UpdateNotificationPreferences(c *fiber.Ctx) error {
+	var input notificationPreferenceInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "invalid json payload", "data": err.Error()})
+	}
+
+	if err := validator.New().Struct(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "validation failed", "data": err.Error()})
+	}
+
+	db := database.DB
+	pref, err := notify.Preference(db, getUserIDFromToken(c))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot fetch notification preferences", "data": err.Error()})
+	}
+
+	if input.Language != nil {
+		pref.Language = *input.Language
+	}
+	if input.StockChanges != nil {
+		pref.StockChanges = *input.StockChanges
+	}
+	if input.StockChangeThreshold != nil {
+		pref.StockChangeThreshold = *input.StockChangeThreshold
+	}
+	if input.AccountEvents != nil {
+		pref.AccountEvents = *input.AccountEvents
+	}
+
+	if err := db.Save(&pref).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot save notification preferences", "data": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "notification preferences saved", "data": pref})
+}
+
+// ----------  OUTBOX ---------------------------------------------------
+
+// GetNotifications lists the outbox, newest first
+func GetNotifications(c *fiber.Ctx) error {
+	db := database.DB
+	if status := c.Query("status"); status != "" {
+		if status != model.NotificationPending && status != model.NotificationSent && status != model.NotificationFailed {
+			return c.Status(fiber.StatusBadRequest).
+				JSON(fiber.Map{"status": "error", "message": "unknown notification status", "data": nil})
+		}
+		db = db.Where("status = ?", status)
+	}
+
+	var notifications []model.Notification
+	if err := db.Order("created_at desc").Order("id desc").Limit(200).Find(&notifications).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot fetch notifications", "data": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "notifications", "data": notifications})
+}
+
+// RetryNotification queues a failed notification for immediate delivery
+func RetryNotification(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "invalid notification id", "data": err.Error()})
+	}
+
+	result := database.DB.Model(&model.Notification{}).
+		Where("id = ? AND status = ?", id, model.NotificationFailed).
+		Updates(map[string]interface{}{
+			"status":          model.NotificationPending,
+			"attempts":        0,
+			"next_attempt_at": time.Now(),
+		})
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot retry notification", "data": result.Error.Error()})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).
+			JSON(fiber.Map{"status": "error", "message": "failed notification not found", "data": nil})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "notification queued", "data": nil})
+}
@@ -0,0 +1,311 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"app/config"
+	"app/database"
+	"app/model"
+	"app/signing"
+	"app/sso"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+// ---------------------------------------------------------------------
+//  ENDPOINTS (mounted in router/router.go)
+//  GET /api/auth/oidc/login    – redirect to the identity provider
+//  GET /api/auth/oidc/callback – finish the login and redirect to the frontend
+// ---------------------------------------------------------------------
+
+const (
+	oidcStateCookie = "oidc_state"
+	oidcStateTTL    = 10 * time.Minute // Time the user has to log in at the provider
+	oidcTimeout     = 10 * time.Second // Limit on calls to the provider
+)
+
+var (
+	errOIDCNoEmail         = errors.New("the identity provider did not share an email address")
+	errOIDCAccountConflict = errors.New("the email address belongs to another account")
+	errOIDCAccountDisabled = errors.New("the account is deleted")
+)
+
+// oidcStateKey signs the login state cookie. It is derived from SECRET so that
+// the cookie can never be used as a session token.
+func oidcStateKey() []byte {
+	sum := sha256.Sum256([]byte("oidc-state:" + config.Get().Secret))
+	return sum[:]
+}
+
+// randomString returns n random bytes in hex
+func randomString(n int) (string, error) {
+	raw := make([]byte, n)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+// oidcProvider returns the configured provider, answering the request itself
+// when there is none
+func oidcProvider(c *fiber.Ctx) (*sso.Provider, error) {
+	ctx, cancel := context.WithTimeout(c.UserContext(), oidcTimeout)
+	defer cancel()
+
+	provider, err := sso.Default(ctx)
+	if errors.Is(err, sso.ErrNotConfigured) {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status":  "error",
+			"message": "OpenID Connect login is not configured",
+		})
+	}
+	if err != nil {
+		log.Println("❌ OpenID Connect provider unavailable:", err)
+		return nil, c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"status":  "error",
+			"message": "Identity provider unavailable",
+		})
+	}
+	return provider, nil
+}
+
+// oidcRedirect sends the browser back to the frontend. The result travels in
+// the fragment so that it never reaches server logs.
+func oidcRedirect(c *fiber.Ctx, result url.Values) error {
+	return c.Redirect(appURL()+"/oidc/callback#"+result.Encode(), fiber.StatusFound)
+}
+
+func oidcFailure(c *fiber.Ctx, code string) error {
+	return oidcRedirect(c, url.Values{"error": {code}})
+}
+
+// OIDCLogin starts an authorization code flow with PKCE. The state, nonce and
+// code verifier are kept in a signed cookie so that any process can handle
+// the callback.
+func OIDCLogin(c *fiber.Ctx) error {
+	provider, err := oidcProvider(c)
+	if provider == nil {
+		return err
+	}
+
+	state, err := randomString(16)
+	if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	nonce, err := randomString(16)
+	if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	expiresAt := time.Now().Add(oidcStateTTL)
+	cookie, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"state":    state,
+		"nonce":    nonce,
+		"verifier": verifier,
+		"exp":      expiresAt.Unix(),
+	}).SignedString(oidcStateKey())
+	if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     oidcStateCookie,
+		Value:    cookie,
+		Path:     "/api/auth/oidc",
+		Expires:  expiresAt,
+		Secure:   c.Protocol() == "https",
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode, // The provider redirects back with a top-level GET
+	})
+	return c.Redirect(provider.AuthCodeURL(state, nonce, verifier), fiber.StatusFound)
+}
+
+// OIDCCallback redeems the authorization code, provisions the user and
+// redirects to APP_URL/oidc/callback with the session token, or an error code,
+// in the fragment
+func OIDCCallback(c *fiber.Ctx) error {
+	provider, err := oidcProvider(c)
+	if provider == nil {
+		return err
+	}
+
+	cookie := c.Cookies(oidcStateCookie)
+	c.ClearCookie(oidcStateCookie)
+	if reason := c.Query("error"); reason != "" {
+		return oidcFailure(c, reason)
+	}
+
+	token, err := jwt.Parse(cookie, func(*jwt.Token) (interface{}, error) {
+		return oidcStateKey(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return oidcFailure(c, "invalid_state")
+	}
+	claims := token.Claims.(jwt.MapClaims)
+	state, _ := claims["state"].(string)
+	nonce, _ := claims["nonce"].(string)
+	verifier, _ := claims["verifier"].(string)
+	if state == "" || c.Query("state") != state {
+		return oidcFailure(c, "invalid_state")
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), oidcTimeout)
+	defer cancel()
+	identity, err := provider.Exchange(ctx, c.Query("code"), verifier, nonce)
+	if err != nil {
+		log.Println("❌ OpenID Connect login failed:", err)
+		return oidcFailure(c, "invalid_grant")
+	}
+
+	role, ok := provider.Role(identity)
+	if !ok {
+		return oidcFailure(c, "access_denied")
+	}
+
+	var user model.User
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		user, err = provisionOIDCUser(tx, identity, role)
+		return err
+	})
+	switch {
+	case errors.Is(err, errOIDCNoEmail):
+		return oidcFailure(c, "email_required")
+	case errors.Is(err, errOIDCAccountConflict):
+		return oidcFailure(c, "account_conflict")
+	case errors.Is(err, errOIDCAccountDisabled):
+		return oidcFailure(c, "access_denied")
+	case err != nil:
+		log.Println("❌ Cannot provision OpenID Connect user:", err)
+		return oidcFailure(c, "server_error")
+	}
+
+	// The provider is responsible for second factors of its users
+	member, err := defaultMember(user)
+	if err != nil {
+		return oidcFailure(c, "server_error")
+	}
+	t, err := issueToken(user, member.OrganizationID)
+	if err != nil {
+		return oidcFailure(c, "server_error")
+	}
+	return oidcRedirect(c, url.Values{
+		"token":      {t},
+		"expires_in": {strconv.Itoa(int(signing.TokenTTL.Seconds()))},
+	})
+}
+
+// provisionOIDCUser finds the user of an identity, linking an existing
+// account with the same verified email or creating one on first login. The
+// role follows the groups of the identity on every login.
+func provisionOIDCUser(tx *gorm.DB, identity sso.Identity, role string) (model.User, error) {
+	var user model.User
+	err := tx.Unscoped().Where("oidc_issuer = ? AND oidc_subject = ?", identity.Issuer, identity.Subject).
+		Limit(1).Find(&user).Error
+	if err != nil {
+		return user, err
+	}
+	if user.DeletedAt.Valid {
+		return user, errOIDCAccountDisabled
+	}
+
+	if user.ID == 0 {
+		if identity.Email == "" {
+			return user, errOIDCNoEmail
+		}
+		if err := tx.Unscoped().Where("email = ?", identity.Email).Limit(1).Find(&user).Error; err != nil {
+			return user, err
+		}
+		// Only a verified address proves the identity owns the account
+		if user.ID != 0 && (!identity.EmailVerified || user.OIDCSubject != nil || user.ServiceAccount) {
+			return user, errOIDCAccountConflict
+		}
+		if user.DeletedAt.Valid {
+			return user, errOIDCAccountDisabled
+		}
+		user.OIDCIssuer = &identity.Issuer
+		user.OIDCSubject = &identity.Subject
+	}
+
+	if user.ID == 0 {
+		username, err := uniqueUsername(tx, identity)
+		if err != nil {
+			return user, err
+		}
+		// Local login stays impossible until the user resets the password
+		password, err := randomString(32)
+		if err != nil {
+			return user, err
+		}
+		hash, err := HashPassword(password)
+		if err != nil {
+			return user, err
+		}
+		user.Username = username
+		user.Email = identity.Email
+		user.Password = hash
+	}
+
+	if user.Names == "" {
+		user.Names = identity.Name
+	}
+	if identity.EmailVerified && user.EmailVerifiedAt == nil && strings.EqualFold(user.Email, identity.Email) {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+	created := user.ID == 0
+	user.Role = role
+	if err := tx.Save(&user).Error; err != nil {
+		return user, err
+	}
+	if created {
+		return user, JoinSignupOrganization(tx, user)
+	}
+	return user, nil
+}
+
+var usernameDisallowed = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+// uniqueUsername derives a free username from the preferred username or the
+// email address of an identity
+func uniqueUsername(tx *gorm.DB, identity sso.Identity) (string, error) {
+	base := identity.Username
+	if base == "" {
+		base, _, _ = strings.Cut(identity.Email, "@")
+	}
+	base = strings.Trim(usernameDisallowed.ReplaceAllString(strings.ToLower(base), "-"), "-")
+	if len(base) < 3 {
+		base = "user-" + base
+	}
+	if len(base) > 40 {
+		base = base[:40]
+	}
+
+	for n := 1; n <= 100; n++ {
+		candidate := base
+		if n > 1 {
+			candidate = base + "-" + strconv.Itoa(n)
+		}
+		var count int64
+		if err := tx.Unscoped().Model(&model.User{}).Where("username = ?", candidate).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+	}
+	return randomString(8)
+}
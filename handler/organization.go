@@ -0,0 +1,351 @@
+package handler
+
+import (
+	"errors"
+	"regexp"
+
+	"app/config"
+	"app/database"
+	"app/model"
+	"app/tenant"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// ---------------------------------------------------------------------
+//  ENDPOINTS (mounted in router/router.go)
+//  GET    /api/organizations                       – organizations the current user can act in (JWT protected)
+//  POST   /api/organizations                       – create an organization with the default permissions (admin)
+//  PUT    /api/organizations/:id                   – rename an organization (admin)
+//  POST   /api/organizations/:id/switch            – token acting in another organization (JWT only)
+//  GET    /api/organizations/:id/members           – members and their roles (organization admin)
+//  PUT    /api/organizations/:id/members/:user_id  – add a member or change their role (organization admin)
+//  DELETE /api/organizations/:id/members/:user_id  – remove a member (organization admin)
+// ---------------------------------------------------------------------
+
+// organizationInput describes the JSON payload for organizations
+type organizationInput struct {
+	Name string `json:"name" validate:"required,min=2,max=100"`
+	Slug string `json:"slug" validate:"required,min=2,max=50"` // Lowercase letters, digits and dashes
+}
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// membershipInput describes the JSON payload for memberships
+type membershipInput struct {
+	Role string `json:"role" validate:"required,oneof=user admin"`
+}
+
+// tenantDB is the database as seen by the request: queries on tenant data
+// only reach the organization resolved by middleware.Tenant
+func tenantDB(c *fiber.Ctx) *gorm.DB {
+	return database.DB.WithContext(c.UserContext())
+}
+
+// organizationRole is the caller's role in the organization of the request
+func organizationRole(c *fiber.Ctx) string {
+	role, _ := c.Locals("organization_role").(string)
+	return role
+}
+
+// defaultMember returns the organization a user acts in after login, or a
+// zero Member for users who belong to none yet
+func defaultMember(user model.User) (tenant.Member, error) {
+	member, err := tenant.Resolve(database.DB, user, 0)
+	if errors.Is(err, tenant.ErrNotMember) {
+		return tenant.Member{}, nil
+	}
+	return member, err
+}
+
+// JoinSignupOrganization makes a new user a member of the organization named
+// by SIGNUP_ORGANIZATION (a slug, "default" by default). With "none", or if
+// the organization does not exist, new users wait until an admin adds them.
+func JoinSignupOrganization(tx *gorm.DB, user model.User) error {
+	slug := config.Get().SignupOrganization
+	if slug == "" {
+		slug = database.DefaultOrganizationSlug
+	}
+	if slug == "none" {
+		return nil
+	}
+
+	var organization model.Organization
+	if err := tx.Where("slug = ?", slug).Limit(1).Find(&organization).Error; err != nil {
+		return err
+	}
+	if organization.ID == 0 {
+		return nil
+	}
+	return tx.Create(&model.Membership{UserID: user.ID, OrganizationID: organization.ID, Role: model.RoleUser}).Error
+}
+
+// organizationAdmin reports whether the current user administers the
+// organization, as its admin member or as an admin of the deployment
+func organizationAdmin(c *fiber.Ctx, organizationID uint) (bool, error) {
+	var user model.User
+	if err := database.DB.First(&user, getUserIDFromToken(c)).Error; err != nil {
+		return false, err
+	}
+	member, err := tenant.Resolve(database.DB, user, organizationID)
+	if errors.Is(err, tenant.ErrNotMember) {
+		return false, nil
+	}
+	return err == nil && member.Role == model.RoleAdmin, err
+}
+
+// ----------  ORGANIZATIONS --------------------------------------------
+
+// GetOrganizations lists the organizations the current user can act in, with
+// their role there; admins see every organization
+func GetOrganizations(c *fiber.Ctx) error {
+	db := database.DB
+	var user model.User
+	if err := db.First(&user, getUserIDFromToken(c)).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).
+			JSON(fiber.Map{"status": "error", "message": "user not found", "data": nil})
+	}
+
+	type organizationRow struct {
+		model.Organization
+		Role string `json:"role"`
+	}
+	query := db.Model(&model.Organization{}).Order("organizations.name")
+	if user.Role == model.RoleAdmin {
+		query = query.Select("organizations.*, ? AS role", model.RoleAdmin)
+	} else {
+		query = query.Select("organizations.*, memberships.role").
+			Joins("JOIN memberships ON memberships.organization_id = organizations.id AND memberships.user_id = ?", user.ID)
+	}
+
+	var organizations []organizationRow
+	if err := query.Scan(&organizations).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot fetch organizations", "data": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "organizations", "data": organizations})
+}
+
+// CreateOrganization creates an organization with the default permissions and
+// no inventory
+func CreateOrganization(c *fiber.Ctx) error {
+	var input organizationInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "invalid json payload", "data": err.Error()})
+	}
+	if err := validator.New().Struct(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "validation failed", "data": err.Error()})
+	}
+	if !slugPattern.MatchString(input.Slug) {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "validation failed", "data": "slug may only contain lowercase letters, digits and dashes"})
+	}
+
+	db := database.DB
+	var taken int64
+	if err := db.Model(&model.Organization{}).Where("slug = ?", input.Slug).Count(&taken).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot create organization", "data": err.Error()})
+	}
+	if taken > 0 {
+		return c.Status(fiber.StatusConflict).
+			JSON(fiber.Map{"status": "error", "message": "slug already taken", "data": nil})
+	}
+
+	// The organization starts with the default grants, so that its members can
+	// work before an admin narrows them
+	organization := model.Organization{Name: input.Name, Slug: input.Slug}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&organization).Error; err != nil {
+			return err
+		}
+		grants := database.DefaultPermissions(organization.ID)
+		return tx.WithContext(tenant.WithOrganization(c.UserContext(), organization.ID)).Create(&grants).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot create organization", "data": err.Error()})
+	}
+
+	return c.Status(fiber.StatusCreated).
+		JSON(fiber.Map{"status": "success", "message": "organization created", "data": organization})
+}
+
+// UpdateOrganization renames an organization
+func UpdateOrganization(c *fiber.Ctx) error {
+	var input organizationInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "invalid json payload", "data": err.Error()})
+	}
+	if err := validator.New().Struct(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "validation failed", "data": err.Error()})
+	}
+	if !slugPattern.MatchString(input.Slug) {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "validation failed", "data": "slug may only contain lowercase letters, digits and dashes"})
+	}
+
+	db := database.DB
+	var organization model.Organization
+	if err := db.First(&organization, c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).
+			JSON(fiber.Map{"status": "error", "message": "organization not found", "data": nil})
+	}
+	var taken int64
+	if err := db.Model(&model.Organization{}).Where("slug = ? AND id <> ?", input.Slug, organization.ID).
+		Count(&taken).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot update organization", "data": err.Error()})
+	}
+	if taken > 0 {
+		return c.Status(fiber.StatusConflict).
+			JSON(fiber.Map{"status": "error", "message": "slug already taken", "data": nil})
+	}
+
+	organization.Name = input.Name
+	organization.Slug = input.Slug
+	if err := db.Save(&organization).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot update organization", "data": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "organization updated", "data": organization})
+}
+
+// SwitchOrganization issues a session token acting in another organization
+func SwitchOrganization(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id < 1 {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "invalid organization id", "data": nil})
+	}
+
+	db := database.DB
+	var user model.User
+	if err := db.First(&user, getUserIDFromToken(c)).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).
+			JSON(fiber.Map{"status": "error", "message": "user not found", "data": nil})
+	}
+	member, err := tenant.Resolve(db, user, uint(id))
+	if errors.Is(err, tenant.ErrNotMember) {
+		return c.Status(fiber.StatusForbidden).
+			JSON(fiber.Map{"status": "error", "message": "Organization membership required", "data": nil})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot switch organization", "data": err.Error()})
+	}
+
+	t, err := issueToken(user, member.OrganizationID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot switch organization", "data": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "organization switched", "data": fiber.Map{
+		"token":        t,
+		"organization": member,
+	}})
+}
+
+// ----------  MEMBERS --------------------------------------------------
+
+// GetOrganizationMembers lists the members of an organization by username
+func GetOrganizationMembers(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id < 1 {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "invalid organization id", "data": nil})
+	}
+	if ok, err := organizationAdmin(c, uint(id)); err != nil || !ok {
+		return c.Status(fiber.StatusForbidden).
+			JSON(fiber.Map{"status": "error", "message": "Organization admin role required", "data": nil})
+	}
+
+	var members []model.Membership
+	if err := database.DB.Preload("User", publicUserFields).
+		Joins("JOIN users ON users.id = memberships.user_id AND users.deleted_at IS NULL").
+		Where("memberships.organization_id = ?", id).Order("users.username").Find(&members).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot fetch members", "data": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "organization members", "data": members})
+}
+
+// SetOrganizationMember adds a user to an organization or changes their role
+func SetOrganizationMember(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id < 1 {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "invalid organization id", "data": nil})
+	}
+	userID, err := c.ParamsInt("user_id")
+	if err != nil || userID < 1 {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "invalid user id", "data": nil})
+	}
+	if ok, err := organizationAdmin(c, uint(id)); err != nil || !ok {
+		return c.Status(fiber.StatusForbidden).
+			JSON(fiber.Map{"status": "error", "message": "Organization admin role required", "data": nil})
+	}
+
+	var input membershipInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "invalid json payload", "data": err.Error()})
+	}
+	if err := validator.New().Struct(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "validation failed", "data": err.Error()})
+	}
+
+	db := database.DB
+	if err := db.First(&model.User{}, userID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).
+			JSON(fiber.Map{"status": "error", "message": "user not found", "data": nil})
+	}
+
+	var membership model.Membership
+	if err := db.Where(model.Membership{UserID: uint(userID), OrganizationID: uint(id)}).
+		Assign(model.Membership{Role: input.Role}).FirstOrCreate(&membership).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot save member", "data": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "member saved", "data": membership})
+}
+
+// DeleteOrganizationMember removes a user from an organization; their tokens
+// stop working there at once
+func DeleteOrganizationMember(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id < 1 {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "invalid organization id", "data": nil})
+	}
+	if ok, err := organizationAdmin(c, uint(id)); err != nil || !ok {
+		return c.Status(fiber.StatusForbidden).
+			JSON(fiber.Map{"status": "error", "message": "Organization admin role required", "data": nil})
+	}
+
+	result := database.DB.Where("organization_id = ? AND user_id = ?", id, c.Params("user_id")).
+		Delete(&model.Membership{})
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot remove member", "data": result.Error.Error()})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).
+			JSON(fiber.Map{"status": "error", "message": "member not found", "data": nil})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "member removed", "data": nil})
+}
@@ -0,0 +1,258 @@
+package handler
+
+import (
+	"errors"
+
+	"app/access"
+	"app/database"
+	"app/model"
+	"app/repository"
+	"app/service"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// ---------------------------------------------------------------------
+//  ENDPOINTS (mounted in router/router.go)
+//  GET    /api/permissions/me      – effective permissions of the current user (JWT protected)
+//  GET    /api/permissions         – grants, optionally ?user_id= or ?role= (organization admin)
+//  POST   /api/permissions         – grant an action to a user or role (organization admin)
+//  DELETE /api/permissions/:id     – remove a grant (organization admin)
+//  GET    /api/resource-groups     – list resource groups (JWT protected)
+//  POST   /api/resource-groups     – create a resource group (organization admin)
+//  PUT    /api/resource-groups/:id – rename or describe a group (organization admin)
+//  DELETE /api/resource-groups/:id – delete a group; its resources become ungrouped (organization admin)
+//  Grants and groups belong to the organization of the request.
+// ---------------------------------------------------------------------
+
+var errPermissionDenied = service.ErrPermissionDenied
+
+// permissionGrantInput describes the JSON payload for granting permissions
+type permissionGrantInput struct {
+	UserID  *uint  `json:"user_id,omitempty" validate:"required_without=Role,excluded_with=Role"`
+	Role    string `json:"role,omitempty" validate:"omitempty,oneof=user admin"`
+	Action  string `json:"action" validate:"required,oneof=read create update delete adjust"`
+	GroupID *uint  `json:"group_id,omitempty"` // Nil for all resources
+}
+
+// resourceGroupInput describes the JSON payload for resource groups
+type resourceGroupInput struct {
+	Name        string `json:"name" validate:"required,min=2,max=100"`
+	Description string `json:"description"`
+}
+
+// requestGrants loads the permissions of the user making the request in the
+// organization of the request
+func requestGrants(c *fiber.Ctx, permissions *service.PermissionService) (access.Grants, error) {
+	return permissions.Grants(c.UserContext(), getUserIDFromToken(c), organizationRole(c))
+}
+
+// callerGrants loads the permissions of the caller for the handlers that work
+// on the database directly
+func callerGrants(c *fiber.Ctx) (access.Grants, error) {
+	return requestGrants(c, service.NewPermissionService(repository.NewGorm(database.DB)))
+}
+
+// checkResourceAction returns gorm.ErrRecordNotFound for a resource the grants
+// do not let the caller read and errPermissionDenied when they may read it but
+// not take the action
+func checkResourceAction(grants access.Grants, resource model.Resource, action string) error {
+	if !grants.Allows(model.ActionRead, resource.GroupID) {
+		return gorm.ErrRecordNotFound
+	}
+	if !grants.Allows(action, resource.GroupID) {
+		return errPermissionDenied
+	}
+	return nil
+}
+
+// permissionDenied answers a request the caller's grants do not allow
+func permissionDenied(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusForbidden).
+		JSON(fiber.Map{"status": "error", "message": "permission denied", "data": nil})
+}
+
+// grantsError answers a request whose caller's grants could not be loaded
+func grantsError(c *fiber.Ctx, err error) error {
+	return c.Status(fiber.StatusInternalServerError).
+		JSON(fiber.Map{"status": "error", "message": "cannot load permissions", "data": err.Error()})
+}
+
+// ----------  PERMISSIONS ----------------------------------------------
+
+// GetMyPermissions returns, for each action, "all" or the ids of the groups
+// the current user may act on
+func GetMyPermissions(c *fiber.Ctx) error {
+	grants, err := callerGrants(c)
+	if err != nil {
+		return grantsError(c, err)
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "effective permissions", "data": grants.Summary()})
+}
+
+// GetPermissionGrants lists grants
+func GetPermissionGrants(c *fiber.Ctx) error {
+	query := tenantDB(c).Preload("Group").Order("id")
+	if userID := c.QueryInt("user_id"); userID > 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	if role := c.Query("role"); role != "" {
+		query = query.Where("user_id IS NULL AND role = ?", role)
+	}
+
+	var grants []model.PermissionGrant
+	if err := query.Find(&grants).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot fetch permissions", "data": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "permission grants", "data": grants})
+}
+
+// CreatePermissionGrant grants an action to a user or to every user with a role
+func CreatePermissionGrant(c *fiber.Ctx) error {
+	var input permissionGrantInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "invalid json payload", "data": err.Error()})
+	}
+	if err := validator.New().Struct(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "validation failed", "data": err.Error()})
+	}
+
+	// Users are granted actions in the organizations they are members of
+	db := tenantDB(c)
+	if input.UserID != nil {
+		if err := db.Where("user_id = ? AND organization_id = ?", *input.UserID, c.Locals("organization_id")).
+			First(&model.Membership{}).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).
+				JSON(fiber.Map{"status": "error", "message": "user not found", "data": nil})
+		}
+	}
+	if input.GroupID != nil {
+		if err := db.First(&model.ResourceGroup{}, *input.GroupID).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).
+				JSON(fiber.Map{"status": "error", "message": "resource group not found", "data": nil})
+		}
+	}
+
+	grant := model.PermissionGrant{UserID: input.UserID, Role: input.Role, Action: input.Action, GroupID: input.GroupID}
+	if err := db.Create(&grant).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot create permission", "data": err.Error()})
+	}
+
+	return c.Status(fiber.StatusCreated).
+		JSON(fiber.Map{"status": "success", "message": "permission granted", "data": grant})
+}
+
+// DeletePermissionGrant removes a grant
+func DeletePermissionGrant(c *fiber.Ctx) error {
+	result := tenantDB(c).Delete(&model.PermissionGrant{}, c.Params("id"))
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot delete permission", "data": result.Error.Error()})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).
+			JSON(fiber.Map{"status": "error", "message": "permission not found", "data": nil})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "permission removed", "data": nil})
+}
+
+// ----------  RESOURCE GROUPS ------------------------------------------
+
+// GetResourceGroups lists resource groups by name
+func GetResourceGroups(c *fiber.Ctx) error {
+	var groups []model.ResourceGroup
+	if err := tenantDB(c).Order("name").Find(&groups).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot fetch resource groups", "data": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "resource groups", "data": groups})
+}
+
+// CreateResourceGroup creates a resource group
+func CreateResourceGroup(c *fiber.Ctx) error {
+	var input resourceGroupInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "invalid json payload", "data": err.Error()})
+	}
+	if err := validator.New().Struct(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "validation failed", "data": err.Error()})
+	}
+
+	group := model.ResourceGroup{Name: input.Name, Description: input.Description}
+	if err := tenantDB(c).Create(&group).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot create resource group", "data": err.Error()})
+	}
+
+	return c.Status(fiber.StatusCreated).
+		JSON(fiber.Map{"status": "success", "message": "resource group created", "data": group})
+}
+
+// UpdateResourceGroup renames or describes a resource group
+func UpdateResourceGroup(c *fiber.Ctx) error {
+	var input resourceGroupInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "invalid json payload", "data": err.Error()})
+	}
+	if err := validator.New().Struct(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "validation failed", "data": err.Error()})
+	}
+
+	db := tenantDB(c)
+	var group model.ResourceGroup
+	if err := db.First(&group, c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).
+			JSON(fiber.Map{"status": "error", "message": "resource group not found", "data": nil})
+	}
+	group.Name = input.Name
+	group.Description = input.Description
+	if err := db.Save(&group).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot update resource group", "data": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "resource group updated", "data": group})
+}
+
+// DeleteResourceGroup deletes a group with its grants; its resources stay,
+// without a group
+func DeleteResourceGroup(c *fiber.Ctx) error {
+	var group model.ResourceGroup
+	err := tenantDB(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&group, c.Params("id")).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&model.Resource{}).Where("group_id = ?", group.ID).
+			Update("group_id", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("group_id = ?", group.ID).Delete(&model.PermissionGrant{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&group).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).
+			JSON(fiber.Map{"status": "error", "message": "resource group not found", "data": nil})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot delete resource group", "data": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "resource group deleted", "data": nil})
+}
@@ -0,0 +1,540 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"app/access"
+	"app/database"
+	"app/inventory"
+	"app/model"
+	"app/report"
+	"app/tenant"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// ---------------------------------------------------------------------
+//  ENDPOINTS (mounted in router/router.go)
+//  GET /api/reports/valuation – stock value ?as_of=&method=fifo|average&currency=
+//  GET /api/reports/cogs      – cost of goods consumed ?from=&to=&method=&currency=
+//  GET /api/reports/forecast  – consumption forecast ?resource_id=&window=&alpha=&method=ma|ses
+//                               &lead_time=&coverage=&safety_stock=
+//  GET  /api/reports/inventory              – stock report ?format=html|pdf&from=&to=
+//  GET  /api/reports/generated              – list stored reports
+//  POST /api/reports/generated              – generate and store a report now
+//  GET  /api/reports/generated/:id/download – download a stored report
+//  POST   /api/reports/generated/:id/token  – replace the access token (admin)
+//  DELETE /api/reports/generated/:id/token  – revoke the access token (admin)
+//  GET  /api/shared-reports/:token          – download a stored report without logging in
+// ---------------------------------------------------------------------
+
+// sharedReport is a stored report with its access token, which is only sent
+// to the user who generates the report and to admins who replace it
+type sharedReport struct {
+	model.GeneratedReport
+	AccessToken *string `json:"access_token"`
+}
+
+// valuationRow is the valuation of one resource with its display fields
+type valuationRow struct {
+	inventory.Valuation
+	Name string `json:"name"`
+	Unit string `json:"unit"`
+}
+
+// parseUpperBound parses an exclusive upper time bound; a plain date includes the whole day
+func parseUpperBound(s string) (time.Time, error) {
+	t, err := parseDate(s)
+	if err != nil {
+		return t, err
+	}
+	if len(s) == len("2006-01-02") {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// reportCurrency reads the ?currency= parameter, defaulting to the base currency
+func reportCurrency(c *fiber.Ctx) string {
+	if currency := strings.ToUpper(c.Query("currency")); currency != "" {
+		return currency
+	}
+	return baseCurrency()
+}
+
+// valuate replays the history of every resource the grants let the caller
+// read created before the given time, converting costs to the reporting
+// currency at each transaction date
+func valuate(db *gorm.DB, grants access.Grants, method inventory.Method, currency string, from, before time.Time) ([]valuationRow, error) {
+	movements, err := inventory.LoadMovements(db, before)
+	if err != nil {
+		return nil, err
+	}
+
+	rates, err := inventory.LoadRates(db, baseCurrency())
+	if err != nil {
+		return nil, err
+	}
+	convert := rates.To(currency)
+
+	var resources []model.Resource
+	if err := grants.Filter(db.Unscoped(), model.ActionRead).Where("created_at < ?", before).Order("id").Find(&resources).Error; err != nil {
+		return nil, err
+	}
+
+	rows := make([]valuationRow, 0, len(resources))
+	for _, r := range resources {
+		list := movements[r.ID]
+		if len(list) == 0 {
+			// Never changed since it was created without history
+			list = []inventory.Movement{{ResourceID: r.ID, Action: "OPENING", Time: r.CreatedAt, After: r.Quantity}}
+		}
+
+		var price *inventory.Price
+		if r.Price != nil {
+			price = &inventory.Price{Amount: *r.Price, Currency: r.Currency}
+		}
+
+		v, err := inventory.Value(method, list, price, from, before, convert)
+		if err != nil {
+			return nil, fmt.Errorf("resource '%s': %w", r.Name, err)
+		}
+		v.ResourceID = r.ID
+		rows = append(rows, valuationRow{Valuation: v, Name: r.Name, Unit: r.Unit})
+	}
+	return rows, nil
+}
+
+// ----------  VALUATION ------------------------------------------------
+
+// GetValuationReport values the stock of every resource as of a date
+func GetValuationReport(c *fiber.Ctx) error {
+	method, ok := inventory.ParseMethod(c.Query("method"))
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "method must be fifo or average", "data": nil})
+	}
+
+	asOf := time.Now()
+	if s := c.Query("as_of"); s != "" {
+		t, err := parseUpperBound(s)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).
+				JSON(fiber.Map{"status": "error", "message": "invalid as_of", "data": err.Error()})
+		}
+		asOf = t
+	}
+
+	grants, err := callerGrants(c)
+	if err != nil {
+		return grantsError(c, err)
+	}
+
+	currency := reportCurrency(c)
+	rows, err := valuate(tenantDB(c), grants, method, currency, asOf, asOf)
+	if errors.Is(err, inventory.ErrNoRate) {
+		return c.Status(fiber.StatusUnprocessableEntity).
+			JSON(fiber.Map{"status": "error", "message": "missing exchange rate", "data": err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot compute valuation", "data": err.Error()})
+	}
+
+	stock := make([]valuationRow, 0, len(rows))
+	total := 0.0
+	for _, row := range rows {
+		if row.Quantity == 0 {
+			continue
+		}
+		total += row.Value
+		stock = append(stock, row)
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "inventory valuation", "data": fiber.Map{
+		"as_of":       asOf,
+		"method":      method,
+		"currency":    currency,
+		"total_value": inventory.Round2(total),
+		"resources":   stock,
+	}})
+}
+
+// ----------  COST OF GOODS --------------------------------------------
+
+// GetCOGSReport sums the cost of goods consumed over a period (default: last 30 days)
+func GetCOGSReport(c *fiber.Ctx) error {
+	method, ok := inventory.ParseMethod(c.Query("method"))
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "method must be fifo or average", "data": nil})
+	}
+
+	to := time.Now()
+	if s := c.Query("to"); s != "" {
+		t, err := parseUpperBound(s)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).
+				JSON(fiber.Map{"status": "error", "message": "invalid to", "data": err.Error()})
+		}
+		to = t
+	}
+	from := to.AddDate(0, 0, -30)
+	if s := c.Query("from"); s != "" {
+		t, err := parseDate(s)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).
+				JSON(fiber.Map{"status": "error", "message": "invalid from", "data": err.Error()})
+		}
+		from = t
+	}
+	if !from.Before(to) {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "from must be before to", "data": nil})
+	}
+
+	grants, err := callerGrants(c)
+	if err != nil {
+		return grantsError(c, err)
+	}
+
+	currency := reportCurrency(c)
+	rows, err := valuate(tenantDB(c), grants, method, currency, from, to)
+	if errors.Is(err, inventory.ErrNoRate) {
+		return c.Status(fiber.StatusUnprocessableEntity).
+			JSON(fiber.Map{"status": "error", "message": "missing exchange rate", "data": err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot compute cost of goods", "data": err.Error()})
+	}
+
+	consumed := make([]valuationRow, 0)
+	total := 0.0
+	for _, row := range rows {
+		if row.ConsumedQuantity == 0 {
+			continue
+		}
+		total += row.ConsumedCost
+		consumed = append(consumed, row)
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "cost of goods consumed", "data": fiber.Map{
+		"from":       from,
+		"to":         to,
+		"method":     method,
+		"currency":   currency,
+		"total_cost": inventory.Round2(total),
+		"resources":  consumed,
+	}})
+}
+
+// ----------  FORECAST -------------------------------------------------
+
+// forecastRow is the forecast of one resource with its display fields
+type forecastRow struct {
+	inventory.Forecast
+	Name string `json:"name"`
+	Unit string `json:"unit"`
+}
+
+// queryInt reads a non-negative integer query parameter with a default
+func queryInt(c *fiber.Ctx, key string, def int) (int, error) {
+	s := c.Query(key)
+	if s == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer", key)
+	}
+	return n, nil
+}
+
+// parseForecastParams reads the forecast tuning parameters from the query string
+func parseForecastParams(c *fiber.Ctx) (inventory.ForecastParams, error) {
+	p := inventory.ForecastParams{Alpha: 0.3, Method: c.Query("method", inventory.ExponentialSmoothing)}
+	var err error
+	if p.Window, err = queryInt(c, "window", 30); err != nil {
+		return p, err
+	}
+	if p.LeadTime, err = queryInt(c, "lead_time", 7); err != nil {
+		return p, err
+	}
+	if p.Coverage, err = queryInt(c, "coverage", 30); err != nil {
+		return p, err
+	}
+	if p.SafetyStock, err = queryInt(c, "safety_stock", 0); err != nil {
+		return p, err
+	}
+	if s := c.Query("alpha"); s != "" {
+		if p.Alpha, err = strconv.ParseFloat(s, 64); err != nil || p.Alpha <= 0 || p.Alpha > 1 {
+			return p, fmt.Errorf("alpha must be in (0, 1]")
+		}
+	}
+	if p.Window < 1 || p.Window > 365 {
+		return p, fmt.Errorf("window must be between 1 and 365 days")
+	}
+	if p.Method != inventory.MovingAverage && p.Method != inventory.ExponentialSmoothing {
+		return p, fmt.Errorf("method must be ma or ses")
+	}
+	return p, nil
+}
+
+// GetForecastReport forecasts daily consumption, stock-out date and reorder
+// quantity for one resource (?resource_id=) or the whole catalog
+func GetForecastReport(c *fiber.Ctx) error {
+	params, err := parseForecastParams(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	grants, err := callerGrants(c)
+	if err != nil {
+		return grantsError(c, err)
+	}
+
+	db := tenantDB(c)
+	query := grants.Filter(db, model.ActionRead).Order("id")
+	if id := c.Query("resource_id"); id != "" {
+		if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+			return c.Status(fiber.StatusBadRequest).
+				JSON(fiber.Map{"status": "error", "message": "invalid resource id", "data": err.Error()})
+		}
+		query = query.Where("id = ?", id)
+	}
+
+	var resources []model.Resource
+	if err := query.Find(&resources).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot fetch resources", "data": err.Error()})
+	}
+	if len(resources) == 0 && c.Query("resource_id") != "" {
+		return c.Status(fiber.StatusNotFound).
+			JSON(fiber.Map{"status": "error", "message": "resource not found", "data": nil})
+	}
+
+	now := time.Now()
+	movements, err := inventory.LoadMovements(db, now)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot fetch resource history", "data": err.Error()})
+	}
+
+	rows := make([]forecastRow, 0, len(resources))
+	for _, r := range resources {
+		f := inventory.Project(r.ID, r.Quantity, movements[r.ID], now, params)
+		rows = append(rows, forecastRow{Forecast: f, Name: r.Name, Unit: r.Unit})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "consumption forecast", "data": fiber.Map{
+		"generated_at": now,
+		"window":       params.Window,
+		"method":       params.Method,
+		"alpha":        params.Alpha,
+		"lead_time":    params.LeadTime,
+		"coverage":     params.Coverage,
+		"safety_stock": params.SafetyStock,
+		"resources":    rows,
+	}})
+}
+
+// ----------  INVENTORY REPORT -----------------------------------------
+
+// reportRequest reads ?format= and the ?from=&to= period (default: the last 7 days)
+func reportRequest(c *fiber.Ctx) (string, time.Time, time.Time, error) {
+	format := c.Query("format", report.FormatHTML)
+	if format != report.FormatHTML && format != report.FormatPDF {
+		return "", time.Time{}, time.Time{}, fmt.Errorf("format must be html or pdf")
+	}
+
+	to := time.Now()
+	if s := c.Query("to"); s != "" {
+		t, err := parseUpperBound(s)
+		if err != nil {
+			return "", time.Time{}, time.Time{}, fmt.Errorf("invalid to: %w", err)
+		}
+		to = t
+	}
+	from := to.AddDate(0, 0, -7)
+	if s := c.Query("from"); s != "" {
+		t, err := parseDate(s)
+		if err != nil {
+			return "", time.Time{}, time.Time{}, fmt.Errorf("invalid from: %w", err)
+		}
+		from = t
+	}
+	if !from.Before(to) {
+		return "", time.Time{}, time.Time{}, fmt.Errorf("from must be before to")
+	}
+	return format, from, to, nil
+}
+
+// sendReport writes report content, as an attachment for PDF
+func sendReport(c *fiber.Ctx, content []byte, format string, from, to time.Time) error {
+	if format == report.FormatPDF {
+		c.Set(fiber.HeaderContentType, "application/pdf")
+		c.Attachment(fmt.Sprintf("inventory-%s-%s.pdf", from.Format("2006-01-02"), to.Format("2006-01-02")))
+	} else {
+		c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	}
+	return c.Send(content)
+}
+
+// GetInventoryReport renders current stock, movements and low-stock items
+func GetInventoryReport(c *fiber.Ctx) error {
+	format, from, to, err := reportRequest(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	grants, err := callerGrants(c)
+	if err != nil {
+		return grantsError(c, err)
+	}
+	readable := func(db *gorm.DB, table string) *gorm.DB {
+		if table == "resources" {
+			return grants.Filter(db, model.ActionRead)
+		}
+		return grants.FilterRelated(db, table, model.ActionRead)
+	}
+
+	data, err := report.Collect(tenantDB(c), readable, from, to, report.LowStockThreshold())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot collect report data", "data": err.Error()})
+	}
+	content, _, err := report.Render(data, format)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot render report", "data": err.Error()})
+	}
+
+	return sendReport(c, content, format, from, to.Add(-time.Nanosecond))
+}
+
+// Stored reports cover every resource, whoever generated them, so they are for
+// callers who may read every resource
+
+// GetGeneratedReports lists stored reports, newest first, without their content
+func GetGeneratedReports(c *fiber.Ctx) error {
+	grants, err := callerGrants(c)
+	if err != nil {
+		return grantsError(c, err)
+	}
+	if !grants.AllowsEvery(model.ActionRead) {
+		return permissionDenied(c)
+	}
+
+	var reports []model.GeneratedReport
+	if err := tenantDB(c).Omit("content").Order("created_at desc").Find(&reports).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot fetch reports", "data": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "generated reports", "data": reports})
+}
+
+// CreateGeneratedReport generates a report for the requested period and stores it
+func CreateGeneratedReport(c *fiber.Ctx) error {
+	format, from, to, err := reportRequest(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+
+	grants, err := callerGrants(c)
+	if err != nil {
+		return grantsError(c, err)
+	}
+	if !grants.AllowsEvery(model.ActionRead) {
+		return permissionDenied(c)
+	}
+
+	generated, err := report.Generate(tenantDB(c), format, from, to)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot generate report", "data": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "report generated",
+		"data": sharedReport{GeneratedReport: generated, AccessToken: generated.AccessToken}})
+}
+
+// RotateReportToken replaces the access token of a stored report, so that
+// links shared with the old one stop working
+func RotateReportToken(c *fiber.Ctx) error {
+	var generated model.GeneratedReport
+	if err := tenantDB(c).Omit("content").First(&generated, c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).
+			JSON(fiber.Map{"status": "error", "message": "report not found", "data": nil})
+	}
+
+	token, err := report.NewAccessToken()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot create access token", "data": err.Error()})
+	}
+	if err := tenantDB(c).Model(&generated).Update("access_token", token).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot update report", "data": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "access token replaced",
+		"data": sharedReport{GeneratedReport: generated, AccessToken: &token}})
+}
+
+// RevokeReportToken removes the access token of a stored report; it can then
+// only be downloaded by logged in users
+func RevokeReportToken(c *fiber.Ctx) error {
+	var generated model.GeneratedReport
+	if err := tenantDB(c).Omit("content").First(&generated, c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).
+			JSON(fiber.Map{"status": "error", "message": "report not found", "data": nil})
+	}
+	if err := tenantDB(c).Model(&generated).Update("access_token", nil).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot update report", "data": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "access token revoked", "data": nil})
+}
+
+// DownloadGeneratedReport sends a stored report
+func DownloadGeneratedReport(c *fiber.Ctx) error {
+	grants, err := callerGrants(c)
+	if err != nil {
+		return grantsError(c, err)
+	}
+	if !grants.AllowsEvery(model.ActionRead) {
+		return permissionDenied(c)
+	}
+
+	var generated model.GeneratedReport
+	if err := tenantDB(c).First(&generated, c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).
+			JSON(fiber.Map{"status": "error", "message": "report not found", "data": nil})
+	}
+
+	return sendReport(c, generated.Content, generated.Format, generated.PeriodFrom, generated.PeriodTo.Add(-time.Nanosecond))
+}
+
+// DownloadSharedReport sends a stored report identified by its access token
+func DownloadSharedReport(c *fiber.Ctx) error {
+	var generated model.GeneratedReport
+	// The token is the only credential, so the report may belong to any organization
+	db := database.DB.WithContext(tenant.AllOrganizations(c.UserContext()))
+	if err := db.Where("access_token = ?", c.Params("token")).First(&generated).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).
+			JSON(fiber.Map{"status": "error", "message": "report not found", "data": nil})
+	}
+
+	return sendReport(c, generated.Content, generated.Format, generated.PeriodFrom, generated.PeriodTo.Add(-time.Nanosecond))
+}
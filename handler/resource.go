@@ -1,74 +1,79 @@
 package handler
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
-	"time"
 
-	"app/database"
+	"app/access"
 	"app/model"
+	"app/service"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
 )
 
 // ---------------------------------------------------------------------
 //  ENDPOINTS (mounted in router/router.go)
-//  GET  /api/resource           – list all resources
-//  GET  /api/resource/:id       – get one resource
+//  GET  /api/resource           – list the resources the caller may read (JWT protected)
+//  GET  /api/resource/:id       – get one resource (JWT protected)
 //  POST /api/resource           – create a new resource (JWT protected)
 //  PUT  /api/resource/:id       – update resource (JWT protected)
 //  DELETE /api/resource/:id     – delete resource (JWT protected)
-//  GET  /api/resource/:id/history – get resource change history
+//  GET  /api/resource/:id/history – get resource change history (JWT protected)
 // ---------------------------------------------------------------------
 
+// ResourceHandler serves the resource endpoints through the resource service
+type ResourceHandler struct {
+	resources   *service.ResourceService
+	permissions *service.PermissionService
+}
+
+// NewResourceHandler returns the resource handler of the services
+func NewResourceHandler(services *service.Services) *ResourceHandler {
+	return &ResourceHandler{resources: services.Resources, permissions: services.Permissions}
+}
+
 // resourceCreateInput describes the JSON payload for creating resources
 type resourceCreateInput struct {
-	Name        string `json:"name" validate:"required,min=2,max=100"`
-	Description string `json:"description"`
-	Unit        string `json:"unit" validate:"required,min=1,max=20"`
-	Quantity    int    `json:"quantity" validate:"min=0"`
+	Name        string   `json:"name" validate:"required,min=2,max=100"`
+	Description string   `json:"description"`
+	Unit        string   `json:"unit" validate:"required,min=1,max=20"`
+	Quantity    int      `json:"quantity" validate:"min=0"`
+	Serialized  bool     `json:"serialized"`
+	UnitCost    *float64 `json:"unit_cost,omitempty" validate:"omitempty,min=0"` // Cost per unit of the initial quantity
+	Price       *float64 `json:"price,omitempty" validate:"omitempty,min=0"`
+	Currency    string   `json:"currency" validate:"omitempty,iso4217"` // Currency of price and unit cost
+	GroupID     *uint    `json:"group_id,omitempty"`                    // Resource group, nil for none
 }
 
 // resourceUpdateInput describes the JSON payload for updating resources
 type resourceUpdateInput struct {
-	Name        *string `json:"name,omitempty" validate:"omitempty,min=2,max=100"`
-	Description *string `json:"description,omitempty"`
-	Unit        *string `json:"unit,omitempty" validate:"omitempty,min=1,max=20"`
-	Quantity    *int    `json:"quantity,omitempty" validate:"omitempty,min=0"`
+	Name        *string  `json:"name,omitempty" validate:"omitempty,min=2,max=100"`
+	Description *string  `json:"description,omitempty"`
+	Unit        *string  `json:"unit,omitempty" validate:"omitempty,min=1,max=20"`
+	Quantity    *int     `json:"quantity,omitempty" validate:"omitempty,min=0"`
+	Serialized  *bool    `json:"serialized,omitempty"`
+	UnitCost    *float64 `json:"unit_cost,omitempty" validate:"omitempty,min=0"` // Cost per unit when the quantity increases
+	Price       *float64 `json:"price,omitempty" validate:"omitempty,min=0"`
+	Currency    *string  `json:"currency,omitempty" validate:"omitempty,iso4217"` // Currency of price and unit cost
+	GroupID     *uint    `json:"group_id,omitempty"`                              // New resource group, 0 for none (admin)
 }
 
-// logResourceChange logs changes to the resource history table
-func logResourceChange(resourceID uint, action string, userID uint, oldData, newData interface{}, description string) error {
-	db := database.DB
-
-	history := model.ResourceHistory{
-		ResourceID:  resourceID,
-		Action:      action,
-		UserID:      userID,
-		Timestamp:   time.Now(),
-		Description: description,
-	}
-
-	if oldData != nil {
-		oldJSON, err := json.Marshal(oldData)
-		if err != nil {
-			return err
-		}
-		history.OldData = string(oldJSON)
-	}
-
-	if newData != nil {
-		newJSON, err := json.Marshal(newData)
-		if err != nil {
-			return err
-		}
-		history.NewData = string(newJSON)
+// logResourceChange logs changes to the resource history table using the given transaction
+func logResourceChange(tx *gorm.DB, resourceID uint, action string, by actor, oldData, newData interface{}, description string) error {
+	history, err := buildHistory(resourceID, action, by, oldData, newData, description)
+	if err != nil {
+		return err
 	}
+	return tx.Create(&history).Error
+}
 
-	return db.Create(&history).Error
+// buildHistory prepares a history entry so callers can fill extra references before saving it
+func buildHistory(resourceID uint, action string, by actor, oldData, newData interface{}, description string) (model.ResourceHistory, error) {
+	return service.NewHistory(resourceID, action, by, oldData, newData, description)
 }
 
 // getUserIDFromToken extracts user ID from JWT token
@@ -82,14 +87,80 @@ func getUserIDFromToken(c *fiber.Ctx) uint {
 	return uint(userIDFloat)
 }
 
+// findReadableResource loads a resource and the grants of the caller.
+// Resources the caller may not read are reported as not found so that their
+// existence is not revealed.
+func findReadableResource(c *fiber.Ctx, db *gorm.DB, id string) (model.Resource, access.Grants, error) {
+	var resource model.Resource
+	grants, err := callerGrants(c)
+	if err != nil {
+		return resource, grants, err
+	}
+	if err := db.First(&resource, id).Error; err != nil {
+		return resource, grants, err
+	}
+	if !grants.Allows(model.ActionRead, resource.GroupID) {
+		return resource, grants, gorm.ErrRecordNotFound
+	}
+	return resource, grants, nil
+}
+
+// resourceLookupError answers a failed findReadableResource
+func resourceLookupError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, service.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).
+			JSON(fiber.Map{"status": "error", "message": "resource not found", "data": nil})
+	}
+	return c.Status(fiber.StatusInternalServerError).
+		JSON(fiber.Map{"status": "error", "message": "cannot fetch resource", "data": err.Error()})
+}
+
+// resourceChangeError answers a failed change of a resource
+func resourceChangeError(c *fiber.Ctx, err error, message string) error {
+	switch {
+	case errors.Is(err, service.ErrNotFound):
+		return resourceLookupError(c, err)
+	case errors.Is(err, service.ErrPermissionDenied):
+		return permissionDenied(c)
+	case errors.Is(err, service.ErrGroupNotFound), errors.Is(err, service.ErrSerializedQuantity):
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+	return c.Status(fiber.StatusInternalServerError).
+		JSON(fiber.Map{"status": "error", "message": message, "data": err.Error()})
+}
+
+// invalidResourceID answers a route whose resource id is not numeric
+func invalidResourceID(c *fiber.Ctx, err error) error {
+	return c.Status(fiber.StatusBadRequest).
+		JSON(fiber.Map{"status": "error", "message": "invalid resource id", "data": err.Error()})
+}
+
+// actor is who makes a change: a user, possibly through one of their API keys
+type actor = service.Actor
+
+// getActor reads the user and API key of the request from its token
+func getActor(c *fiber.Ctx) actor {
+	by := actor{UserID: getUserIDFromToken(c)}
+	claims := c.Locals("user").(*jwt.Token).Claims.(jwt.MapClaims)
+	if id, ok := claims["api_key_id"].(float64); ok {
+		apiKeyID := uint(id)
+		by.APIKeyID = &apiKeyID
+	}
+	return by
+}
+
 // ----------  GET ALL --------------------------------------------------
 
-// GetAllResources returns a list of all resources
-func GetAllResources(c *fiber.Ctx) error {
-	db := database.DB
-	var resources []model.Resource
+// GetAll returns the resources the caller may read
+func (h *ResourceHandler) GetAll(c *fiber.Ctx) error {
+	grants, err := requestGrants(c, h.permissions)
+	if err != nil {
+		return grantsError(c, err)
+	}
 
-	if err := db.Find(&resources).Error; err != nil {
+	resources, err := h.resources.List(c.UserContext(), grants)
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).
 			JSON(fiber.Map{"status": "error", "message": "cannot fetch resources", "data": err.Error()})
 	}
@@ -99,15 +170,20 @@ func GetAllResources(c *fiber.Ctx) error {
 
 // ----------  GET ONE --------------------------------------------------
 
-// GetResource returns a single resource by its numeric ID
-func GetResource(c *fiber.Ctx) error {
-	id := c.Params("id")
-	db := database.DB
-	var resource model.Resource
+// Get returns a single resource by its numeric ID
+func (h *ResourceHandler) Get(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return invalidResourceID(c, err)
+	}
+	grants, err := requestGrants(c, h.permissions)
+	if err != nil {
+		return grantsError(c, err)
+	}
 
-	if err := db.First(&resource, id).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).
-			JSON(fiber.Map{"status": "error", "message": "resource not found", "data": nil})
+	resource, err := h.resources.Get(c.UserContext(), grants, uint(id))
+	if err != nil {
+		return resourceLookupError(c, err)
 	}
 
 	return c.JSON(fiber.Map{"status": "success", "message": "resource found", "data": resource})
@@ -115,8 +191,8 @@ func GetResource(c *fiber.Ctx) error {
 
 // ----------  CREATE ---------------------------------------------------
 
-// CreateResource creates a new resource and logs the action
-func CreateResource(c *fiber.Ctx) error {
+// Create creates a new resource and logs the action
+func (h *ResourceHandler) Create(c *fiber.Ctx) error {
 	var input resourceCreateInput
 	if err := c.BodyParser(&input); err != nil {
 		return c.Status(fiber.StatusBadRequest).
@@ -128,56 +204,27 @@ func CreateResource(c *fiber.Ctx) error {
 			JSON(fiber.Map{"status": "error", "message": "validation failed", "data": err.Error()})
 	}
 
-	// Create the resource
-	resource := model.Resource{
-		Name:        input.Name,
-		Description: input.Description,
-		Unit:        input.Unit,
-		Quantity:    input.Quantity,
-	}
-
-	db := database.DB
-
-	// Begin transaction
-	tx := db.Begin()
-
-	// Log to history first
-	userID := getUserIDFromToken(c)
-	if err := tx.Create(&resource).Error; err != nil {
-		tx.Rollback()
-		return c.Status(fiber.StatusInternalServerError).
-			JSON(fiber.Map{"status": "error", "message": "cannot create resource", "data": err.Error()})
-	}
-
-	// Log the change
-	history := model.ResourceHistory{
-		ResourceID:  resource.ID,
-		Action:      "CREATE",
-		UserID:      userID,
-		Timestamp:   time.Now(),
-		Description: fmt.Sprintf("Resource '%s' created", resource.Name),
+	grants, err := requestGrants(c, h.permissions)
+	if err != nil {
+		return grantsError(c, err)
 	}
 
-	newJSON, _ := json.Marshal(resource)
-	history.NewData = string(newJSON)
-
-	if err := tx.Create(&history).Error; err != nil {
-		tx.Rollback()
-		return c.Status(fiber.StatusInternalServerError).
-			JSON(fiber.Map{"status": "error", "message": "cannot log resource change", "data": err.Error()})
+	resource, err := h.resources.Create(c.UserContext(), grants, getActor(c), service.NewResource(input))
+	if err != nil {
+		return resourceChangeError(c, err, "cannot create resource")
 	}
 
-	// Commit transaction
-	tx.Commit()
-
 	return c.JSON(fiber.Map{"status": "success", "message": "resource created", "data": resource})
 }
 
 // ----------  UPDATE ---------------------------------------------------
 
-// UpdateResource partially updates a resource and logs the action
-func UpdateResource(c *fiber.Ctx) error {
-	id := c.Params("id")
+// Update partially updates a resource and logs the action
+func (h *ResourceHandler) Update(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return invalidResourceID(c, err)
+	}
 	var input resourceUpdateInput
 	if err := c.BodyParser(&input); err != nil {
 		return c.Status(fiber.StatusBadRequest).
@@ -189,142 +236,57 @@ func UpdateResource(c *fiber.Ctx) error {
 			JSON(fiber.Map{"status": "error", "message": "validation failed", "data": err.Error()})
 	}
 
-	db := database.DB
-	var resource model.Resource
-
-	// Get the current resource data
-	if err := db.First(&resource, id).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).
-			JSON(fiber.Map{"status": "error", "message": "resource not found", "data": nil})
+	grants, err := requestGrants(c, h.permissions)
+	if err != nil {
+		return grantsError(c, err)
 	}
 
-	// Store old data for history
-	oldResource := resource
-
-	// Apply updates
-	if input.Name != nil {
-		resource.Name = *input.Name
-	}
-	if input.Description != nil {
-		resource.Description = *input.Description
-	}
-	if input.Unit != nil {
-		resource.Unit = *input.Unit
+	resource, err := h.resources.Update(c.UserContext(), grants, getActor(c), uint(id), service.ResourceChanges(input))
+	if err != nil {
+		return resourceChangeError(c, err, "cannot update resource")
 	}
-	if input.Quantity != nil {
-		resource.Quantity = *input.Quantity
-	}
-
-	// Begin transaction
-	tx := db.Begin()
-
-	// Log to history first
-	userID := getUserIDFromToken(c)
-	history := model.ResourceHistory{
-		ResourceID:  resource.ID,
-		Action:      "UPDATE",
-		UserID:      userID,
-		Timestamp:   time.Now(),
-		Description: fmt.Sprintf("Resource '%s' updated", resource.Name),
-	}
-
-	oldJSON, _ := json.Marshal(oldResource)
-	newJSON, _ := json.Marshal(resource)
-	history.OldData = string(oldJSON)
-	history.NewData = string(newJSON)
-
-	if err := tx.Create(&history).Error; err != nil {
-		tx.Rollback()
-		return c.Status(fiber.StatusInternalServerError).
-			JSON(fiber.Map{"status": "error", "message": "cannot log resource change", "data": err.Error()})
-	}
-
-	// Update the resource
-	if err := tx.Save(&resource).Error; err != nil {
-		tx.Rollback()
-		return c.Status(fiber.StatusInternalServerError).
-			JSON(fiber.Map{"status": "error", "message": "cannot update resource", "data": err.Error()})
-	}
-
-	// Commit transaction
-	tx.Commit()
 
 	return c.JSON(fiber.Map{"status": "success", "message": "resource updated", "data": resource})
 }
 
 // ----------  DELETE ---------------------------------------------------
 
-// DeleteResource removes a resource and logs the action
-func DeleteResource(c *fiber.Ctx) error {
-	id := c.Params("id")
-
-	// Basic sanity check – id must be numeric
-	if _, err := strconv.ParseUint(id, 10, 64); err != nil {
-		return c.Status(fiber.StatusBadRequest).
-			JSON(fiber.Map{"status": "error", "message": "invalid resource id", "data": err.Error()})
-	}
-
-	db := database.DB
-	var resource model.Resource
-
-	// Get the resource data before deletion
-	if err := db.First(&resource, id).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).
-			JSON(fiber.Map{"status": "error", "message": "resource not found", "data": nil})
+// Delete removes a resource and logs the action
+func (h *ResourceHandler) Delete(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return invalidResourceID(c, err)
 	}
-
-	// Begin transaction
-	tx := db.Begin()
-
-	// Log to history first
-	userID := getUserIDFromToken(c)
-	history := model.ResourceHistory{
-		ResourceID:  resource.ID,
-		Action:      "DELETE",
-		UserID:      userID,
-		Timestamp:   time.Now(),
-		Description: fmt.Sprintf("Resource '%s' deleted", resource.Name),
+	grants, err := requestGrants(c, h.permissions)
+	if err != nil {
+		return grantsError(c, err)
 	}
 
-	oldJSON, _ := json.Marshal(resource)
-	history.OldData = string(oldJSON)
-
-	if err := tx.Create(&history).Error; err != nil {
-		tx.Rollback()
-		return c.Status(fiber.StatusInternalServerError).
-			JSON(fiber.Map{"status": "error", "message": "cannot log resource change", "data": err.Error()})
+	if err := h.resources.Delete(c.UserContext(), grants, getActor(c), uint(id)); err != nil {
+		return resourceChangeError(c, err, "cannot delete resource")
 	}
 
-	// Delete the resource
-	if err := tx.Delete(&resource).Error; err != nil {
-		tx.Rollback()
-		return c.Status(fiber.StatusInternalServerError).
-			JSON(fiber.Map{"status": "error", "message": "cannot delete resource", "data": err.Error()})
-	}
-
-	// Commit transaction
-	tx.Commit()
-
-	return c.JSON(fiber.Map{"status": "success", "message": fmt.Sprintf("resource %s deleted", id), "data": nil})
+	return c.JSON(fiber.Map{"status": "success", "message": fmt.Sprintf("resource %d deleted", id), "data": nil})
 }
 
 // ----------  HISTORY --------------------------------------------------
 
-// GetResourceHistory returns the change history for a specific resource
-func GetResourceHistory(c *fiber.Ctx) error {
-	id := c.Params("id")
-	db := database.DB
-
-	// Check if resource exists
-	var resource model.Resource
-	if err := db.First(&resource, id).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).
-			JSON(fiber.Map{"status": "error", "message": "resource not found", "data": nil})
+// History returns the change history for a specific resource
+func (h *ResourceHandler) History(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return invalidResourceID(c, err)
+	}
+	grants, err := requestGrants(c, h.permissions)
+	if err != nil {
+		return grantsError(c, err)
 	}
 
-	// Get history records for this resource
-	var history []model.ResourceHistory
-	if err := db.Preload("User").Where("resource_id = ?", id).Order("timestamp desc").Find(&history).Error; err != nil {
+	history, err := h.resources.History(c.UserContext(), grants, uint(id))
+	if errors.Is(err, service.ErrNotFound) {
+		return resourceLookupError(c, err)
+	}
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).
 			JSON(fiber.Map{"status": "error", "message": "cannot fetch resource history", "data": err.Error()})
 	}
@@ -0,0 +1,402 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"app/model"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ---------------------------------------------------------------------
+//  ENDPOINTS (mounted in router/router.go)
+//  GET   /api/resource/:id/items – list items of a serialized resource (JWT protected)
+//  POST  /api/resource/:id/items – add an item (JWT protected)
+//  GET   /api/items              – search items by ?serial=, ?status=, ?assignee_id= (JWT protected)
+//  GET   /api/items/:id          – get one item (JWT protected)
+//  PATCH /api/items/:id          – change status or assignee (JWT protected)
+//  GET   /api/items/:id/history  – history of one item (JWT protected)
+// ---------------------------------------------------------------------
+
+var (
+	// errAssigneeRequired is returned when an item is assigned to nobody
+	errAssigneeRequired = errors.New("assigned items need an assignee_id")
+	// errAssigneeNotFound is returned when the assignee is not a member of the organization
+	errAssigneeNotFound = errors.New("assignee not found")
+	// errSerialNumberTaken is returned when the organization already has an item with the serial number
+	errSerialNumberTaken = errors.New("serial number already registered")
+)
+
+// serialItemCreateInput describes the JSON payload for adding an item
+type serialItemCreateInput struct {
+	SerialNumber    string `json:"serial_number" validate:"required,min=1,max=100"`
+	InventoryNumber string `json:"inventory_number" validate:"max=100"`
+	Status          string `json:"status" validate:"omitempty,oneof=in_stock in_repair"`
+	Note            string `json:"note"`
+}
+
+// serialItemUpdateInput describes the JSON payload for changing an item
+type serialItemUpdateInput struct {
+	Status          *string `json:"status,omitempty" validate:"omitempty,oneof=in_stock assigned in_repair retired"`
+	AssigneeID      *uint   `json:"assignee_id,omitempty"`
+	InventoryNumber *string `json:"inventory_number,omitempty" validate:"omitempty,max=100"`
+	Note            *string `json:"note,omitempty"`
+}
+
+// publicUserFields keeps password hashes out of preloaded users
+func publicUserFields(db *gorm.DB) *gorm.DB {
+	return db.Select("id", "created_at", "updated_at", "username", "email", "names")
+}
+
+// syncSerializedQuantity sets the resource quantity to the number of its in-stock items
+func syncSerializedQuantity(tx *gorm.DB, resource *model.Resource) error {
+	var count int64
+	if err := tx.Model(&model.SerialItem{}).
+		Where("resource_id = ? AND status = ?", resource.ID, model.SerialStatusInStock).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	resource.Quantity = int(count)
+	return tx.Model(resource).Update("quantity", resource.Quantity).Error
+}
+
+// ----------  LIST -----------------------------------------------------
+
+// GetResourceItems returns the items of a serialized resource
+func GetResourceItems(c *fiber.Ctx) error {
+	db := tenantDB(c)
+
+	resource, _, err := findReadableResource(c, db, c.Params("id"))
+	if err != nil {
+		return resourceLookupError(c, err)
+	}
+
+	var items []model.SerialItem
+	if err := db.Preload("Assignee", publicUserFields).
+		Where("resource_id = ?", resource.ID).Order("serial_number").Find(&items).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot fetch items", "data": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "resource items", "data": items})
+}
+
+// GetItems searches items across all serialized resources
+func GetItems(c *fiber.Ctx) error {
+	grants, err := callerGrants(c)
+	if err != nil {
+		return grantsError(c, err)
+	}
+	db := grants.FilterRelated(tenantDB(c), "serial_items", model.ActionRead).
+		Preload("Resource").Preload("Assignee", publicUserFields)
+
+	if serial := c.Query("serial"); serial != "" {
+		db = db.Where("serial_number = ? OR inventory_number = ?", serial, serial)
+	}
+	if status := c.Query("status"); status != "" {
+		if !model.ValidSerialStatus(status) {
+			return c.Status(fiber.StatusBadRequest).
+				JSON(fiber.Map{"status": "error", "message": "unknown item status", "data": nil})
+		}
+		db = db.Where("status = ?", status)
+	}
+	if assignee := c.Query("assignee_id"); assignee != "" {
+		if _, err := strconv.ParseUint(assignee, 10, 64); err != nil {
+			return c.Status(fiber.StatusBadRequest).
+				JSON(fiber.Map{"status": "error", "message": "invalid assignee id", "data": err.Error()})
+		}
+		db = db.Where("assignee_id = ?", assignee)
+	}
+
+	var items []model.SerialItem
+	if err := db.Order("serial_number").Find(&items).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot fetch items", "data": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "items list", "data": items})
+}
+
+// GetItem returns a single item with its resource and assignee
+func GetItem(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var item model.SerialItem
+
+	grants, err := callerGrants(c)
+	if err != nil {
+		return grantsError(c, err)
+	}
+	db := grants.FilterRelated(tenantDB(c), "serial_items", model.ActionRead)
+	if err := db.Preload("Resource").Preload("Assignee", publicUserFields).First(&item, id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).
+			JSON(fiber.Map{"status": "error", "message": "item not found", "data": nil})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "item found", "data": item})
+}
+
+// ----------  CREATE ---------------------------------------------------
+
+// CreateResourceItem adds a unit to a serialized resource
+func CreateResourceItem(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var input serialItemCreateInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "invalid json payload", "data": err.Error()})
+	}
+
+	if err := validator.New().Struct(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "validation failed", "data": err.Error()})
+	}
+
+	item := model.SerialItem{
+		SerialNumber:    input.SerialNumber,
+		InventoryNumber: input.InventoryNumber,
+		Status:          input.Status,
+		Note:            input.Note,
+	}
+	if item.Status == "" {
+		item.Status = model.SerialStatusInStock
+	}
+
+	grants, err := callerGrants(c)
+	if err != nil {
+		return grantsError(c, err)
+	}
+
+	by := getActor(c)
+	var resource model.Resource
+	err = tenantDB(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&resource, id).Error; err != nil {
+			return err
+		}
+		if err := checkResourceAction(grants, resource, model.ActionAdjust); err != nil {
+			return err
+		}
+		if !resource.Serialized {
+			return errSerializedResource
+		}
+		oldResource := resource
+
+		taken, err := serialNumberTaken(tx, item.SerialNumber)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return errSerialNumberTaken
+		}
+		item.ResourceID = resource.ID
+		if err := tx.Create(&item).Error; err != nil {
+			return err
+		}
+		if err := syncSerializedQuantity(tx, &resource); err != nil {
+			return err
+		}
+
+		history, err := buildHistory(resource.ID, "ITEM_ADD", by, oldResource, resource,
+			fmt.Sprintf("Item '%s' added to resource '%s'", item.SerialNumber, resource.Name))
+		if err != nil {
+			return err
+		}
+		history.SerialItemID = &item.ID
+		return tx.Create(&history).Error
+	})
+	// An item added by a concurrent request makes the insert fail on the unique
+	// index of serial numbers
+	if err != nil && !errors.Is(err, errSerialNumberTaken) {
+		if taken, _ := serialNumberTaken(tenantDB(c), item.SerialNumber); taken {
+			err = errSerialNumberTaken
+		}
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).
+			JSON(fiber.Map{"status": "error", "message": "resource not found", "data": nil})
+	}
+	if errors.Is(err, errSerialNumberTaken) {
+		return c.Status(fiber.StatusConflict).
+			JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+	if errors.Is(err, errPermissionDenied) {
+		return permissionDenied(c)
+	}
+	if errors.Is(err, errSerializedResource) {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "resource is not serialized", "data": nil})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot create item", "data": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "item created", "data": item})
+}
+
+// serialNumberTaken reports whether an item of the organization of db, deleted
+// or not, has the serial number
+func serialNumberTaken(db *gorm.DB, serialNumber string) (bool, error) {
+	var count int64
+	err := db.Unscoped().Model(&model.SerialItem{}).Where("serial_number = ?", serialNumber).Count(&count).Error
+	return count > 0, err
+}
+
+// ----------  UPDATE ---------------------------------------------------
+
+// applyItemChanges sets the changes of the input on an item read in the
+// transaction. Setting an assignee implies the assigned status; any other
+// status clears the assignee.
+func applyItemChanges(tx *gorm.DB, item *model.SerialItem, input serialItemUpdateInput, organizationID interface{}) error {
+	if input.Status != nil {
+		item.Status = *input.Status
+	} else if input.AssigneeID != nil {
+		item.Status = model.SerialStatusAssigned
+	}
+	if item.Status == model.SerialStatusAssigned {
+		if input.AssigneeID != nil {
+			item.AssigneeID = input.AssigneeID
+		}
+		if item.AssigneeID == nil {
+			return errAssigneeRequired
+		}
+		// Items are only assigned to members of the organization they belong to
+		var assignee model.User
+		if err := tx.Joins("JOIN memberships ON memberships.user_id = users.id AND memberships.organization_id = ?", organizationID).
+			First(&assignee, *item.AssigneeID).Error; err != nil {
+			return errAssigneeNotFound
+		}
+	} else {
+		item.AssigneeID = nil
+	}
+	if input.InventoryNumber != nil {
+		item.InventoryNumber = *input.InventoryNumber
+	}
+	if input.Note != nil {
+		item.Note = *input.Note
+	}
+	return nil
+}
+
+// itemChange names the history action of an item update after what changed:
+// a new assignee, a new status, or only the inventory number or note
+func itemChange(old, item model.SerialItem) (action, description string) {
+	switch {
+	case item.Status == model.SerialStatusAssigned && (old.AssigneeID == nil || *old.AssigneeID != *item.AssigneeID):
+		return "ASSIGN", fmt.Sprintf("Item '%s' assigned to user %d", item.SerialNumber, *item.AssigneeID)
+	case item.Status != old.Status:
+		return "ITEM_STATUS", fmt.Sprintf("Item '%s' status changed from %s to %s", item.SerialNumber, old.Status, item.Status)
+	default:
+		return "ITEM_UPDATE", fmt.Sprintf("Item '%s' details changed", item.SerialNumber)
+	}
+}
+
+// UpdateItem changes the status or assignee of an item and logs the change.
+// The item is read again under lock so that concurrent changes are applied
+// one after the other.
+func UpdateItem(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var input serialItemUpdateInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "invalid json payload", "data": err.Error()})
+	}
+
+	if err := validator.New().Struct(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "validation failed", "data": err.Error()})
+	}
+
+	db := tenantDB(c)
+	grants, err := callerGrants(c)
+	if err != nil {
+		return grantsError(c, err)
+	}
+
+	by := getActor(c)
+	var item model.SerialItem
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// The resource is locked before its item, as everywhere items change
+		if err := tx.First(&item, id).Error; err != nil {
+			return err
+		}
+		var resource model.Resource
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&resource, item.ResourceID).Error; err != nil {
+			return err
+		}
+		if err := checkResourceAction(grants, resource, model.ActionAdjust); err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&item, item.ID).Error; err != nil {
+			return err
+		}
+		oldItem := item
+		oldResource := resource
+
+		if err := applyItemChanges(tx, &item, input, c.Locals("organization_id")); err != nil {
+			return err
+		}
+		if err := tx.Save(&item).Error; err != nil {
+			return err
+		}
+		if err := syncSerializedQuantity(tx, &resource); err != nil {
+			return err
+		}
+
+		action, description := itemChange(oldItem, item)
+		history, err := buildHistory(resource.ID, action, by, oldResource, resource, description)
+		if err != nil {
+			return err
+		}
+		history.SerialItemID = &item.ID
+		return tx.Create(&history).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).
+			JSON(fiber.Map{"status": "error", "message": "item not found", "data": nil})
+	}
+	if errors.Is(err, errAssigneeRequired) || errors.Is(err, errAssigneeNotFound) {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+	if errors.Is(err, errPermissionDenied) {
+		return permissionDenied(c)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot update item", "data": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "item updated", "data": item})
+}
+
+// ----------  HISTORY --------------------------------------------------
+
+// GetItemHistory returns the history entries that concern one item
+func GetItemHistory(c *fiber.Ctx) error {
+	id := c.Params("id")
+	db := tenantDB(c)
+	grants, err := callerGrants(c)
+	if err != nil {
+		return grantsError(c, err)
+	}
+
+	var item model.SerialItem
+	if err := grants.FilterRelated(db, "serial_items", model.ActionRead).First(&item, id).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).
+			JSON(fiber.Map{"status": "error", "message": "item not found", "data": nil})
+	}
+
+	var history []model.ResourceHistory
+	if err := db.Preload("User", publicUserFields).Where("serial_item_id = ?", item.ID).
+		Order("timestamp desc").Find(&history).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot fetch item history", "data": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "item history", "data": history})
+}
@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"app/database"
+	"app/model"
+	"app/signing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ---------------------------------------------------------------------
+//  ENDPOINTS (mounted in router/router.go)
+//  GET  /.well-known/jwks.json      – public keys that verify session tokens
+//  GET  /api/signing-keys           – all keys with their rotation state (admin)
+//  POST /api/signing-keys/rotate    – replace the signing key now (admin)
+// ---------------------------------------------------------------------
+
+// JWKS publishes the keys of non-retired signing keys
+func JWKS(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(signing.PublicKeys())
+}
+
+// GetSigningKeys lists signing keys, newest first
+func GetSigningKeys(c *fiber.Ctx) error {
+	var keys []model.SigningKey
+	if err := database.DB.Order("created_at desc").Find(&keys).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot fetch signing keys", "data": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "signing keys", "data": keys})
+}
+
+// RotateSigningKey replaces the signing key; the previous key keeps verifying
+// for the overlap window
+func RotateSigningKey(c *fiber.Ctx) error {
+	key, err := signing.Rotate(database.DB)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot rotate signing key", "data": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "signing key rotated", "data": key})
+}
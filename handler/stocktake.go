@@ -0,0 +1,403 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"app/access"
+	"app/model"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ---------------------------------------------------------------------
+//  ENDPOINTS (mounted in router/router.go)
+//  GET  /api/stocktakes              – list sessions (JWT protected)
+//  POST /api/stocktakes              – open a session (JWT protected)
+//  GET  /api/stocktakes/:id          – get a session with its lines and counts (JWT protected)
+//  PUT  /api/stocktakes/:id/counts   – record counted quantities (JWT protected)
+//  GET  /api/stocktakes/:id/variance – variance report (JWT protected)
+//  POST /api/stocktakes/:id/post     – apply all adjustments (JWT protected)
+//  POST /api/stocktakes/:id/cancel   – cancel the session (JWT protected)
+// ---------------------------------------------------------------------
+
+var (
+	// errStocktakeNotOpen is returned when a closed session is changed
+	errStocktakeNotOpen = errors.New("stocktake is not open")
+	// errStocktakeAlreadyOpen is returned when a second session is opened
+	errStocktakeAlreadyOpen = errors.New("another stocktake is already open")
+	// errUnknownStocktakeLine is returned when a count targets a resource outside the session
+	errUnknownStocktakeLine = errors.New("resource is not part of the stocktake")
+)
+
+// stocktakeOpenInput describes the JSON payload for opening a session
+type stocktakeOpenInput struct {
+	Note string `json:"note"`
+}
+
+// stocktakeCountInput describes the JSON payload for recording counts
+type stocktakeCountInput struct {
+	Counts []struct {
+		ResourceID uint `json:"resource_id" validate:"required"`
+		Quantity   int  `json:"quantity" validate:"min=0"`
+	} `json:"counts" validate:"required,min=1,dive"`
+}
+
+// stocktakeVariance is one row of the variance report
+type stocktakeVariance struct {
+	ResourceID       uint   `json:"resource_id"`
+	Name             string `json:"name"`
+	Unit             string `json:"unit"`
+	ExpectedQuantity int    `json:"expected_quantity"`
+	CountedQuantity  *int   `json:"counted_quantity"`
+	Variance         *int   `json:"variance"`
+	Counters         []uint `json:"counters"`
+}
+
+// loadStocktake fetches a session with its lines, resources and counts; only
+// the lines of resources the grants let the caller read are loaded
+func loadStocktake(db *gorm.DB, grants access.Grants, id string) (model.Stocktake, error) {
+	var stocktake model.Stocktake
+	err := db.Preload("Lines", func(db *gorm.DB) *gorm.DB {
+		return grants.FilterRelated(db, "stocktake_lines", model.ActionRead).Order("resource_id")
+	}).
+		Preload("Lines.Resource", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+		Preload("Lines.Counts").
+		First(&stocktake, id).Error
+	return stocktake, err
+}
+
+// stocktakeError maps the errors of session changes to responses
+func stocktakeError(c *fiber.Ctx, err error, message string) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.Status(fiber.StatusNotFound).
+			JSON(fiber.Map{"status": "error", "message": "stocktake not found", "data": nil})
+	case errors.Is(err, errStocktakeNotOpen):
+		return c.Status(fiber.StatusConflict).
+			JSON(fiber.Map{"status": "error", "message": "stocktake is not open", "data": nil})
+	case errors.Is(err, errPermissionDenied):
+		return permissionDenied(c)
+	case errors.Is(err, errUnknownStocktakeLine):
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+	return c.Status(fiber.StatusInternalServerError).
+		JSON(fiber.Map{"status": "error", "message": message, "data": err.Error()})
+}
+
+// lockOpenStocktake locks a session row and checks that it is still open
+func lockOpenStocktake(tx *gorm.DB, id string) (model.Stocktake, error) {
+	var stocktake model.Stocktake
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&stocktake, id).Error; err != nil {
+		return stocktake, err
+	}
+	if stocktake.Status != model.StocktakeStatusOpen {
+		return stocktake, errStocktakeNotOpen
+	}
+	return stocktake, nil
+}
+
+// ----------  LIST / GET -----------------------------------------------
+
+// GetStocktakes returns all sessions, newest first
+func GetStocktakes(c *fiber.Ctx) error {
+	var stocktakes []model.Stocktake
+	if err := tenantDB(c).Order("created_at desc").Find(&stocktakes).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot fetch stocktakes", "data": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "stocktakes list", "data": stocktakes})
+}
+
+// GetStocktake returns a session with its lines and counts
+func GetStocktake(c *fiber.Ctx) error {
+	grants, err := callerGrants(c)
+	if err != nil {
+		return grantsError(c, err)
+	}
+	stocktake, err := loadStocktake(tenantDB(c), grants, c.Params("id"))
+	if err != nil {
+		return stocktakeError(c, err, "cannot fetch stocktake")
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "stocktake found", "data": stocktake})
+}
+
+// ----------  OPEN -----------------------------------------------------
+
+// OpenStocktake starts a session and snapshots the expected quantity of every
+// non-serialized resource the caller may read. Only one session per
+// organization may be open at a time.
+func OpenStocktake(c *fiber.Ctx) error {
+	var input stocktakeOpenInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "invalid json payload", "data": err.Error()})
+	}
+	grants, err := callerGrants(c)
+	if err != nil {
+		return grantsError(c, err)
+	}
+
+	stocktake := model.Stocktake{
+		Status:     model.StocktakeStatusOpen,
+		Note:       input.Note,
+		OpenedByID: getUserIDFromToken(c),
+	}
+	err = tenantDB(c).Transaction(func(tx *gorm.DB) error {
+		open, err := stocktakeOpen(tx)
+		if err != nil {
+			return err
+		}
+		if open {
+			return errStocktakeAlreadyOpen
+		}
+
+		var resources []model.Resource
+		if err := grants.Filter(tx, model.ActionRead).Where("serialized = ?", false).Order("id").Find(&resources).Error; err != nil {
+			return err
+		}
+		for _, r := range resources {
+			stocktake.Lines = append(stocktake.Lines, model.StocktakeLine{
+				ResourceID:       r.ID,
+				ExpectedQuantity: r.Quantity,
+			})
+		}
+		return tx.Create(&stocktake).Error
+	})
+	// A session opened by a concurrent request makes the insert fail on the
+	// unique index of open sessions
+	if err != nil && !errors.Is(err, errStocktakeAlreadyOpen) {
+		if open, _ := stocktakeOpen(tenantDB(c)); open {
+			err = errStocktakeAlreadyOpen
+		}
+	}
+	if errors.Is(err, errStocktakeAlreadyOpen) {
+		return c.Status(fiber.StatusConflict).
+			JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot open stocktake", "data": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "stocktake opened", "data": stocktake})
+}
+
+// stocktakeOpen tells whether a session is open
+func stocktakeOpen(db *gorm.DB) (bool, error) {
+	var open int64
+	err := db.Model(&model.Stocktake{}).Where("status = ?", model.StocktakeStatusOpen).Count(&open).Error
+	return open > 0, err
+}
+
+// ----------  COUNT ----------------------------------------------------
+
+// RecordStocktakeCounts stores the quantities counted by the current user.
+// Counting a resource again replaces the user's previous count for it.
+// Resources the user may not read are not part of the session for them.
+func RecordStocktakeCounts(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var input stocktakeCountInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "invalid json payload", "data": err.Error()})
+	}
+
+	if err := validator.New().Struct(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "validation failed", "data": err.Error()})
+	}
+
+	grants, err := callerGrants(c)
+	if err != nil {
+		return grantsError(c, err)
+	}
+
+	userID := getUserIDFromToken(c)
+	err = tenantDB(c).Transaction(func(tx *gorm.DB) error {
+		stocktake, err := lockOpenStocktake(tx, id)
+		if err != nil {
+			return err
+		}
+
+		for _, in := range input.Counts {
+			var line model.StocktakeLine
+			if err := grants.FilterRelated(tx, "stocktake_lines", model.ActionRead).Where("stocktake_id = ? AND resource_id = ?", stocktake.ID, in.ResourceID).
+				First(&line).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return fmt.Errorf("%w: %d", errUnknownStocktakeLine, in.ResourceID)
+				}
+				return err
+			}
+
+			count := model.StocktakeCount{StocktakeLineID: line.ID, UserID: userID, Quantity: in.Quantity}
+			if err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "stocktake_line_id"}, {Name: "user_id"}},
+				DoUpdates: clause.AssignmentColumns([]string{"quantity", "updated_at"}),
+			}).Create(&count).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return stocktakeError(c, err, "cannot record counts")
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": fmt.Sprintf("%d counts recorded", len(input.Counts)), "data": nil})
+}
+
+// ----------  VARIANCE -------------------------------------------------
+
+// GetStocktakeVariance compares expected and counted quantities.
+// Lines nobody has counted yet have a null counted quantity and variance.
+func GetStocktakeVariance(c *fiber.Ctx) error {
+	grants, err := callerGrants(c)
+	if err != nil {
+		return grantsError(c, err)
+	}
+	stocktake, err := loadStocktake(tenantDB(c), grants, c.Params("id"))
+	if err != nil {
+		return stocktakeError(c, err, "cannot fetch stocktake")
+	}
+
+	report := make([]stocktakeVariance, 0, len(stocktake.Lines))
+	counted, discrepancies := 0, 0
+	for _, line := range stocktake.Lines {
+		row := stocktakeVariance{
+			ResourceID:       line.ResourceID,
+			Name:             line.Resource.Name,
+			Unit:             line.Resource.Unit,
+			ExpectedQuantity: line.ExpectedQuantity,
+			CountedQuantity:  line.CountedQuantity(),
+			Counters:         []uint{},
+		}
+		for _, count := range line.Counts {
+			row.Counters = append(row.Counters, count.UserID)
+		}
+		if row.CountedQuantity != nil {
+			variance := *row.CountedQuantity - line.ExpectedQuantity
+			row.Variance = &variance
+			counted++
+			if variance != 0 {
+				discrepancies++
+			}
+		}
+		report = append(report, row)
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "stocktake variance", "data": fiber.Map{
+		"stocktake_id":  stocktake.ID,
+		"status":        stocktake.Status,
+		"lines":         len(report),
+		"counted":       counted,
+		"discrepancies": discrepancies,
+		"variances":     report,
+	}})
+}
+
+// ----------  POST -----------------------------------------------------
+
+// PostStocktake applies the variance of every counted line to the current stock
+// in one transaction and writes an ADJUST history entry per changed resource.
+// Movements made while the session was open are kept: only the difference
+// between the counted and the snapshotted quantity is applied. The caller must
+// be allowed to adjust every resource the session changes.
+func PostStocktake(c *fiber.Ctx) error {
+	id := c.Params("id")
+	by := getActor(c)
+	adjusted := 0
+	grants, err := callerGrants(c)
+	if err != nil {
+		return grantsError(c, err)
+	}
+
+	err = tenantDB(c).Transaction(func(tx *gorm.DB) error {
+		stocktake, err := lockOpenStocktake(tx, id)
+		if err != nil {
+			return err
+		}
+		var lines []model.StocktakeLine
+		if err := tx.Preload("Counts").Where("stocktake_id = ?", stocktake.ID).Order("resource_id").Find(&lines).Error; err != nil {
+			return err
+		}
+
+		for _, line := range lines {
+			counted := line.CountedQuantity()
+			if counted == nil || *counted == line.ExpectedQuantity {
+				continue
+			}
+
+			var resource model.Resource
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&resource, line.ResourceID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					continue // deleted since the session was opened
+				}
+				return err
+			}
+			if err := checkResourceAction(grants, resource, model.ActionAdjust); err != nil {
+				return errPermissionDenied
+			}
+			oldResource := resource
+
+			variance := *counted - line.ExpectedQuantity
+			resource.Quantity = max(resource.Quantity+variance, 0)
+			if err := tx.Save(&resource).Error; err != nil {
+				return err
+			}
+
+			history, err := buildHistory(resource.ID, "ADJUST", by, oldResource, resource,
+				fmt.Sprintf("Stocktake #%d: counted %d %s of '%s', expected %d", stocktake.ID, *counted, resource.Unit, resource.Name, line.ExpectedQuantity))
+			if err != nil {
+				return err
+			}
+			history.StocktakeID = &stocktake.ID
+			if err := tx.Create(&history).Error; err != nil {
+				return err
+			}
+			adjusted++
+		}
+
+		now := time.Now()
+		return tx.Model(&model.Stocktake{}).Where("id = ?", stocktake.ID).Updates(map[string]interface{}{
+			"status":       model.StocktakeStatusPosted,
+			"posted_by_id": by.UserID,
+			"closed_at":    now,
+		}).Error
+	})
+	if err != nil {
+		return stocktakeError(c, err, "cannot post stocktake")
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": fmt.Sprintf("stocktake posted, %d resources adjusted", adjusted), "data": fiber.Map{"adjusted": adjusted}})
+}
+
+// CancelStocktake closes a session without touching the stock
+func CancelStocktake(c *fiber.Ctx) error {
+	id := c.Params("id")
+	userID := getUserIDFromToken(c)
+
+	err := tenantDB(c).Transaction(func(tx *gorm.DB) error {
+		stocktake, err := lockOpenStocktake(tx, id)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&stocktake).Updates(map[string]interface{}{
+			"status":       model.StocktakeStatusCancelled,
+			"posted_by_id": userID,
+			"closed_at":    time.Now(),
+		}).Error
+	})
+	if err != nil {
+		return stocktakeError(c, err, "cannot cancel stocktake")
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "stocktake cancelled", "data": nil})
+}
@@ -0,0 +1,566 @@
+package handler
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"app/config"
+	"app/database"
+	"app/model"
+	"app/totp"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ---------------------------------------------------------------------
+//  ENDPOINTS (mounted in router/router.go)
+//  POST /api/auth/2fa/verify         – finish login with a TOTP or recovery code
+//  POST /api/auth/2fa/enroll         – start enrollment required by the role policy
+//  POST /api/auth/2fa/enroll/confirm – finish that enrollment and log in
+//  POST /api/2fa/setup               – start enrollment (JWT protected)
+//  POST /api/2fa/enable              – confirm the first code (JWT protected)
+//  POST /api/2fa/disable             – turn two-factor off (JWT protected)
+//  POST /api/2fa/recovery-codes      – replace the recovery codes (JWT protected)
+//  GET  /api/2fa/policies            – roles that require two-factor (admin)
+//  PUT  /api/2fa/policies/:role      – require two-factor for a role (admin)
+// ---------------------------------------------------------------------
+
+// Purposes of a login challenge token
+const (
+	challengeVerify = "2fa_verify" // the user has two-factor on and must enter a code
+	challengeEnroll = "2fa_enroll" // the role requires two-factor and the user must enroll
+)
+
+const (
+	challengeTTL      = 5 * time.Minute
+	recoveryCodeCount = 10
+)
+
+var (
+	errInvalidChallenge     = errors.New("invalid or expired challenge token")
+	errInvalidTwoFactorCode = errors.New("invalid two-factor code")
+	errInvalidPassword      = errors.New("invalid password")
+	errTwoFactorEnabled     = errors.New("two-factor authentication is already enabled")
+	errTwoFactorDisabled    = errors.New("two-factor authentication is not enabled")
+	errTwoFactorNotStarted  = errors.New("two-factor enrollment has not been started")
+	errTwoFactorRequired    = errors.New("two-factor authentication is required for this role")
+)
+
+// challengeKey signs challenge tokens. It is derived from SECRET so that a
+// challenge can never be used as a session token.
+func challengeKey() []byte {
+	sum := sha256.Sum256([]byte("2fa-challenge:" + config.Get().Secret))
+	return sum[:]
+}
+
+// totpIssuer is the account issuer shown in authenticator apps (TOTP_ISSUER)
+func totpIssuer() string {
+	return config.Get().TOTPIssuer
+}
+
+// twoFactorRequired reports whether the policy of a role requires two-factor
+func twoFactorRequired(db *gorm.DB, role string) (bool, error) {
+	var policy model.TwoFactorPolicy
+	err := db.Where("role = ?", role).Limit(1).Find(&policy).Error
+	return policy.Required, err
+}
+
+// sendTwoFactorChallenge answers a correct password with a short-lived
+// challenge token instead of a session
+func sendTwoFactorChallenge(c *fiber.Ctx, user model.User, purpose string) error {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":     strconv.FormatUint(uint64(user.ID), 10),
+		"purpose": purpose,
+		"exp":     time.Now().Add(challengeTTL).Unix(),
+	})
+	t, err := token.SignedString(challengeKey())
+	if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	message := "Two-factor code required"
+	if purpose == challengeEnroll {
+		message = "Two-factor enrollment required"
+	}
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": message,
+		"data": fiber.Map{
+			"two_factor":      purpose,
+			"challenge_token": t,
+			"expires_in":      int(challengeTTL.Seconds()),
+		},
+	})
+}
+
+// parseChallenge returns the user a challenge token of the given purpose was issued to
+func parseChallenge(db *gorm.DB, challenge, purpose string) (model.User, error) {
+	var user model.User
+	token, err := jwt.Parse(challenge, func(*jwt.Token) (interface{}, error) {
+		return challengeKey(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return user, errInvalidChallenge
+	}
+	claims := token.Claims.(jwt.MapClaims)
+	if claims["purpose"] != purpose {
+		return user, errInvalidChallenge
+	}
+	subject, _ := claims.GetSubject()
+	if err := db.First(&user, "id = ?", subject).Error; err != nil {
+		return user, errInvalidChallenge
+	}
+	return user, nil
+}
+
+// checkTOTP validates a code and records its period so it cannot be reused
+func checkTOTP(tx *gorm.DB, user *model.User, code string) error {
+	step, ok := totp.Validate(user.TOTPSecret, code, time.Now())
+	if !ok || step <= user.TOTPLastStep {
+		return errInvalidTwoFactorCode
+	}
+	user.TOTPLastStep = step
+	return tx.Model(user).Update("totp_last_step", step).Error
+}
+
+// useRecoveryCode consumes one of the unused recovery codes of a user
+func useRecoveryCode(tx *gorm.DB, userID uint, code string) error {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	result := tx.Model(&model.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashToken(normalized)).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// checkSecondFactor accepts either a TOTP code or a recovery code. The user
+// row is locked so that concurrent requests cannot replay the same code.
+func checkSecondFactor(tx *gorm.DB, user *model.User, code, recoveryCode string) error {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(user, user.ID).Error; err != nil {
+		return err
+	}
+	if user.TOTPEnabledAt == nil {
+		return errTwoFactorDisabled
+	}
+	if recoveryCode != "" {
+		return useRecoveryCode(tx, user.ID, recoveryCode)
+	}
+	return checkTOTP(tx, user, code)
+}
+
+// generateRecoveryCodes replaces the recovery codes of a user and returns them in clear
+func generateRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	rows := make([]model.RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		raw := make([]byte, 5)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		code := hex.EncodeToString(raw)
+		codes[i] = code[:5] + "-" + code[5:]
+		rows[i] = model.RecoveryCode{UserID: userID, CodeHash: hashToken(code)}
+	}
+	return codes, tx.Create(&rows).Error
+}
+
+// startEnrollment stores a new secret for a user who has two-factor off
+func startEnrollment(db *gorm.DB, user *model.User) (fiber.Map, error) {
+	if user.TOTPEnabledAt != nil {
+		return nil, errTwoFactorEnabled
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	user.TOTPSecret = secret
+	if err := db.Model(user).Update("totp_secret", secret).Error; err != nil {
+		return nil, err
+	}
+	return fiber.Map{
+		"secret":      secret,
+		"otpauth_uri": totp.URI(totpIssuer(), user.Username, secret),
+	}, nil
+}
+
+// confirmEnrollment turns two-factor on once the user proves the authenticator
+// works and returns fresh recovery codes
+func confirmEnrollment(db *gorm.DB, user *model.User, code string) ([]string, error) {
+	var codes []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(user, user.ID).Error; err != nil {
+			return err
+		}
+		if user.TOTPEnabledAt != nil {
+			return errTwoFactorEnabled
+		}
+		if user.TOTPSecret == "" {
+			return errTwoFactorNotStarted
+		}
+		if err := checkTOTP(tx, user, code); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		user.TOTPEnabledAt = &now
+		if err := tx.Model(user).Update("totp_enabled_at", now).Error; err != nil {
+			return err
+		}
+		var err error
+		codes, err = generateRecoveryCodes(tx, user.ID)
+		return err
+	})
+	return codes, err
+}
+
+// limitSecondFactor runs a code or password check under the lockout of the
+// user's account and returns how long the account is locked if it is
+func limitSecondFactor(user model.User, check func() error) (time.Duration, error) {
+	lockout := loginLockout()
+	account := userAccount(user.ID)
+	if wait, err := lockout.Locked(account); err != nil || wait > 0 {
+		return wait, err
+	}
+
+	err := check()
+	if errors.Is(err, errInvalidTwoFactorCode) || errors.Is(err, errInvalidPassword) {
+		if _, err := lockout.Fail(account); err != nil {
+			log.Println("❌ Cannot record two-factor failure:", err)
+		}
+	}
+	return 0, err
+}
+
+// twoFactorError maps two-factor errors to responses
+func twoFactorError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, errInvalidChallenge), errors.Is(err, errInvalidTwoFactorCode):
+		return c.Status(fiber.StatusUnauthorized).
+			JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	case errors.Is(err, errTwoFactorEnabled), errors.Is(err, errTwoFactorDisabled), errors.Is(err, errTwoFactorNotStarted):
+		return c.Status(fiber.StatusConflict).
+			JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	case errors.Is(err, errTwoFactorRequired):
+		return c.Status(fiber.StatusForbidden).
+			JSON(fiber.Map{"status": "error", "message": err.Error(), "data": nil})
+	case errors.Is(err, errInvalidPassword):
+		return c.Status(fiber.StatusForbidden).
+			JSON(fiber.Map{"status": "error", "message": "Invalid credentials", "data": nil})
+	}
+	return c.Status(fiber.StatusInternalServerError).
+		JSON(fiber.Map{"status": "error", "message": "two-factor operation failed", "data": err.Error()})
+}
+
+// parseTwoFactorInput reads and validates a JSON body
+func parseTwoFactorInput(c *fiber.Ctx, input interface{}) error {
+	if err := c.BodyParser(input); err != nil {
+		return err
+	}
+	return validator.New().Struct(input)
+}
+
+// currentUser loads the user of the session token
+func currentUser(c *fiber.Ctx) (model.User, bool) {
+	var user model.User
+	err := database.DB.First(&user, getUserIDFromToken(c)).Error
+	return user, err == nil
+}
+
+// ----------  LOGIN ----------------------------------------------------
+
+// VerifyTwoFactor exchanges a challenge token and a code for a session
+func VerifyTwoFactor(c *fiber.Ctx) error {
+	var input struct {
+		ChallengeToken string `json:"challenge_token" validate:"required"`
+		Code           string `json:"code" validate:"required_without=RecoveryCode"`
+		RecoveryCode   string `json:"recovery_code"`
+	}
+	if err := parseTwoFactorInput(c, &input); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "invalid input", "data": err.Error()})
+	}
+
+	db := database.DB
+	user, err := parseChallenge(db, input.ChallengeToken, challengeVerify)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+	wait, err := limitSecondFactor(user, func() error {
+		return db.Transaction(func(tx *gorm.DB) error {
+			return checkSecondFactor(tx, &user, input.Code, input.RecoveryCode)
+		})
+	})
+	if wait > 0 {
+		return tooManyAttempts(c, wait)
+	}
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return sendSession(c, user, nil)
+}
+
+// EnrollTwoFactor starts the enrollment that a role policy requires before login
+func EnrollTwoFactor(c *fiber.Ctx) error {
+	var input struct {
+		ChallengeToken string `json:"challenge_token" validate:"required"`
+	}
+	if err := parseTwoFactorInput(c, &input); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "invalid input", "data": err.Error()})
+	}
+
+	db := database.DB
+	user, err := parseChallenge(db, input.ChallengeToken, challengeEnroll)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+	setup, err := startEnrollment(db, &user)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "Scan the code with an authenticator app", "data": setup})
+}
+
+// ConfirmTwoFactorEnrollment enables two-factor for a challenged user and logs them in
+func ConfirmTwoFactorEnrollment(c *fiber.Ctx) error {
+	var input struct {
+		ChallengeToken string `json:"challenge_token" validate:"required"`
+		Code           string `json:"code" validate:"required"`
+	}
+	if err := parseTwoFactorInput(c, &input); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "invalid input", "data": err.Error()})
+	}
+
+	db := database.DB
+	user, err := parseChallenge(db, input.ChallengeToken, challengeEnroll)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+	var codes []string
+	wait, err := limitSecondFactor(user, func() error {
+		var err error
+		codes, err = confirmEnrollment(db, &user, input.Code)
+		return err
+	})
+	if wait > 0 {
+		return tooManyAttempts(c, wait)
+	}
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return sendSession(c, user, fiber.Map{"recovery_codes": codes})
+}
+
+// ----------  SELF SERVICE ---------------------------------------------
+
+// SetupTwoFactor starts enrollment for the current user
+func SetupTwoFactor(c *fiber.Ctx) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return c.Status(fiber.StatusNotFound).
+			JSON(fiber.Map{"status": "error", "message": "User not found", "data": nil})
+	}
+	setup, err := startEnrollment(database.DB, &user)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "Scan the code with an authenticator app", "data": setup})
+}
+
+// EnableTwoFactor confirms the first code of the current user
+func EnableTwoFactor(c *fiber.Ctx) error {
+	var input struct {
+		Code string `json:"code" validate:"required"`
+	}
+	if err := parseTwoFactorInput(c, &input); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "invalid input", "data": err.Error()})
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return c.Status(fiber.StatusNotFound).
+			JSON(fiber.Map{"status": "error", "message": "User not found", "data": nil})
+	}
+	var codes []string
+	wait, err := limitSecondFactor(user, func() error {
+		var err error
+		codes, err = confirmEnrollment(database.DB, &user, input.Code)
+		return err
+	})
+	if wait > 0 {
+		return tooManyAttempts(c, wait)
+	}
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "Two-factor authentication enabled", "data": fiber.Map{
+		"recovery_codes": codes,
+	}})
+}
+
+// DisableTwoFactor turns two-factor off after checking the password and a code.
+// Users whose role requires two-factor cannot turn it off.
+func DisableTwoFactor(c *fiber.Ctx) error {
+	var input struct {
+		Password     string `json:"password" validate:"required"`
+		Code         string `json:"code" validate:"required_without=RecoveryCode"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := parseTwoFactorInput(c, &input); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "invalid input", "data": err.Error()})
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return c.Status(fiber.StatusNotFound).
+			JSON(fiber.Map{"status": "error", "message": "User not found", "data": nil})
+	}
+	wait, err := limitSecondFactor(user, func() error {
+		if !CheckPasswordHash(input.Password, user.Password) {
+			return errInvalidPassword
+		}
+		return database.DB.Transaction(func(tx *gorm.DB) error {
+			required, err := twoFactorRequired(tx, user.Role)
+			if err != nil {
+				return err
+			}
+			if required {
+				return errTwoFactorRequired
+			}
+			if err := checkSecondFactor(tx, &user, input.Code, input.RecoveryCode); err != nil {
+				return err
+			}
+			if err := tx.Where("user_id = ?", user.ID).Delete(&model.RecoveryCode{}).Error; err != nil {
+				return err
+			}
+			return tx.Model(&user).Updates(map[string]interface{}{
+				"totp_secret":     "",
+				"totp_enabled_at": nil,
+				"totp_last_step":  0,
+			}).Error
+		})
+	})
+	if wait > 0 {
+		return tooManyAttempts(c, wait)
+	}
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "Two-factor authentication disabled", "data": nil})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the current user
+func RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	var input struct {
+		Code string `json:"code" validate:"required"`
+	}
+	if err := parseTwoFactorInput(c, &input); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "invalid input", "data": err.Error()})
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return c.Status(fiber.StatusNotFound).
+			JSON(fiber.Map{"status": "error", "message": "User not found", "data": nil})
+	}
+
+	var codes []string
+	wait, err := limitSecondFactor(user, func() error {
+		return database.DB.Transaction(func(tx *gorm.DB) error {
+			if err := checkSecondFactor(tx, &user, input.Code, ""); err != nil {
+				return err
+			}
+			var err error
+			codes, err = generateRecoveryCodes(tx, user.ID)
+			return err
+		})
+	})
+	if wait > 0 {
+		return tooManyAttempts(c, wait)
+	}
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "Recovery codes replaced", "data": fiber.Map{
+		"recovery_codes": codes,
+	}})
+}
+
+// ----------  POLICIES -------------------------------------------------
+
+// GetTwoFactorPolicies lists whether each role requires two-factor
+func GetTwoFactorPolicies(c *fiber.Ctx) error {
+	var stored []model.TwoFactorPolicy
+	if err := database.DB.Find(&stored).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot fetch two-factor policies", "data": err.Error()})
+	}
+
+	policies := []model.TwoFactorPolicy{{Role: model.RoleUser}, {Role: model.RoleAdmin}}
+	for i := range policies {
+		for _, p := range stored {
+			if p.Role == policies[i].Role {
+				policies[i] = p
+			}
+		}
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "two-factor policies", "data": policies})
+}
+
+// UpdateTwoFactorPolicy sets whether a role requires two-factor. Users of the
+// role without two-factor must enroll at their next login.
+func UpdateTwoFactorPolicy(c *fiber.Ctx) error {
+	role := c.Params("role")
+	if role != model.RoleUser && role != model.RoleAdmin {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": fmt.Sprintf("unknown role %q", role), "data": nil})
+	}
+
+	var input struct {
+		Required *bool `json:"required" validate:"required"`
+	}
+	if err := parseTwoFactorInput(c, &input); err != nil {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"status": "error", "message": "invalid input", "data": err.Error()})
+	}
+
+	policy := model.TwoFactorPolicy{Role: role, Required: *input.Required}
+	if err := database.DB.Save(&policy).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "cannot save two-factor policy", "data": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "two-factor policy saved", "data": policy})
+}
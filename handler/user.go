@@ -1,20 +1,26 @@
 package handler
 
 import (
+	"errors"
+	"log"
 	"strconv"
 	"time"
 
 	"app/database"
 	"app/model"
+	"app/notify"
+	"app/service"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
-func hashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
+// HashPassword hashes a password for storage
+func HashPassword(password string) (string, error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), model.PasswordCost)
 	return string(bytes), err
 }
 
@@ -30,36 +36,47 @@ func validToken(t *jwt.Token, id string) bool {
 	return uid == n
 }
 
-func validUser(id string, p string) bool {
-	db := database.DB
-	var user model.User
-	db.First(&user, id)
-	if user.Username == "" {
-		return false
-	}
-	if !CheckPasswordHash(p, user.Password) {
-		return false
+// notifyAccount queues an account notification; a failure never fails the request
+func notifyAccount(user model.User, kind string) {
+	if err := notify.AccountEvent(database.DB, user, kind); err != nil {
+		log.Println("❌ Cannot queue account notification:", err)
 	}
-	return true
 }
 
-// GetAllUsers get all users
-func GetAllUsers(c *fiber.Ctx) error {
-	db := database.DB
-	var users []model.User
-	db.Find(&users)
+// UserHandler serves the user endpoints that read and delete users through the
+// user service; creating and updating users also joins organizations and queues
+// notifications, which the service does not cover
+type UserHandler struct {
+	users *service.UserService
+}
+
+// NewUserHandler returns the user handler of the services
+func NewUserHandler(services *service.Services) *UserHandler {
+	return &UserHandler{users: services.Users}
+}
+
+// GetAll get all users
+func (h *UserHandler) GetAll(c *fiber.Ctx) error {
+	users, err := h.users.List(c.UserContext())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't fetch users", "errors": err.Error()})
+	}
 	return c.JSON(fiber.Map{"status": "success", "message": "All users", "data": users})
 }
 
-// GetUser get a user
-func GetUser(c *fiber.Ctx) error {
-	id := c.Params("id")
-	db := database.DB
-	var user model.User
-	db.Find(&user, id)
-	if user.Username == "" {
+// Get get a user
+func (h *UserHandler) Get(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"status": "error", "message": "No user found with ID", "data": nil})
+	}
+	user, err := h.users.Get(c.UserContext(), uint(id))
+	if errors.Is(err, service.ErrNotFound) {
 		return c.Status(404).JSON(fiber.Map{"status": "error", "message": "No user found with ID", "data": nil})
 	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't fetch user", "errors": err.Error()})
+	}
 	return c.JSON(fiber.Map{"status": "success", "message": "User found", "data": user})
 }
 
@@ -78,16 +95,32 @@ func CreateUser(c *fiber.Ctx) error {
 
 	validate := validator.New()
 	if err := validate.Struct(user); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid request body", "errors": err.Error()})
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"status": "error", "message": "Invalid request body", "errors": err.Error()})
 	}
 
-	hash, err := hashPassword(user.Password)
+	hash, err := HashPassword(user.Password)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't hash password", "errors": err.Error()})
 	}
 
 	user.Password = hash
-	if err := db.Create(&user).Error; err != nil {
+	user.Role = model.RoleUser // roles are granted by admins only
+	user.EmailVerifiedAt = nil
+	user.TOTPEnabledAt = nil
+	user.OIDCIssuer, user.OIDCSubject = nil, nil
+	user.ServiceAccount = false
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		if err := JoinSignupOrganization(tx, *user); err != nil {
+			return err
+		}
+		if err := notify.AccountEvent(tx, *user, notify.KindAccountRegistered); err != nil {
+			return err
+		}
+		return sendEmailVerification(tx, *user)
+	}); err != nil {
 		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't create user", "errors": err.Error()})
 	}
 
@@ -130,23 +163,36 @@ func UpdateUser(c *fiber.Ctx) error {
 	if uui.Username != "" {
 		user.Username = uui.Username
 	}
-	if uui.Email != "" {
+	emailChanged := uui.Email != "" && uui.Email != user.Email
+	if emailChanged {
 		user.Email = uui.Email
+		user.EmailVerifiedAt = nil
 	}
 	if uui.Names != "" {
 		user.Names = uui.Names
 	}
 	if uui.Password != "" {
-		hash, err := hashPassword(uui.Password)
+		hash, err := HashPassword(uui.Password)
 		if err != nil {
 			return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't hash password", "errors": err.Error()})
 		}
 		user.Password = hash
 	}
 
-	if err := db.Save(&user).Error; err != nil {
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+		if emailChanged {
+			return sendEmailVerification(tx, user)
+		}
+		return nil
+	}); err != nil {
 		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't update user", "errors": err.Error()})
 	}
+	if uui.Password != "" {
+		notifyAccount(user, notify.KindPasswordChanged)
+	}
 
 	// Return user without password
 	type UserResponse struct {
@@ -156,6 +202,8 @@ func UpdateUser(c *fiber.Ctx) error {
 		Username  string    `json:"username"`
 		Email     string    `json:"email"`
 		Names     string    `json:"names"`
+
+		EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
 	}
 
 	userResponse := UserResponse{
@@ -165,13 +213,15 @@ func UpdateUser(c *fiber.Ctx) error {
 		Username:  user.Username,
 		Email:     user.Email,
 		Names:     user.Names,
+
+		EmailVerifiedAt: user.EmailVerifiedAt,
 	}
 
 	return c.JSON(fiber.Map{"status": "success", "message": "User successfully updated", "data": userResponse})
 }
 
-// DeleteUser delete user
-func DeleteUser(c *fiber.Ctx) error {
+// Delete delete user
+func (h *UserHandler) Delete(c *fiber.Ctx) error {
 	type PasswordInput struct {
 		Password string `json:"password"`
 	}
@@ -186,21 +236,15 @@ func DeleteUser(c *fiber.Ctx) error {
 		return c.Status(401).JSON(fiber.Map{"status": "error", "message": "Invalid token id", "data": nil})
 	}
 
-	if !validUser(id, pi.Password) {
+	userID, _ := strconv.ParseUint(id, 10, 64)
+	user, err := h.users.Delete(c.UserContext(), uint(userID), pi.Password)
+	if errors.Is(err, service.ErrInvalidCredentials) {
 		return c.Status(403).JSON(fiber.Map{"status": "error", "message": "Invalid credentials", "data": nil})
 	}
-
-	db := database.DB
-	var user model.User
-
-	result := db.First(&user, id)
-	if result.Error != nil {
-		return c.Status(404).JSON(fiber.Map{"status": "error", "message": "User not found", "data": nil})
-	}
-
-	if err := db.Delete(&user).Error; err != nil {
+	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Couldn't delete user", "errors": err.Error()})
 	}
+	notifyAccount(user, notify.KindAccountDeleted)
 
 	return c.JSON(fiber.Map{"status": "success", "message": "User successfully deleted", "data": nil})
 }
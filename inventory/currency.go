@@ -0,0 +1,84 @@
+package inventory
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"app/model"
+
+	"gorm.io/gorm"
+)
+
+// ErrNoRate is returned when no exchange rate is effective for a currency at a date
+var ErrNoRate = errors.New("no exchange rate")
+
+// Converter converts an amount in the given currency to the reporting currency at a time
+type Converter func(amount float64, currency string, at time.Time) (float64, error)
+
+// RateTable holds exchange rates to the base currency by effective date
+type RateTable struct {
+	Base  string
+	rates map[string][]model.ExchangeRate // sorted by effective date
+}
+
+// NewRateTable indexes the given rates
+func NewRateTable(base string, rates []model.ExchangeRate) *RateTable {
+	t := &RateTable{Base: strings.ToUpper(base), rates: make(map[string][]model.ExchangeRate)}
+	for _, r := range rates {
+		code := strings.ToUpper(r.Currency)
+		t.rates[code] = append(t.rates[code], r)
+	}
+	for _, list := range t.rates {
+		sort.Slice(list, func(i, j int) bool { return list[i].EffectiveDate.Before(list[j].EffectiveDate) })
+	}
+	return t
+}
+
+// LoadRates reads all exchange rates from the database
+func LoadRates(db *gorm.DB, base string) (*RateTable, error) {
+	var rates []model.ExchangeRate
+	if err := db.Find(&rates).Error; err != nil {
+		return nil, err
+	}
+	return NewRateTable(base, rates), nil
+}
+
+// Rate returns how many base currency units one unit of currency is worth at a time
+func (t *RateTable) Rate(currency string, at time.Time) (float64, error) {
+	currency = strings.ToUpper(currency)
+	if currency == "" || currency == t.Base {
+		return 1, nil
+	}
+	list := t.rates[currency]
+	i := sort.Search(len(list), func(i int) bool { return list[i].EffectiveDate.After(at) })
+	if i == 0 {
+		return 0, fmt.Errorf("%w for %s effective on %s", ErrNoRate, currency, at.Format("2006-01-02"))
+	}
+	return list[i-1].Rate, nil
+}
+
+// Convert converts an amount between two currencies using the rates valid at a time
+func (t *RateTable) Convert(amount float64, from, to string, at time.Time) (float64, error) {
+	if strings.EqualFold(from, to) {
+		return amount, nil // Needs no rate
+	}
+	fromRate, err := t.Rate(from, at)
+	if err != nil {
+		return 0, err
+	}
+	toRate, err := t.Rate(to, at)
+	if err != nil {
+		return 0, err
+	}
+	return amount * fromRate / toRate, nil
+}
+
+// To returns a converter to the given reporting currency
+func (t *RateTable) To(currency string) Converter {
+	return func(amount float64, from string, at time.Time) (float64, error) {
+		return t.Convert(amount, from, currency, at)
+	}
+}
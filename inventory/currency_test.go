@@ -0,0 +1,94 @@
+package inventory
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"app/model"
+)
+
+func date(year int, month time.Month, d int) time.Time {
+	return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+}
+
+func rateTable() *RateTable {
+	return NewRateTable("rub", []model.ExchangeRate{
+		{Currency: "USD", EffectiveDate: date(2025, time.February, 1), Rate: 100},
+		{Currency: "usd", EffectiveDate: date(2025, time.January, 1), Rate: 90},
+		{Currency: "EUR", EffectiveDate: date(2025, time.January, 15), Rate: 125},
+	})
+}
+
+func TestRate(t *testing.T) {
+	rates := rateTable()
+	cases := []struct {
+		currency string
+		at       time.Time
+		rate     float64
+		err      error
+	}{
+		{"RUB", date(2000, time.January, 1), 1, nil},
+		{"", date(2000, time.January, 1), 1, nil},
+		{"USD", date(2025, time.January, 1), 90, nil},
+		{"usd", date(2025, time.January, 31), 90, nil},
+		{"USD", date(2025, time.February, 1), 100, nil},
+		// The last rate stays in effect however old it is
+		{"USD", date(2026, time.June, 1), 100, nil},
+		// Before the first rate, and for a currency without rates
+		{"USD", date(2024, time.December, 31), 0, ErrNoRate},
+		{"GBP", date(2025, time.March, 1), 0, ErrNoRate},
+	}
+	for _, c := range cases {
+		rate, err := rates.Rate(c.currency, c.at)
+		if rate != c.rate || !errors.Is(err, c.err) {
+			t.Errorf("Rate(%q, %s) = %v, %v, want %v, %v", c.currency, c.at.Format("2006-01-02"), rate, err, c.rate, c.err)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	rates := rateTable()
+	cases := []struct {
+		amount   float64
+		from, to string
+		at       time.Time
+		want     float64
+		err      error
+	}{
+		{10, "USD", "RUB", date(2025, time.January, 20), 900, nil},
+		{900, "RUB", "USD", date(2025, time.January, 20), 10, nil},
+		{10, "USD", "EUR", date(2025, time.February, 10), 8, nil},
+		{10, "EUR", "EUR", date(2020, time.January, 1), 10, nil},
+		// Either side without a rate at that time
+		{10, "USD", "EUR", date(2025, time.January, 10), 0, ErrNoRate},
+		{10, "GBP", "RUB", date(2025, time.January, 10), 0, ErrNoRate},
+	}
+	for _, c := range cases {
+		got, err := rates.Convert(c.amount, c.from, c.to, c.at)
+		if got != c.want || !errors.Is(err, c.err) {
+			t.Errorf("Convert(%v %s to %s) = %v, %v, want %v, %v", c.amount, c.from, c.to, got, err, c.want, c.err)
+		}
+	}
+}
+
+func TestValueConvertsReceipts(t *testing.T) {
+	to := rateTable().To("RUB")
+	movements := []Movement{
+		{Action: "RECEIVE", Time: day(2), Before: 0, After: 10, UnitCost: cost(2), Currency: "USD"},
+		{Action: "RECEIVE", Time: day(20), Before: 10, After: 20, UnitCost: cost(2), Currency: "EUR"},
+	}
+	got, err := Value(FIFO, movements, nil, day(1), day(30), to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Valuation{Quantity: 20, Value: 4300, UnitCost: 215}); got != want {
+		t.Errorf("Value = %+v, want %+v", got, want)
+	}
+
+	// A receipt in a currency without a rate at its time cannot be valued
+	movements[0].Currency = "GBP"
+	if _, err := Value(FIFO, movements, nil, day(1), day(30), to); !errors.Is(err, ErrNoRate) {
+		t.Errorf("Value with a missing rate: %v, want %v", err, ErrNoRate)
+	}
+}
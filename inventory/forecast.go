@@ -0,0 +1,123 @@
+package inventory
+
+import (
+	"math"
+	"time"
+)
+
+// Forecast methods for the daily consumption rate
+const (
+	MovingAverage        = "ma"
+	ExponentialSmoothing = "ses"
+)
+
+// ForecastParams tunes consumption forecasting and reorder suggestions
+type ForecastParams struct {
+	Window      int     // Days of history used
+	Alpha       float64 // Smoothing factor of exponential smoothing, in (0, 1]
+	Method      string  // Rate used for projections: MovingAverage or ExponentialSmoothing
+	LeadTime    int     // Days between ordering and receiving
+	Coverage    int     // Days of consumption a new order should cover
+	SafetyStock int     // Quantity kept in reserve
+}
+
+// Forecast projects when a resource runs out and how much to reorder
+type Forecast struct {
+	ResourceID           uint       `json:"resource_id"`
+	Quantity             int        `json:"quantity"`
+	Consumed             int        `json:"consumed"`              // Quantity consumed within the window
+	MovingAverage        float64    `json:"moving_average"`        // Units per day
+	ExponentialSmoothing float64    `json:"exponential_smoothing"` // Units per day
+	DailyConsumption     float64    `json:"daily_consumption"`     // Rate of the chosen method
+	DaysOfStock          *float64   `json:"days_of_stock"`         // Nil when nothing is consumed
+	StockoutDate         *time.Time `json:"stockout_date"`         // Nil when nothing is consumed
+	ReorderPoint         int        `json:"reorder_point"`         // Stock level that should trigger an order
+	ReorderNow           bool       `json:"reorder_now"`           // Stock is at or below the reorder point
+	SuggestedOrder       int        `json:"suggested_order"`       // Quantity to order now to cover lead time and coverage
+}
+
+// DailyConsumption buckets consumption (decreases other than deletions) into
+// the window days ending with the day of now, oldest first
+func DailyConsumption(movements []Movement, now time.Time, window int) []float64 {
+	series := make([]float64, window)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	start := today.AddDate(0, 0, -(window - 1))
+	for _, m := range movements {
+		delta := m.Delta()
+		if delta >= 0 || m.Action == "DELETE" || m.Time.Before(start) || m.Time.After(now) {
+			continue
+		}
+		day := dayNumber(m.Time.In(now.Location())) - dayNumber(start)
+		if day >= 0 && day < window {
+			series[day] += float64(-delta)
+		}
+	}
+	return series
+}
+
+// dayNumber counts calendar days rather than hours, as days are 23 or 25
+// hours long when daylight saving time starts or ends
+func dayNumber(t time.Time) int {
+	return int(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Unix() / (24 * 60 * 60))
+}
+
+// Smooth returns the last value of simple exponential smoothing over the series,
+// seeded with the series mean so that a quiet first day does not dominate
+func Smooth(series []float64, alpha float64) float64 {
+	if len(series) == 0 {
+		return 0
+	}
+	s := mean(series)
+	for _, x := range series {
+		s = alpha*x + (1-alpha)*s
+	}
+	return s
+}
+
+func mean(series []float64) float64 {
+	if len(series) == 0 {
+		return 0
+	}
+	total := 0.0
+	for _, x := range series {
+		total += x
+	}
+	return total / float64(len(series))
+}
+
+// Project forecasts a resource with the given current quantity and movements
+func Project(resourceID uint, quantity int, movements []Movement, now time.Time, p ForecastParams) Forecast {
+	series := DailyConsumption(movements, now, p.Window)
+	f := Forecast{
+		ResourceID:           resourceID,
+		Quantity:             quantity,
+		MovingAverage:        round3(mean(series)),
+		ExponentialSmoothing: round3(Smooth(series, p.Alpha)),
+	}
+	for _, x := range series {
+		f.Consumed += int(x)
+	}
+
+	f.DailyConsumption = f.ExponentialSmoothing
+	if p.Method == MovingAverage {
+		f.DailyConsumption = f.MovingAverage
+	}
+
+	rate := f.DailyConsumption
+	if rate > 0 {
+		days := round3(float64(quantity) / rate)
+		stockout := now.Add(time.Duration(days * float64(24*time.Hour)))
+		f.DaysOfStock = &days
+		f.StockoutDate = &stockout
+	}
+
+	f.ReorderPoint = int(math.Ceil(rate*float64(p.LeadTime))) + p.SafetyStock
+	f.ReorderNow = rate > 0 && quantity <= f.ReorderPoint
+	orderUpTo := int(math.Ceil(rate*float64(p.LeadTime+p.Coverage))) + p.SafetyStock
+	f.SuggestedOrder = max(orderUpTo-quantity, 0)
+	return f
+}
+
+func round3(f float64) float64 {
+	return math.Round(f*1000) / 1000
+}
@@ -0,0 +1,106 @@
+package inventory
+
+import (
+	"reflect"
+	"testing"
+	"time"
+	_ "time/tzdata" // Zones with daylight saving time wherever the tests run
+)
+
+func issue(at time.Time, qty int) Movement {
+	return Movement{Action: "ISSUE", Time: at, Before: 100, After: 100 - qty}
+}
+
+func TestDailyConsumption(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(month time.Month, d, hour, minute int) time.Time {
+		return time.Date(2025, month, d, hour, minute, 0, 0, berlin)
+	}
+
+	cases := []struct {
+		name      string
+		now       time.Time
+		movements []Movement
+		want      []float64
+	}{
+		// Clocks go forward on March 30: that day has 23 hours
+		{"spring forward", at(time.March, 31, 10, 0), []Movement{
+			issue(at(time.March, 29, 0, 0), 1),
+			issue(at(time.March, 30, 23, 59), 2),
+			issue(at(time.March, 31, 0, 30), 4),
+		}, []float64{1, 2, 4}},
+		// Clocks go back on October 26: that day has 25 hours
+		{"fall back", at(time.October, 27, 10, 0), []Movement{
+			issue(at(time.October, 25, 23, 30), 1),
+			issue(at(time.October, 26, 23, 30), 2),
+			issue(at(time.October, 27, 0, 30), 4),
+		}, []float64{1, 2, 4}},
+		// Times in another zone count on the day they fall on where now is
+		{"other zone", at(time.June, 3, 10, 0), []Movement{
+			issue(time.Date(2025, time.June, 1, 23, 30, 0, 0, time.UTC), 3),
+		}, []float64{0, 3, 0}},
+		{"ignored movements", at(time.June, 3, 10, 0), []Movement{
+			issue(at(time.May, 31, 23, 59), 1), // Before the window
+			issue(at(time.June, 3, 11, 0), 1),  // After now
+			{Action: "RECEIVE", Time: at(time.June, 2, 9, 0), Before: 0, After: 5},
+			{Action: "DELETE", Time: at(time.June, 2, 9, 0), Before: 5, After: 0},
+		}, []float64{0, 0, 0}},
+	}
+	for _, c := range cases {
+		if got := DailyConsumption(c.movements, c.now, 3); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: DailyConsumption = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestSmooth(t *testing.T) {
+	cases := []struct {
+		series []float64
+		alpha  float64
+		want   float64
+	}{
+		{nil, 0.5, 0},
+		{[]float64{2, 2, 2}, 0.3, 2},
+		{[]float64{0, 0, 0, 4}, 0.5, 2.0625},
+		{[]float64{1, 5}, 1, 5},
+	}
+	for _, c := range cases {
+		if got := Smooth(c.series, c.alpha); got != c.want {
+			t.Errorf("Smooth(%v, %v) = %v, want %v", c.series, c.alpha, got, c.want)
+		}
+	}
+}
+
+func TestProject(t *testing.T) {
+	now := time.Date(2025, time.June, 4, 12, 0, 0, 0, time.UTC)
+	var movements []Movement
+	for d := 1; d <= 4; d++ {
+		movements = append(movements, issue(time.Date(2025, time.June, d, 9, 0, 0, 0, time.UTC), 2))
+	}
+	p := ForecastParams{Window: 4, Alpha: 0.3, Method: MovingAverage, LeadTime: 3, Coverage: 7, SafetyStock: 1}
+
+	f := Project(1, 10, movements, now, p)
+	if f.Consumed != 8 || f.MovingAverage != 2 || f.ExponentialSmoothing != 2 || f.DailyConsumption != 2 {
+		t.Fatalf("consumption %+v", f)
+	}
+	if f.DaysOfStock == nil || *f.DaysOfStock != 5 || !f.StockoutDate.Equal(now.AddDate(0, 0, 5)) {
+		t.Fatalf("stockout %+v", f)
+	}
+	// Three days of lead time at two a day, plus the safety stock; an order
+	// covers ten days
+	if f.ReorderPoint != 7 || f.ReorderNow || f.SuggestedOrder != 11 {
+		t.Fatalf("reorder %+v", f)
+	}
+	if f := Project(1, 7, movements, now, p); !f.ReorderNow || f.SuggestedOrder != 14 {
+		t.Fatalf("reorder at the reorder point %+v", f)
+	}
+
+	// Nothing consumed: no stockout and nothing to order
+	f = Project(1, 10, nil, now, p)
+	if f.DaysOfStock != nil || f.StockoutDate != nil || f.ReorderNow || f.ReorderPoint != 1 || f.SuggestedOrder != 0 {
+		t.Fatalf("idle resource %+v", f)
+	}
+}
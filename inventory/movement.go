@@ -0,0 +1,87 @@
+// Package inventory derives stock movements from the resource history and
+// computes figures such as valuation and consumption from them.
+package inventory
+
+import (
+	"encoding/json"
+	"time"
+
+	"app/model"
+
+	"gorm.io/gorm"
+)
+
+// Movement is a quantity change of a resource reconstructed from a history entry
+type Movement struct {
+	HistoryID  uint      `json:"history_id"`
+	ResourceID uint      `json:"resource_id"`
+	Action     string    `json:"action"`
+	Time       time.Time `json:"time"`
+	Before     int       `json:"before"`              // Quantity before the change
+	After      int       `json:"after"`               // Quantity after the change
+	UnitCost   *float64  `json:"unit_cost,omitempty"` // Cost per unit of a receipt
+	Currency   string    `json:"currency,omitempty"`  // Currency of the unit cost, empty for the base currency
+}
+
+// Delta is the signed quantity change
+func (m Movement) Delta() int {
+	return m.After - m.Before
+}
+
+// snapshot is the part of a resource JSON snapshot needed to rebuild movements
+type snapshot struct {
+	Quantity int `json:"quantity"`
+}
+
+func quantityOf(data string) (int, bool) {
+	if data == "" {
+		return 0, false
+	}
+	var s snapshot
+	if err := json.Unmarshal([]byte(data), &s); err != nil {
+		return 0, false
+	}
+	return s.Quantity, true
+}
+
+// FromHistory rebuilds a movement from the resource snapshots of a history entry.
+// A created resource starts from zero and a deleted one leaves the books at zero.
+func FromHistory(h model.ResourceHistory) Movement {
+	m := Movement{
+		HistoryID:  h.ID,
+		ResourceID: h.ResourceID,
+		Action:     h.Action,
+		Time:       h.Timestamp,
+		UnitCost:   h.UnitCost,
+		Currency:   h.Currency,
+	}
+	before, okBefore := quantityOf(h.OldData)
+	after, okAfter := quantityOf(h.NewData)
+	switch {
+	case h.Action == "CREATE":
+		before = 0
+	case h.Action == "DELETE":
+		after = 0
+	case !okBefore:
+		before = after
+	case !okAfter:
+		after = before
+	}
+	m.Before, m.After = before, after
+	return m
+}
+
+// LoadMovements returns the movements recorded before the given time,
+// grouped by resource and sorted chronologically
+func LoadMovements(db *gorm.DB, before time.Time) (map[uint][]Movement, error) {
+	var history []model.ResourceHistory
+	if err := db.Where("timestamp < ?", before).Order("timestamp").Order("id").Find(&history).Error; err != nil {
+		return nil, err
+	}
+
+	movements := make(map[uint][]Movement)
+	for _, h := range history {
+		movements[h.ResourceID] = append(movements[h.ResourceID], FromHistory(h))
+	}
+	return movements, nil
+}
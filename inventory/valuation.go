@@ -0,0 +1,188 @@
+package inventory
+
+import (
+	"math"
+	"time"
+)
+
+// Method is an inventory valuation method
+type Method string
+
+// Supported valuation methods
+const (
+	FIFO            Method = "fifo"
+	WeightedAverage Method = "average"
+)
+
+// ParseMethod validates a method name, defaulting to FIFO when empty
+func ParseMethod(s string) (Method, bool) {
+	switch Method(s) {
+	case "", FIFO:
+		return FIFO, true
+	case WeightedAverage:
+		return WeightedAverage, true
+	}
+	return "", false
+}
+
+// Valuation is the stock value of one resource and its consumption over a period
+type Valuation struct {
+	ResourceID       uint    `json:"resource_id"`
+	Quantity         int     `json:"quantity"`
+	Value            float64 `json:"value"`
+	UnitCost         float64 `json:"unit_cost"`         // Value divided by quantity
+	ConsumedQuantity int     `json:"consumed_quantity"` // Quantity consumed within the period
+	ConsumedCost     float64 `json:"consumed_cost"`     // Cost of goods consumed within the period
+	UncostedReceipts int     `json:"uncosted_receipts"` // Receipts valued at the fallback cost
+}
+
+// costPool keeps the cost of the units in stock for one valuation method
+type costPool interface {
+	receive(qty int, unitCost float64)
+	consume(qty int) float64
+	value() float64
+}
+
+// fifoPool consumes the oldest receipt layers first
+type fifoPool struct {
+	layers []fifoLayer
+}
+
+type fifoLayer struct {
+	qty      int
+	unitCost float64
+}
+
+func (p *fifoPool) receive(qty int, unitCost float64) {
+	p.layers = append(p.layers, fifoLayer{qty: qty, unitCost: unitCost})
+}
+
+func (p *fifoPool) consume(qty int) float64 {
+	cost := 0.0
+	for qty > 0 && len(p.layers) > 0 {
+		take := min(qty, p.layers[0].qty)
+		cost += float64(take) * p.layers[0].unitCost
+		p.layers[0].qty -= take
+		qty -= take
+		if p.layers[0].qty == 0 {
+			p.layers = p.layers[1:]
+		}
+	}
+	return cost
+}
+
+func (p *fifoPool) value() float64 {
+	v := 0.0
+	for _, l := range p.layers {
+		v += float64(l.qty) * l.unitCost
+	}
+	return v
+}
+
+// averagePool values every unit at the running weighted average cost
+type averagePool struct {
+	qty   int
+	total float64
+}
+
+func (p *averagePool) receive(qty int, unitCost float64) {
+	p.qty += qty
+	p.total += float64(qty) * unitCost
+}
+
+func (p *averagePool) consume(qty int) float64 {
+	qty = min(qty, p.qty)
+	if qty == 0 {
+		return 0
+	}
+	cost := p.total * float64(qty) / float64(p.qty)
+	p.qty -= qty
+	p.total -= cost
+	if p.qty == 0 {
+		p.total = 0
+	}
+	return cost
+}
+
+func (p *averagePool) value() float64 {
+	return p.total
+}
+
+// Price is an amount per unit in a currency
+type Price struct {
+	Amount   float64
+	Currency string
+}
+
+// Value replays the chronologically sorted movements of one resource.
+// Receipt costs are converted to the reporting currency at the receipt time.
+// Receipts without a unit cost are valued at the last known cost of the
+// resource, or at the fallback price (if any) until a cost is known. Gaps
+// between consecutive snapshots (changes made before history existed) are
+// treated as uncosted receipts or silent write-offs. Decreases other than
+// deletions whose time falls in [from, to) count as consumption.
+func Value(method Method, movements []Movement, fallback *Price, from, to time.Time, convert Converter) (Valuation, error) {
+	var pool costPool = &fifoPool{}
+	if method == WeightedAverage {
+		pool = &averagePool{}
+	}
+
+	v := Valuation{}
+	lastCost := fallback
+	costAt := func(at time.Time) (float64, error) {
+		if lastCost == nil {
+			return 0, nil
+		}
+		return convert(lastCost.Amount, lastCost.Currency, at)
+	}
+
+	qty := 0
+	for _, m := range movements {
+		v.ResourceID = m.ResourceID
+		if gap := m.Before - qty; gap > 0 {
+			cost, err := costAt(m.Time)
+			if err != nil {
+				return v, err
+			}
+			pool.receive(gap, cost)
+			v.UncostedReceipts++
+		} else if gap < 0 {
+			pool.consume(-gap)
+		}
+
+		delta := m.Delta()
+		switch {
+		case delta > 0:
+			if m.UnitCost != nil {
+				lastCost = &Price{Amount: *m.UnitCost, Currency: m.Currency}
+			} else {
+				v.UncostedReceipts++
+			}
+			cost, err := costAt(m.Time)
+			if err != nil {
+				return v, err
+			}
+			pool.receive(delta, cost)
+		case delta < 0:
+			cost := pool.consume(-delta)
+			if m.Action != "DELETE" && !m.Time.Before(from) && m.Time.Before(to) {
+				v.ConsumedQuantity += -delta
+				v.ConsumedCost += cost
+			}
+		}
+		qty = m.After
+	}
+
+	v.Quantity = qty
+	v.Value = Round2(pool.value())
+	v.ConsumedCost = Round2(v.ConsumedCost)
+	if qty > 0 {
+		v.UnitCost = Round2(v.Value / float64(qty))
+	}
+	return v, nil
+}
+
+// Round2 rounds money to two decimals
+func Round2(f float64) float64 {
+	return math.Round(f*100) / 100
+}
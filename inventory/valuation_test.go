@@ -0,0 +1,92 @@
+package inventory
+
+import (
+	"testing"
+	"time"
+)
+
+// day is noon of the nth day of January 2025
+func day(n int) time.Time {
+	return time.Date(2025, time.January, n, 12, 0, 0, 0, time.UTC)
+}
+
+func cost(f float64) *float64 {
+	return &f
+}
+
+func TestValue(t *testing.T) {
+	// Two receipts at different prices, then an issue that empties the first
+	// layer and takes part of the second
+	layers := []Movement{
+		{Action: "RECEIVE", Time: day(1), Before: 0, After: 10, UnitCost: cost(2)},
+		{Action: "RECEIVE", Time: day(2), Before: 10, After: 20, UnitCost: cost(3)},
+		{Action: "ISSUE", Time: day(3), Before: 20, After: 5},
+	}
+	// Issues that end inside a layer and start in the next one
+	partial := []Movement{
+		{Action: "RECEIVE", Time: day(1), Before: 0, After: 4, UnitCost: cost(1)},
+		{Action: "RECEIVE", Time: day(2), Before: 4, After: 10, UnitCost: cost(2)},
+		{Action: "ISSUE", Time: day(3), Before: 10, After: 7},
+		{Action: "ISSUE", Time: day(4), Before: 7, After: 2},
+	}
+
+	cases := []struct {
+		name      string
+		method    Method
+		movements []Movement
+		fallback  *Price
+		from      time.Time
+		want      Valuation
+	}{
+		{"fifo across layers", FIFO, layers, nil, day(1),
+			Valuation{Quantity: 5, Value: 15, UnitCost: 3, ConsumedQuantity: 15, ConsumedCost: 35}},
+		{"average across layers", WeightedAverage, layers, nil, day(1),
+			Valuation{Quantity: 5, Value: 12.5, UnitCost: 2.5, ConsumedQuantity: 15, ConsumedCost: 37.5}},
+		{"fifo partial layers", FIFO, partial, nil, day(1),
+			Valuation{Quantity: 2, Value: 4, UnitCost: 2, ConsumedQuantity: 8, ConsumedCost: 12}},
+		{"average partial layers", WeightedAverage, partial, nil, day(1),
+			Valuation{Quantity: 2, Value: 3.2, UnitCost: 1.6, ConsumedQuantity: 8, ConsumedCost: 12.8}},
+		{"issue before the period", FIFO, partial, nil, day(4),
+			Valuation{Quantity: 2, Value: 4, UnitCost: 2, ConsumedQuantity: 5, ConsumedCost: 9}},
+		{"receipt without a cost", FIFO, []Movement{
+			{Action: "RECEIVE", Time: day(1), Before: 0, After: 10, UnitCost: cost(2)},
+			{Action: "RECEIVE", Time: day(2), Before: 10, After: 15},
+		}, &Price{Amount: 7}, day(1), Valuation{Quantity: 15, Value: 30, UnitCost: 2, UncostedReceipts: 1}},
+		{"stock from before the history", WeightedAverage, []Movement{
+			{Action: "UPDATE", Time: day(1), Before: 5, After: 5},
+			{Action: "RECEIVE", Time: day(2), Before: 5, After: 10, UnitCost: cost(6)},
+		}, &Price{Amount: 4}, day(1), Valuation{Quantity: 10, Value: 50, UnitCost: 5, UncostedReceipts: 1}},
+		{"deletion", FIFO, []Movement{
+			{Action: "RECEIVE", Time: day(1), Before: 0, After: 10, UnitCost: cost(2)},
+			{Action: "DELETE", Time: day(2), Before: 10, After: 0},
+		}, nil, day(1), Valuation{}},
+	}
+	same := NewRateTable("RUB", nil).To("RUB")
+	for _, c := range cases {
+		got, err := Value(c.method, c.movements, c.fallback, c.from, day(10), same)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+		} else if got != c.want {
+			t.Errorf("%s: Value = %+v, want %+v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestParseMethod(t *testing.T) {
+	cases := []struct {
+		s      string
+		method Method
+		ok     bool
+	}{
+		{"", FIFO, true},
+		{"fifo", FIFO, true},
+		{"average", WeightedAverage, true},
+		{"lifo", "", false},
+	}
+	for _, c := range cases {
+		method, ok := ParseMethod(c.s)
+		if method != c.method || ok != c.ok {
+			t.Errorf("ParseMethod(%q) = %q, %v, want %q, %v", c.s, method, ok, c.method, c.ok)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package inventory
+
+import (
+	"fmt"
+	"time"
+
+	"app/model"
+
+	"gorm.io/gorm"
+)
+
+// Discrepancy is a place where the history of a resource does not add up
+type Discrepancy struct {
+	ResourceID uint
+	Name       string
+	HistoryID  uint // Entry that does not start where the previous one ended, 0 for the current quantity
+	Expected   int
+	Found      int
+}
+
+func (d Discrepancy) String() string {
+	if d.HistoryID == 0 {
+		return fmt.Sprintf("resource %d '%s': quantity is %d, history ends at %d", d.ResourceID, d.Name, d.Found, d.Expected)
+	}
+	return fmt.Sprintf("resource %d '%s': entry %d starts at %d, previous entry ended at %d",
+		d.ResourceID, d.Name, d.HistoryID, d.Found, d.Expected)
+}
+
+// Verify replays the history of every resource in the organization of the
+// context of db. Each change must start from the quantity the previous one
+// left, and the last one must leave the current quantity of the resource.
+// Resources without history are not checked.
+func Verify(db *gorm.DB) ([]Discrepancy, error) {
+	movements, err := LoadMovements(db, time.Now().Add(time.Minute))
+	if err != nil {
+		return nil, err
+	}
+
+	var resources []model.Resource
+	if err := db.Unscoped().Order("id").Find(&resources).Error; err != nil {
+		return nil, err
+	}
+
+	var found []Discrepancy
+	for _, r := range resources {
+		list := movements[r.ID]
+		if len(list) == 0 {
+			continue
+		}
+		for i := 1; i < len(list); i++ {
+			if list[i].Before != list[i-1].After {
+				found = append(found, Discrepancy{
+					ResourceID: r.ID, Name: r.Name, HistoryID: list[i].HistoryID,
+					Expected: list[i-1].After, Found: list[i].Before,
+				})
+			}
+		}
+		// A deleted resource keeps its last quantity while its history ends at zero
+		if last := list[len(list)-1]; !r.DeletedAt.Valid && last.After != r.Quantity {
+			found = append(found, Discrepancy{ResourceID: r.ID, Name: r.Name, Expected: last.After, Found: r.Quantity})
+		}
+	}
+	return found, nil
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"app/apikey"
+	"app/database"
+	"app/model"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// AdminOnly allows only users with the admin role, and API keys with the admin
+// scope of such users; it must run after Protected. After Tenant, the admins
+// of the organization of the request are allowed too.
+// The role is read from the database so that demoted users lose access at once.
+func AdminOnly() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token, ok := c.Locals("user").(*jwt.Token)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).
+				JSON(fiber.Map{"status": "error", "message": "Missing or malformed JWT", "data": nil})
+		}
+		claims := token.Claims.(jwt.MapClaims)
+		userID, _ := claims["user_id"].(float64)
+		if scopes, ok := claims["scopes"].(string); ok && !apikey.Has(scopes, apikey.ScopeAdmin) {
+			return c.Status(fiber.StatusForbidden).
+				JSON(fiber.Map{"status": "error", "message": "API key scope does not allow this request", "data": nil})
+		}
+
+		if role, _ := c.Locals("organization_role").(string); role == model.RoleAdmin {
+			return c.Next()
+		}
+
+		var user model.User
+		if err := database.DB.First(&user, uint(userID)).Error; err != nil || user.Role != model.RoleAdmin {
+			return c.Status(fiber.StatusForbidden).
+				JSON(fiber.Map{"status": "error", "message": "Admin role required", "data": nil})
+		}
+		return c.Next()
+	}
+}
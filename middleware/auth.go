@@ -1,25 +1,100 @@
 package middleware
 
 import (
-	"app/config"
+	"errors"
+	"log"
+	"strings"
+
+	"app/apikey"
+	"app/database"
+	"app/signing"
 
 	jwtware "github.com/gofiber/contrib/jwt"
 	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
 )
 
-// Protected protect routes
+// Protected protect routes; tokens are verified with any non-retired signing
+// key. An API key, in the X-API-Key header or as bearer token, is accepted
+// instead when its scopes allow the request.
 func Protected() fiber.Handler {
-	return jwtware.New(jwtware.Config{
-		SigningKey:   jwtware.SigningKey{Key: []byte(config.Config("SECRET"))},
+	verifyJWT := jwtware.New(jwtware.Config{
+		KeyFunc:      signing.Keyfunc,
 		ErrorHandler: jwtError,
 	})
+	return func(c *fiber.Ctx) error {
+		if key := requestAPIKey(c); key != "" {
+			return apiKeyAuth(c, key)
+		}
+		return verifyJWT(c)
+	}
 }
 
 func jwtError(c *fiber.Ctx, err error) error {
-	if err.Error() == "Missing or malformed JWT" {
+	if errors.Is(err, jwtware.ErrJWTMissingOrMalformed) {
 		return c.Status(fiber.StatusBadRequest).
 			JSON(fiber.Map{"status": "error", "message": "Missing or malformed JWT", "data": nil})
 	}
 	return c.Status(fiber.StatusUnauthorized).
 		JSON(fiber.Map{"status": "error", "message": "Invalid or expired JWT", "data": nil})
 }
+
+// SessionOnly refuses requests authenticated with an API key, so that a leaked
+// key cannot mint further keys; it must run after Protected
+func SessionOnly() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if token, ok := c.Locals("user").(*jwt.Token); ok {
+			if _, isKey := token.Claims.(jwt.MapClaims)["api_key_id"]; !isKey {
+				return c.Next()
+			}
+		}
+		return c.Status(fiber.StatusForbidden).
+			JSON(fiber.Map{"status": "error", "message": "A session token is required", "data": nil})
+	}
+}
+
+// requestAPIKey returns the API key of the request, if any
+func requestAPIKey(c *fiber.Ctx) string {
+	if key := c.Get("X-API-Key"); key != "" {
+		return key
+	}
+	auth := c.Get(fiber.HeaderAuthorization)
+	if token, ok := strings.CutPrefix(auth, "Bearer "); ok && apikey.Looks(token) {
+		return token
+	}
+	return ""
+}
+
+// apiKeyAuth authenticates the request as the owner of the key. Handlers see
+// the same claims as for a session token, plus api_key_id and scopes; org_id
+// is only set for keys bound to an organization.
+func apiKeyAuth(c *fiber.Ctx, key string) error {
+	apiKey, owner, err := apikey.Authenticate(database.DB, key)
+	if errors.Is(err, apikey.ErrInvalidKey) {
+		return c.Status(fiber.StatusUnauthorized).
+			JSON(fiber.Map{"status": "error", "message": "Invalid or expired API key", "data": nil})
+	}
+	if err != nil {
+		log.Println("❌ Cannot check API key:", err)
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"status": "error", "message": "Internal Server Error", "data": nil})
+	}
+	if !apikey.Has(apiKey.Scopes, apikey.MethodScope(c.Method())) {
+		return c.Status(fiber.StatusForbidden).
+			JSON(fiber.Map{"status": "error", "message": "API key scope does not allow this request", "data": nil})
+	}
+
+	// Numbers are float64 as in claims decoded from a JWT
+	claims := jwt.MapClaims{
+		"username":   owner.Username,
+		"user_id":    float64(owner.ID),
+		"role":       owner.Role,
+		"api_key_id": float64(apiKey.ID),
+		"scopes":     apiKey.Scopes,
+	}
+	if apiKey.OrganizationID != nil {
+		claims["org_id"] = float64(*apiKey.OrganizationID)
+	}
+	c.Locals("user", &jwt.Token{Valid: true, Claims: claims})
+	return c.Next()
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"app/database"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// pingTimeout bounds the check made after a failed request
+const pingTimeout = time.Second
+
+// Database answers 503 Service Unavailable, with a Retry-After header, when a
+// request fails while the database is down, instead of the 500 or the panic
+// of the handler. Clients can then tell an outage from a bug and retry later.
+// It must run before the recover middleware so that it sees panics as errors.
+func Database() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		err := c.Next()
+		if err == nil && c.Response().StatusCode() < fiber.StatusInternalServerError {
+			return nil
+		}
+		var e *fiber.Error
+		if errors.As(err, &e) && e.Code < fiber.StatusInternalServerError {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+		defer cancel()
+		if database.Ping(ctx) == nil {
+			return err
+		}
+		c.Set(fiber.HeaderRetryAfter, "5")
+		return c.Status(fiber.StatusServiceUnavailable).
+			JSON(fiber.Map{"status": "error", "message": "Database unavailable, try again later", "data": nil})
+	}
+}
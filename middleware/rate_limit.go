@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"app/database"
+	"app/ratelimit"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RateLimit allows max requests per window from one client IP on the routes
+// it guards. Counters are shared by all prefork processes; if the store is
+// unavailable requests are let through.
+func RateLimit(name string, max int, window time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		hits, resetAt, err := ratelimit.Shared(database.DB).Incr("ip:"+name+":"+c.IP(), window)
+		if err != nil {
+			log.Println("❌ Rate limit store failed:", err)
+			return c.Next()
+		}
+
+		remaining := max - hits
+		if remaining < 0 {
+			remaining = 0
+		}
+		c.Set("X-RateLimit-Limit", strconv.Itoa(max))
+		c.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		if hits > max {
+			c.Set(fiber.HeaderRetryAfter, ratelimit.RetryAfter(time.Until(resetAt)))
+			return c.Status(fiber.StatusTooManyRequests).
+				JSON(fiber.Map{"status": "error", "message": "Too many requests, try again later", "data": nil})
+		}
+		return c.Next()
+	}
+}
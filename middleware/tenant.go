@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"errors"
+	"log"
+
+	"app/database"
+	"app/model"
+	"app/tenant"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Tenant resolves the organization the request acts in: the org_id claim of
+// the token, or the user's default organization for tokens without one. The
+// organization is put in the user context, which handlers pass to their
+// queries, and the caller's role there in the "organization_role" local.
+// It must run after Protected.
+func Tenant() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token, ok := c.Locals("user").(*jwt.Token)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).
+				JSON(fiber.Map{"status": "error", "message": "Missing or malformed JWT", "data": nil})
+		}
+		claims := token.Claims.(jwt.MapClaims)
+		userID, _ := claims["user_id"].(float64)
+		organizationID, _ := claims["org_id"].(float64)
+
+		var user model.User
+		if err := database.DB.First(&user, uint(userID)).Error; err != nil {
+			return c.Status(fiber.StatusUnauthorized).
+				JSON(fiber.Map{"status": "error", "message": "Invalid or expired JWT", "data": nil})
+		}
+		member, err := tenant.Resolve(database.DB, user, uint(organizationID))
+		if errors.Is(err, tenant.ErrNotMember) {
+			return c.Status(fiber.StatusForbidden).
+				JSON(fiber.Map{"status": "error", "message": "Organization membership required", "data": nil})
+		}
+		if err != nil {
+			log.Println("❌ Cannot resolve organization:", err)
+			return c.Status(fiber.StatusInternalServerError).
+				JSON(fiber.Map{"status": "error", "message": "Internal Server Error", "data": nil})
+		}
+
+		c.Locals("organization_id", member.OrganizationID)
+		c.Locals("organization_role", member.Role)
+		c.SetUserContext(tenant.WithOrganization(c.UserContext(), member.OrganizationID))
+		return c.Next()
+	}
+}
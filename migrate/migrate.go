@@ -0,0 +1,457 @@
+// Package migrate applies the versioned SQL migrations embedded in the binary.
+// Migrations are files named <version>_<name>.up.sql with an optional
+// <version>_<name>.down.sql, in one directory per database: sql/postgres and
+// sql/sqlite hold the same versions. Applied versions are recorded in the
+// schema_migrations table with the checksum of their up file. On Postgres an
+// advisory lock keeps concurrent processes from migrating at the same time;
+// a SQLite database is only migrated by the process that opens it.
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed sql/postgres/*.sql sql/sqlite/*.sql
+var files embed.FS
+
+// lockID identifies the advisory lock held while migrating
+const lockID = 7_140_211
+
+// table records the applied migrations
+const table = "schema_migrations"
+
+var (
+	ErrChecksumMismatch = errors.New("migrate: applied migration was changed")
+	ErrUnknownVersion   = errors.New("migrate: applied migration is not in this build")
+	ErrNoDown           = errors.New("migrate: migration cannot be reverted")
+	ErrUnknownDialect   = errors.New("migrate: no migrations for this database")
+)
+
+// dialect holds what differs between the databases
+type dialect struct {
+	dir           string
+	numbered      bool   // Placeholders are $1, $2… rather than ?
+	lock, unlock  string // Empty when the database needs no lock
+	tableExists   string // Query with one placeholder, the table name
+	timestampType string
+}
+
+var dialects = map[string]dialect{
+	"postgres": {
+		dir:           "sql/postgres",
+		numbered:      true,
+		lock:          "SELECT pg_advisory_lock($1)",
+		unlock:        "SELECT pg_advisory_unlock($1)",
+		tableExists:   "SELECT to_regclass($1) IS NOT NULL",
+		timestampType: "timestamptz",
+	},
+	"sqlite": {
+		dir:           "sql/sqlite",
+		tableExists:   "SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = ?)",
+		timestampType: "datetime",
+	},
+}
+
+// bind numbers the ? placeholders of a query for databases that need it
+func (d dialect) bind(query string) string {
+	if !d.numbered {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			fmt.Fprintf(&b, "$%d", n)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func dialectOf(db *gorm.DB) (dialect, error) {
+	d, ok := dialects[db.Dialector.Name()]
+	if !ok {
+		return d, fmt.Errorf("%w: %s", ErrUnknownDialect, db.Dialector.Name())
+	}
+	return d, nil
+}
+
+// Migration is one version of the schema
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string // Empty when the migration cannot be reverted
+	Checksum string // SHA-256 of Up
+}
+
+// State is a migration and whether it is applied
+type State struct {
+	Migration
+	AppliedAt *time.Time
+	Changed   bool // The applied checksum differs from this build
+}
+
+var filePattern = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migrations returns the embedded migrations of a database, "postgres" or
+// "sqlite", ordered by version
+func Migrations(database string) ([]Migration, error) {
+	d, ok := dialects[database]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownDialect, database)
+	}
+	entries, err := fs.ReadDir(files, d.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := filePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migrate: unexpected file %s", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		content, err := files.ReadFile(d.dir + "/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migrate: version %d has two names, %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			sum := sha256.Sum256(content)
+			m.Up, m.Checksum = string(content), hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migrate: version %d has no up file", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// applied is a row of the migrations table
+type applied struct {
+	checksum  string
+	appliedAt time.Time
+}
+
+// Up applies the pending migrations in order and returns them. A database
+// created before versioned migrations (it has tables but no migrations table)
+// is recorded as being at version 1, the schema of that time, without running
+// it; the later versions then add everything since.
+func Up(db *gorm.DB) ([]Migration, error) {
+	d, err := dialectOf(db)
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := Migrations(db.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	err = withLock(db, d, func(ctx context.Context, conn *sql.Conn) error {
+		if err := baseline(ctx, conn, d, migrations[0]); err != nil {
+			return err
+		}
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := verify(migrations, versions); err != nil {
+			return err
+		}
+
+		for _, m := range migrations {
+			if _, ok := versions[m.Version]; ok {
+				continue
+			}
+			err := inTransaction(ctx, conn, func(tx *sql.Tx) error {
+				if _, err := tx.ExecContext(ctx, m.Up); err != nil {
+					return fmt.Errorf("migrate: %d_%s: %w", m.Version, m.Name, err)
+				}
+				_, err := tx.ExecContext(ctx,
+					d.bind("INSERT INTO "+table+" (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)"),
+					m.Version, m.Name, m.Checksum, time.Now())
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			done = append(done, m)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down reverts the last steps applied migrations, newest first, and returns them
+func Down(db *gorm.DB, steps int) ([]Migration, error) {
+	d, err := dialectOf(db)
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := Migrations(db.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	err = withLock(db, d, func(ctx context.Context, conn *sql.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := verify(migrations, versions); err != nil {
+			return err
+		}
+
+		for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			m := migrations[i]
+			if _, ok := versions[m.Version]; !ok {
+				continue
+			}
+			if m.Down == "" {
+				return fmt.Errorf("%w: %d_%s has no down file", ErrNoDown, m.Version, m.Name)
+			}
+			err := inTransaction(ctx, conn, func(tx *sql.Tx) error {
+				if _, err := tx.ExecContext(ctx, m.Down); err != nil {
+					return fmt.Errorf("migrate: %d_%s: %w", m.Version, m.Name, err)
+				}
+				_, err := tx.ExecContext(ctx, d.bind("DELETE FROM "+table+" WHERE version = ?"), m.Version)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			done = append(done, m)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Status lists every migration, embedded or applied, ordered by version
+func Status(db *gorm.DB) ([]State, error) {
+	d, err := dialectOf(db)
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := Migrations(db.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	var states []State
+	err = withLock(db, d, func(ctx context.Context, conn *sql.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			state := State{Migration: m}
+			if a, ok := versions[m.Version]; ok {
+				state.AppliedAt = &a.appliedAt
+				state.Changed = a.checksum != m.Checksum
+				delete(versions, m.Version)
+			}
+			states = append(states, state)
+		}
+		// Versions applied by a newer build
+		for version, a := range versions {
+			states = append(states, State{Migration: Migration{Version: version}, AppliedAt: &a.appliedAt})
+		}
+		return nil
+	})
+	sort.Slice(states, func(i, j int) bool { return states[i].Version < states[j].Version })
+	return states, err
+}
+
+// Pending returns the migrations of this build the database has not applied.
+// Unlike Status it neither takes the lock nor creates the migrations table, so
+// it answers at once while another process migrates.
+func Pending(ctx context.Context, db *gorm.DB) ([]Migration, error) {
+	d, err := dialectOf(db)
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := Migrations(db.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var exists bool
+	if err := conn.QueryRowContext(ctx, d.tableExists, table).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return migrations, nil
+	}
+	versions, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, m := range migrations {
+		if _, ok := versions[m.Version]; !ok {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// withLock runs fn on one connection holding the advisory lock, if the
+// database has one, after creating the migrations table if needed
+func withLock(db *gorm.DB, d dialect, fn func(ctx context.Context, conn *sql.Conn) error) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if d.lock != "" {
+		if _, err := conn.ExecContext(ctx, d.lock, lockID); err != nil {
+			return err
+		}
+		defer func() {
+			if _, err := conn.ExecContext(ctx, d.unlock, lockID); err != nil {
+				log.Println("❌ Cannot release the migration lock:", err)
+			}
+		}()
+	}
+
+	if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+table+` (
+		version bigint PRIMARY KEY,
+		name varchar(255) NOT NULL,
+		checksum varchar(64) NOT NULL,
+		applied_at `+d.timestampType+` NOT NULL
+	)`); err != nil {
+		return err
+	}
+	return fn(ctx, conn)
+}
+
+// baseline records the first migration as applied when its tables already
+// exist but nothing was ever recorded, as in databases set up by AutoMigrate.
+// Only the first migration is recorded: it is exactly the schema AutoMigrate
+// created, and the following ones still have to run.
+func baseline(ctx context.Context, conn *sql.Conn, d dialect, first Migration) error {
+	var recorded bool
+	if err := conn.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM "+table+")").Scan(&recorded); err != nil {
+		return err
+	}
+	var existing bool
+	if err := conn.QueryRowContext(ctx, d.tableExists, "users").Scan(&existing); err != nil {
+		return err
+	}
+	if recorded || !existing {
+		return nil
+	}
+
+	_, err := conn.ExecContext(ctx,
+		d.bind("INSERT INTO "+table+" (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)"),
+		first.Version, first.Name, first.Checksum, time.Now())
+	if err == nil {
+		log.Printf("✅ Existing schema recorded as migration %d_%s", first.Version, first.Name)
+	}
+	return err
+}
+
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int]applied, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, checksum, applied_at FROM "+table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := map[int]applied{}
+	for rows.Next() {
+		var (
+			version int
+			a       applied
+		)
+		if err := rows.Scan(&version, &a.checksum, &a.appliedAt); err != nil {
+			return nil, err
+		}
+		versions[version] = a
+	}
+	return versions, rows.Err()
+}
+
+// verify refuses to migrate a database whose applied migrations differ from
+// the ones in this build
+func verify(migrations []Migration, versions map[int]applied) error {
+	known := map[int]Migration{}
+	for _, m := range migrations {
+		known[m.Version] = m
+	}
+	for version, a := range versions {
+		m, ok := known[version]
+		if !ok {
+			return fmt.Errorf("%w: version %d", ErrUnknownVersion, version)
+		}
+		if m.Checksum != a.checksum {
+			return fmt.Errorf("%w: %d_%s", ErrChecksumMismatch, m.Version, m.Name)
+		}
+	}
+	return nil
+}
+
+func inTransaction(ctx context.Context, conn *sql.Conn, fn func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,160 @@
+package migrate_test
+
+import (
+	"fmt"
+	"testing"
+
+	"app/migrate"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var databases int
+
+// open returns a new in-memory SQLite database enforcing foreign keys
+func open(t *testing.T) *gorm.DB {
+	t.Helper()
+	databases++
+	dsn := fmt.Sprintf("file:migrate%d?mode=memory&cache=shared&_pragma=foreign_keys(1)", databases)
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	return db
+}
+
+// versions lists the versions of migrations
+func versions(migrations []migrate.Migration) []int {
+	var v []int
+	for _, m := range migrations {
+		v = append(v, m.Version)
+	}
+	return v
+}
+
+func TestUpFromBaseline(t *testing.T) {
+	db := open(t)
+	migrations, err := migrate.Migrations("sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A database set up before versioned migrations: the tables of the first
+	// migration with data, but nothing recorded
+	if err := db.Exec(migrations[0].Up).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, query := range []string{
+		`INSERT INTO users (username, email, password) VALUES ('alice', 'alice@example.com', 'hash')`,
+		`INSERT INTO resources (name, unit, quantity) VALUES ('Бумага', 'пачка', 10)`,
+		`INSERT INTO resource_histories (resource_id, action, user_id) VALUES (1, 'ADD', 1)`,
+	} {
+		if err := db.Exec(query).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	done, err := migrate.Up(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := versions(done); len(got) != len(migrations)-1 || got[0] != 2 {
+		t.Fatalf("applied %v, want every version after the first", got)
+	}
+	for _, table := range []string{"organizations", "memberships", "permission_grants", "stocktakes", "serial_items", "api_keys"} {
+		if !db.Migrator().HasTable(table) {
+			t.Errorf("no table %s", table)
+		}
+	}
+
+	// The data is kept and the new columns take their defaults
+	var user struct {
+		Username string
+		Role     string
+	}
+	if err := db.Raw("SELECT username, role FROM users").Scan(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != "alice" || user.Role != "user" {
+		t.Fatalf("user after the upgrade %+v", user)
+	}
+	var histories int
+	if err := db.Raw("SELECT COUNT(*) FROM resource_histories WHERE organization_id = 0").Scan(&histories).Error; err != nil {
+		t.Fatal(err)
+	}
+	if histories != 1 {
+		t.Fatalf("%d histories after the upgrade, want 1", histories)
+	}
+
+	states, err := migrate.Status(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range states {
+		if s.AppliedAt == nil || s.Changed {
+			t.Errorf("migration %d_%s applied %v, changed %t", s.Version, s.Name, s.AppliedAt, s.Changed)
+		}
+	}
+}
+
+func TestDownAndUp(t *testing.T) {
+	db := open(t)
+	all, err := migrate.Up(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) < 2 {
+		t.Fatalf("applied %v on an empty database", versions(all))
+	}
+
+	// Every migration reverts to the schema of the one before
+	last := all[len(all)-1]
+	reverted, err := migrate.Down(db, len(all)-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reverted) != len(all)-1 || reverted[0].Version != last.Version {
+		t.Fatalf("reverted %v", versions(reverted))
+	}
+	if db.Migrator().HasTable("organizations") || db.Migrator().HasColumn("resources", "organization_id") {
+		t.Fatal("schema of later migrations left after reverting them")
+	}
+	if err := db.Exec(`INSERT INTO resources (name) VALUES ('Бумага'), ('Бумага')`).Error; err == nil {
+		t.Fatal("resource names are not unique again")
+	}
+
+	done, err := migrate.Up(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != len(all)-1 {
+		t.Fatalf("applied %v again, want %v", versions(done), versions(reverted))
+	}
+}
+
+func TestDatabasesHaveSameVersions(t *testing.T) {
+	onPostgres, err := migrate.Migrations("postgres")
+	if err != nil {
+		t.Fatal(err)
+	}
+	onSQLite, err := migrate.Migrations("sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(onPostgres) != len(onSQLite) {
+		t.Fatalf("postgres has %v, sqlite %v", versions(onPostgres), versions(onSQLite))
+	}
+	for i := range onPostgres {
+		p, s := onPostgres[i], onSQLite[i]
+		if p.Version != s.Version || p.Name != s.Name || (p.Down == "") != (s.Down == "") {
+			t.Errorf("postgres has %d_%s, sqlite %d_%s", p.Version, p.Name, s.Version, s.Name)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+-- Schema as created by GORM AutoMigrate before versioned migrations: only
+-- this migration is recorded for such databases, the following ones run.
+
+CREATE TABLE "users" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    "username" varchar(50) NOT NULL,
+    "email" varchar(255) NOT NULL,
+    "password" text NOT NULL,
+    "names" text,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_users_email" ON "users" ("email");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_users_username" ON "users" ("username");
+CREATE INDEX IF NOT EXISTS "idx_users_deleted_at" ON "users" ("deleted_at");
+
+CREATE TABLE "resources" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    "name" text NOT NULL,
+    "description" text,
+    "unit" text,
+    "quantity" bigint,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "uni_resources_name" UNIQUE ("name")
+);
+CREATE INDEX IF NOT EXISTS "idx_resources_deleted_at" ON "resources" ("deleted_at");
+
+CREATE TABLE "resource_histories" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    "resource_id" bigint NOT NULL,
+    "action" text NOT NULL,
+    "user_id" bigint NOT NULL,
+    "old_data" text,
+    "new_data" text,
+    "timestamp" timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "description" text,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_resource_histories_resource" FOREIGN KEY ("resource_id") REFERENCES "resources"("id") ON DELETE SET NULL ON UPDATE CASCADE,
+    CONSTRAINT "fk_resource_histories_user" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE SET NULL ON UPDATE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_resource_histories_deleted_at" ON "resource_histories" ("deleted_at");
@@ -0,0 +1,44 @@
+DROP TABLE IF EXISTS "memberships";
+DROP TABLE IF EXISTS "organizations";
+DROP TABLE IF EXISTS "permission_grants";
+DROP TABLE IF EXISTS "api_keys";
+DROP TABLE IF EXISTS "signing_keys";
+DROP TABLE IF EXISTS "rate_limits";
+DROP TABLE IF EXISTS "two_factor_policies";
+DROP TABLE IF EXISTS "recovery_codes";
+DROP TABLE IF EXISTS "user_tokens";
+DROP TABLE IF EXISTS "notification_preferences";
+DROP TABLE IF EXISTS "notifications";
+DROP TABLE IF EXISTS "generated_reports";
+DROP TABLE IF EXISTS "exchange_rates";
+DROP TABLE IF EXISTS "stocktake_counts";
+DROP TABLE IF EXISTS "stocktake_lines";
+DROP TABLE IF EXISTS "stocktakes";
+DROP TABLE IF EXISTS "serial_items";
+DROP TABLE IF EXISTS "lots";
+ALTER TABLE "resource_histories"
+    DROP COLUMN "organization_id",
+    DROP COLUMN "serial_item_id",
+    DROP COLUMN "unit_cost",
+    DROP COLUMN "currency",
+    DROP COLUMN "stocktake_id",
+    DROP COLUMN "api_key_id";
+ALTER TABLE "resources"
+    DROP CONSTRAINT IF EXISTS "fk_resources_group",
+    DROP COLUMN "organization_id",
+    DROP COLUMN "serialized",
+    DROP COLUMN "price",
+    DROP COLUMN "currency",
+    DROP COLUMN "group_id",
+    ADD CONSTRAINT "uni_resources_name" UNIQUE ("name");
+DROP TABLE IF EXISTS "resource_groups";
+DROP INDEX IF EXISTS "idx_users_oidc";
+ALTER TABLE "users"
+    DROP COLUMN "role",
+    DROP COLUMN "service_account",
+    DROP COLUMN "email_verified_at",
+    DROP COLUMN "totp_secret",
+    DROP COLUMN "totp_enabled_at",
+    DROP COLUMN "totp_last_step",
+    DROP COLUMN "oidc_issuer",
+    DROP COLUMN "oidc_subject";
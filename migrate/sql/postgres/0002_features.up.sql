@@ -0,0 +1,309 @@
+-- Everything added since the schema of 0001: new columns of the existing
+-- tables and the tables of the features built on them.
+
+ALTER TABLE "users"
+    ADD COLUMN "role" varchar(20) NOT NULL DEFAULT 'user',
+    ADD COLUMN "service_account" boolean NOT NULL DEFAULT false,
+    ADD COLUMN "email_verified_at" timestamptz,
+    ADD COLUMN "totp_secret" varchar(64),
+    ADD COLUMN "totp_enabled_at" timestamptz,
+    ADD COLUMN "totp_last_step" bigint NOT NULL DEFAULT 0,
+    ADD COLUMN "oidc_issuer" varchar(255),
+    ADD COLUMN "oidc_subject" varchar(255);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_users_oidc" ON "users" ("oidc_issuer","oidc_subject");
+
+CREATE TABLE "resource_groups" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "organization_id" bigint NOT NULL DEFAULT 0,
+    "name" varchar(100) NOT NULL,
+    "description" text,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_resource_groups_org_name" ON "resource_groups" ("organization_id","name");
+
+-- Names are unique within an organization instead of across the database
+ALTER TABLE "resources" DROP CONSTRAINT IF EXISTS "uni_resources_name";
+ALTER TABLE "resources"
+    ADD COLUMN "organization_id" bigint NOT NULL DEFAULT 0,
+    ADD COLUMN "serialized" boolean,
+    ADD COLUMN "price" decimal,
+    ADD COLUMN "currency" varchar(3),
+    ADD COLUMN "group_id" bigint,
+    ADD CONSTRAINT "fk_resources_group" FOREIGN KEY ("group_id") REFERENCES "resource_groups"("id") ON DELETE SET NULL ON UPDATE CASCADE;
+CREATE INDEX IF NOT EXISTS "idx_resources_group_id" ON "resources" ("group_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_resources_org_name" ON "resources" ("organization_id","name");
+
+ALTER TABLE "resource_histories"
+    ADD COLUMN "organization_id" bigint NOT NULL DEFAULT 0,
+    ADD COLUMN "serial_item_id" bigint,
+    ADD COLUMN "unit_cost" decimal,
+    ADD COLUMN "currency" varchar(3),
+    ADD COLUMN "stocktake_id" bigint,
+    ADD COLUMN "api_key_id" bigint;
+CREATE INDEX IF NOT EXISTS "idx_resource_histories_api_key_id" ON "resource_histories" ("api_key_id");
+CREATE INDEX IF NOT EXISTS "idx_resource_histories_stocktake_id" ON "resource_histories" ("stocktake_id");
+CREATE INDEX IF NOT EXISTS "idx_resource_histories_serial_item_id" ON "resource_histories" ("serial_item_id");
+CREATE INDEX IF NOT EXISTS "idx_resource_histories_organization_id" ON "resource_histories" ("organization_id");
+
+CREATE TABLE "lots" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    "organization_id" bigint NOT NULL DEFAULT 0,
+    "resource_id" bigint NOT NULL,
+    "lot_number" varchar(100),
+    "initial_quantity" bigint NOT NULL,
+    "quantity" bigint NOT NULL,
+    "received_at" timestamptz NOT NULL,
+    "expires_at" timestamptz,
+    "certificate" varchar(255),
+    "unit_cost" decimal,
+    "currency" varchar(3),
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_lots_resource" FOREIGN KEY ("resource_id") REFERENCES "resources"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_lots_expires_at" ON "lots" ("expires_at");
+CREATE INDEX IF NOT EXISTS "idx_lots_resource_id" ON "lots" ("resource_id");
+CREATE INDEX IF NOT EXISTS "idx_lots_organization_id" ON "lots" ("organization_id");
+CREATE INDEX IF NOT EXISTS "idx_lots_deleted_at" ON "lots" ("deleted_at");
+
+CREATE TABLE "serial_items" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    "organization_id" bigint NOT NULL DEFAULT 0,
+    "resource_id" bigint NOT NULL,
+    "serial_number" varchar(100) NOT NULL,
+    "inventory_number" varchar(100),
+    "status" varchar(20) NOT NULL DEFAULT 'in_stock',
+    "assignee_id" bigint,
+    "note" text,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_serial_items_resource" FOREIGN KEY ("resource_id") REFERENCES "resources"("id") ON DELETE CASCADE ON UPDATE CASCADE,
+    CONSTRAINT "fk_serial_items_assignee" FOREIGN KEY ("assignee_id") REFERENCES "users"("id") ON DELETE SET NULL ON UPDATE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_serial_items_assignee_id" ON "serial_items" ("assignee_id");
+CREATE INDEX IF NOT EXISTS "idx_serial_items_inventory_number" ON "serial_items" ("inventory_number");
+CREATE INDEX IF NOT EXISTS "idx_serial_items_resource_id" ON "serial_items" ("resource_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_serial_items_org_serial" ON "serial_items" ("organization_id","serial_number");
+CREATE INDEX IF NOT EXISTS "idx_serial_items_organization_id" ON "serial_items" ("organization_id");
+CREATE INDEX IF NOT EXISTS "idx_serial_items_deleted_at" ON "serial_items" ("deleted_at");
+
+CREATE TABLE "stocktakes" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    "organization_id" bigint NOT NULL DEFAULT 0,
+    "status" varchar(20) NOT NULL DEFAULT 'open',
+    "note" text,
+    "opened_by_id" bigint NOT NULL,
+    "posted_by_id" bigint,
+    "closed_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_stocktakes_open" ON "stocktakes" ("organization_id") WHERE status = 'open';
+CREATE INDEX IF NOT EXISTS "idx_stocktakes_organization_id" ON "stocktakes" ("organization_id");
+CREATE INDEX IF NOT EXISTS "idx_stocktakes_deleted_at" ON "stocktakes" ("deleted_at");
+
+CREATE TABLE "stocktake_lines" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "stocktake_id" bigint NOT NULL,
+    "resource_id" bigint NOT NULL,
+    "expected_quantity" bigint NOT NULL,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_stocktake_lines_resource" FOREIGN KEY ("resource_id") REFERENCES "resources"("id") ON DELETE CASCADE ON UPDATE CASCADE,
+    CONSTRAINT "fk_stocktakes_lines" FOREIGN KEY ("stocktake_id") REFERENCES "stocktakes"("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_stocktake_line" ON "stocktake_lines" ("stocktake_id","resource_id");
+
+CREATE TABLE "stocktake_counts" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "stocktake_line_id" bigint NOT NULL,
+    "user_id" bigint NOT NULL,
+    "quantity" bigint NOT NULL,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_stocktake_lines_counts" FOREIGN KEY ("stocktake_line_id") REFERENCES "stocktake_lines"("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_stocktake_count" ON "stocktake_counts" ("stocktake_line_id","user_id");
+
+CREATE TABLE "exchange_rates" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "currency" varchar(3) NOT NULL,
+    "effective_date" timestamptz NOT NULL,
+    "rate" decimal NOT NULL,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_exchange_rate" ON "exchange_rates" ("currency","effective_date");
+
+CREATE TABLE "generated_reports" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "organization_id" bigint NOT NULL DEFAULT 0,
+    "format" varchar(10) NOT NULL,
+    "period_from" timestamptz NOT NULL,
+    "period_to" timestamptz NOT NULL,
+    "size" bigint,
+    "access_token" varchar(64),
+    "content" bytea NOT NULL,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_generated_reports_access_token" ON "generated_reports" ("access_token");
+CREATE INDEX IF NOT EXISTS "idx_generated_reports_organization_id" ON "generated_reports" ("organization_id");
+
+CREATE TABLE "notifications" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "user_id" bigint,
+    "kind" varchar(50) NOT NULL,
+    "to" varchar(255) NOT NULL,
+    "subject" text NOT NULL,
+    "body" text NOT NULL,
+    "status" varchar(20) NOT NULL DEFAULT 'pending',
+    "attempts" bigint NOT NULL DEFAULT 0,
+    "next_attempt_at" timestamptz NOT NULL,
+    "last_error" text,
+    "sent_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_notification_due" ON "notifications" ("status","next_attempt_at");
+CREATE INDEX IF NOT EXISTS "idx_notifications_user_id" ON "notifications" ("user_id");
+
+CREATE TABLE "notification_preferences" (
+    "user_id" bigint,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "language" varchar(2) NOT NULL,
+    "stock_changes" boolean NOT NULL,
+    "stock_change_threshold" bigint NOT NULL,
+    "account_events" boolean NOT NULL,
+    PRIMARY KEY ("user_id")
+);
+
+CREATE TABLE "user_tokens" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "user_id" bigint NOT NULL,
+    "purpose" varchar(30) NOT NULL,
+    "token_hash" varchar(64) NOT NULL,
+    "expires_at" timestamptz NOT NULL,
+    "used_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_user_tokens_user" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_user_tokens_token_hash" ON "user_tokens" ("token_hash");
+CREATE INDEX IF NOT EXISTS "idx_user_tokens_user_id" ON "user_tokens" ("user_id");
+
+CREATE TABLE "recovery_codes" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "user_id" bigint NOT NULL,
+    "code_hash" varchar(64) NOT NULL,
+    "used_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_recovery_codes_user" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_recovery_codes_code_hash" ON "recovery_codes" ("code_hash");
+CREATE INDEX IF NOT EXISTS "idx_recovery_codes_user_id" ON "recovery_codes" ("user_id");
+
+CREATE TABLE "two_factor_policies" (
+    "role" varchar(20),
+    "updated_at" timestamptz,
+    "required" boolean NOT NULL,
+    PRIMARY KEY ("role")
+);
+
+CREATE TABLE "rate_limits" (
+    "bucket" varchar(255),
+    "hits" bigint NOT NULL,
+    "expires_at" timestamptz NOT NULL,
+    PRIMARY KEY ("bucket")
+);
+CREATE INDEX IF NOT EXISTS "idx_rate_limits_expires_at" ON "rate_limits" ("expires_at");
+
+CREATE TABLE "signing_keys" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "kid" varchar(64) NOT NULL,
+    "algorithm" varchar(10) NOT NULL,
+    "private_key" text NOT NULL,
+    "public_key" text NOT NULL,
+    "rotated_at" timestamptz,
+    "retires_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_signing_keys_retires_at" ON "signing_keys" ("retires_at");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_signing_keys_kid" ON "signing_keys" ("kid");
+
+CREATE TABLE "api_keys" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "user_id" bigint NOT NULL,
+    "name" varchar(100) NOT NULL,
+    "prefix" varchar(16) NOT NULL,
+    "key_hash" varchar(64) NOT NULL,
+    "scopes" varchar(100) NOT NULL,
+    "organization_id" bigint,
+    "expires_at" timestamptz,
+    "last_used_at" timestamptz,
+    "revoked_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_api_keys_user" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_api_keys_revoked_at" ON "api_keys" ("revoked_at");
+CREATE INDEX IF NOT EXISTS "idx_api_keys_organization_id" ON "api_keys" ("organization_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_api_keys_key_hash" ON "api_keys" ("key_hash");
+CREATE INDEX IF NOT EXISTS "idx_api_keys_user_id" ON "api_keys" ("user_id");
+
+CREATE TABLE "permission_grants" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "organization_id" bigint NOT NULL DEFAULT 0,
+    "user_id" bigint,
+    "role" varchar(20),
+    "action" varchar(20) NOT NULL,
+    "group_id" bigint,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_permission_grants_user" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE ON UPDATE CASCADE,
+    CONSTRAINT "fk_permission_grants_group" FOREIGN KEY ("group_id") REFERENCES "resource_groups"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_permission_grants_group_id" ON "permission_grants" ("group_id");
+CREATE INDEX IF NOT EXISTS "idx_permission_grants_role" ON "permission_grants" ("role");
+CREATE INDEX IF NOT EXISTS "idx_permission_grants_user_id" ON "permission_grants" ("user_id");
+CREATE INDEX IF NOT EXISTS "idx_permission_grants_organization_id" ON "permission_grants" ("organization_id");
+
+CREATE TABLE "organizations" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "name" varchar(100) NOT NULL,
+    "slug" varchar(50) NOT NULL,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_organizations_slug" ON "organizations" ("slug");
+
+CREATE TABLE "memberships" (
+    "id" bigserial,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "user_id" bigint NOT NULL,
+    "organization_id" bigint NOT NULL,
+    "role" varchar(20) NOT NULL DEFAULT 'user',
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_memberships_user" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE ON UPDATE CASCADE,
+    CONSTRAINT "fk_memberships_organization" FOREIGN KEY ("organization_id") REFERENCES "organizations"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_memberships_organization_id" ON "memberships" ("organization_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_memberships_user_org" ON "memberships" ("user_id","organization_id");
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS "resource_histories";
+DROP TABLE IF EXISTS "resources";
+DROP TABLE IF EXISTS "users";
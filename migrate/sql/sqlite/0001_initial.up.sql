@@ -0,0 +1,46 @@
+-- Schema of the Postgres migration of the same version, in SQLite types. The
+-- unique name of resources is an index, since SQLite cannot drop a constraint.
+
+CREATE TABLE "users" (
+    "id" integer PRIMARY KEY AUTOINCREMENT,
+    "created_at" datetime,
+    "updated_at" datetime,
+    "deleted_at" datetime,
+    "username" text NOT NULL,
+    "email" text NOT NULL,
+    "password" text NOT NULL,
+    "names" text
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_users_email" ON "users" ("email");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_users_username" ON "users" ("username");
+CREATE INDEX IF NOT EXISTS "idx_users_deleted_at" ON "users" ("deleted_at");
+
+CREATE TABLE "resources" (
+    "id" integer PRIMARY KEY AUTOINCREMENT,
+    "created_at" datetime,
+    "updated_at" datetime,
+    "deleted_at" datetime,
+    "name" text NOT NULL,
+    "description" text,
+    "unit" text,
+    "quantity" integer
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "uni_resources_name" ON "resources" ("name");
+CREATE INDEX IF NOT EXISTS "idx_resources_deleted_at" ON "resources" ("deleted_at");
+
+CREATE TABLE "resource_histories" (
+    "id" integer PRIMARY KEY AUTOINCREMENT,
+    "created_at" datetime,
+    "updated_at" datetime,
+    "deleted_at" datetime,
+    "resource_id" integer NOT NULL,
+    "action" text NOT NULL,
+    "user_id" integer NOT NULL,
+    "old_data" text,
+    "new_data" text,
+    "timestamp" datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "description" text,
+    CONSTRAINT "fk_resource_histories_resource" FOREIGN KEY ("resource_id") REFERENCES "resources"("id") ON DELETE SET NULL ON UPDATE CASCADE,
+    CONSTRAINT "fk_resource_histories_user" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE SET NULL ON UPDATE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_resource_histories_deleted_at" ON "resource_histories" ("deleted_at");
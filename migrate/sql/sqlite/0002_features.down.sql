@@ -0,0 +1,46 @@
+DROP TABLE IF EXISTS "memberships";
+DROP TABLE IF EXISTS "organizations";
+DROP TABLE IF EXISTS "permission_grants";
+DROP TABLE IF EXISTS "api_keys";
+DROP TABLE IF EXISTS "signing_keys";
+DROP TABLE IF EXISTS "rate_limits";
+DROP TABLE IF EXISTS "two_factor_policies";
+DROP TABLE IF EXISTS "recovery_codes";
+DROP TABLE IF EXISTS "user_tokens";
+DROP TABLE IF EXISTS "notification_preferences";
+DROP TABLE IF EXISTS "notifications";
+DROP TABLE IF EXISTS "generated_reports";
+DROP TABLE IF EXISTS "exchange_rates";
+DROP TABLE IF EXISTS "stocktake_counts";
+DROP TABLE IF EXISTS "stocktake_lines";
+DROP TABLE IF EXISTS "stocktakes";
+DROP TABLE IF EXISTS "serial_items";
+DROP TABLE IF EXISTS "lots";
+DROP INDEX IF EXISTS "idx_resource_histories_api_key_id";
+DROP INDEX IF EXISTS "idx_resource_histories_stocktake_id";
+DROP INDEX IF EXISTS "idx_resource_histories_serial_item_id";
+DROP INDEX IF EXISTS "idx_resource_histories_organization_id";
+ALTER TABLE "resource_histories" DROP COLUMN "organization_id";
+ALTER TABLE "resource_histories" DROP COLUMN "serial_item_id";
+ALTER TABLE "resource_histories" DROP COLUMN "unit_cost";
+ALTER TABLE "resource_histories" DROP COLUMN "currency";
+ALTER TABLE "resource_histories" DROP COLUMN "stocktake_id";
+ALTER TABLE "resource_histories" DROP COLUMN "api_key_id";
+DROP INDEX IF EXISTS "idx_resources_group_id";
+DROP INDEX IF EXISTS "idx_resources_org_name";
+ALTER TABLE "resources" DROP COLUMN "organization_id";
+ALTER TABLE "resources" DROP COLUMN "serialized";
+ALTER TABLE "resources" DROP COLUMN "price";
+ALTER TABLE "resources" DROP COLUMN "currency";
+ALTER TABLE "resources" DROP COLUMN "group_id";
+CREATE UNIQUE INDEX IF NOT EXISTS "uni_resources_name" ON "resources" ("name");
+DROP TABLE IF EXISTS "resource_groups";
+DROP INDEX IF EXISTS "idx_users_oidc";
+ALTER TABLE "users" DROP COLUMN "role";
+ALTER TABLE "users" DROP COLUMN "service_account";
+ALTER TABLE "users" DROP COLUMN "email_verified_at";
+ALTER TABLE "users" DROP COLUMN "totp_secret";
+ALTER TABLE "users" DROP COLUMN "totp_enabled_at";
+ALTER TABLE "users" DROP COLUMN "totp_last_step";
+ALTER TABLE "users" DROP COLUMN "oidc_issuer";
+ALTER TABLE "users" DROP COLUMN "oidc_subject";
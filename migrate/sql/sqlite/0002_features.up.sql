@@ -0,0 +1,290 @@
+-- Everything added since the schema of 0001: new columns of the existing
+-- tables and the tables of the features built on them. SQLite adds one
+-- column per statement.
+
+ALTER TABLE "users" ADD COLUMN "role" text NOT NULL DEFAULT 'user';
+ALTER TABLE "users" ADD COLUMN "service_account" numeric NOT NULL DEFAULT false;
+ALTER TABLE "users" ADD COLUMN "email_verified_at" datetime;
+ALTER TABLE "users" ADD COLUMN "totp_secret" text;
+ALTER TABLE "users" ADD COLUMN "totp_enabled_at" datetime;
+ALTER TABLE "users" ADD COLUMN "totp_last_step" integer NOT NULL DEFAULT 0;
+ALTER TABLE "users" ADD COLUMN "oidc_issuer" text;
+ALTER TABLE "users" ADD COLUMN "oidc_subject" text;
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_users_oidc" ON "users" ("oidc_issuer","oidc_subject");
+
+CREATE TABLE "resource_groups" (
+    "id" integer PRIMARY KEY AUTOINCREMENT,
+    "created_at" datetime,
+    "updated_at" datetime,
+    "organization_id" integer NOT NULL DEFAULT 0,
+    "name" text NOT NULL,
+    "description" text
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_resource_groups_org_name" ON "resource_groups" ("organization_id","name");
+
+-- Names are unique within an organization instead of across the database
+DROP INDEX IF EXISTS "uni_resources_name";
+ALTER TABLE "resources" ADD COLUMN "organization_id" integer NOT NULL DEFAULT 0;
+ALTER TABLE "resources" ADD COLUMN "serialized" numeric;
+ALTER TABLE "resources" ADD COLUMN "price" real;
+ALTER TABLE "resources" ADD COLUMN "currency" text;
+ALTER TABLE "resources" ADD COLUMN "group_id" integer CONSTRAINT "fk_resources_group" REFERENCES "resource_groups"("id") ON DELETE SET NULL ON UPDATE CASCADE;
+CREATE INDEX IF NOT EXISTS "idx_resources_group_id" ON "resources" ("group_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_resources_org_name" ON "resources" ("organization_id","name");
+
+ALTER TABLE "resource_histories" ADD COLUMN "organization_id" integer NOT NULL DEFAULT 0;
+ALTER TABLE "resource_histories" ADD COLUMN "serial_item_id" integer;
+ALTER TABLE "resource_histories" ADD COLUMN "unit_cost" real;
+ALTER TABLE "resource_histories" ADD COLUMN "currency" text;
+ALTER TABLE "resource_histories" ADD COLUMN "stocktake_id" integer;
+ALTER TABLE "resource_histories" ADD COLUMN "api_key_id" integer;
+CREATE INDEX IF NOT EXISTS "idx_resource_histories_api_key_id" ON "resource_histories" ("api_key_id");
+CREATE INDEX IF NOT EXISTS "idx_resource_histories_stocktake_id" ON "resource_histories" ("stocktake_id");
+CREATE INDEX IF NOT EXISTS "idx_resource_histories_serial_item_id" ON "resource_histories" ("serial_item_id");
+CREATE INDEX IF NOT EXISTS "idx_resource_histories_organization_id" ON "resource_histories" ("organization_id");
+
+CREATE TABLE "lots" (
+    "id" integer PRIMARY KEY AUTOINCREMENT,
+    "created_at" datetime,
+    "updated_at" datetime,
+    "deleted_at" datetime,
+    "organization_id" integer NOT NULL DEFAULT 0,
+    "resource_id" integer NOT NULL,
+    "lot_number" text,
+    "initial_quantity" integer NOT NULL,
+    "quantity" integer NOT NULL,
+    "received_at" datetime NOT NULL,
+    "expires_at" datetime,
+    "certificate" text,
+    "unit_cost" real,
+    "currency" text,
+    CONSTRAINT "fk_lots_resource" FOREIGN KEY ("resource_id") REFERENCES "resources"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_lots_expires_at" ON "lots" ("expires_at");
+CREATE INDEX IF NOT EXISTS "idx_lots_resource_id" ON "lots" ("resource_id");
+CREATE INDEX IF NOT EXISTS "idx_lots_organization_id" ON "lots" ("organization_id");
+CREATE INDEX IF NOT EXISTS "idx_lots_deleted_at" ON "lots" ("deleted_at");
+
+CREATE TABLE "serial_items" (
+    "id" integer PRIMARY KEY AUTOINCREMENT,
+    "created_at" datetime,
+    "updated_at" datetime,
+    "deleted_at" datetime,
+    "organization_id" integer NOT NULL DEFAULT 0,
+    "resource_id" integer NOT NULL,
+    "serial_number" text NOT NULL,
+    "inventory_number" text,
+    "status" text NOT NULL DEFAULT 'in_stock',
+    "assignee_id" integer,
+    "note" text,
+    CONSTRAINT "fk_serial_items_resource" FOREIGN KEY ("resource_id") REFERENCES "resources"("id") ON DELETE CASCADE ON UPDATE CASCADE,
+    CONSTRAINT "fk_serial_items_assignee" FOREIGN KEY ("assignee_id") REFERENCES "users"("id") ON DELETE SET NULL ON UPDATE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_serial_items_assignee_id" ON "serial_items" ("assignee_id");
+CREATE INDEX IF NOT EXISTS "idx_serial_items_inventory_number" ON "serial_items" ("inventory_number");
+CREATE INDEX IF NOT EXISTS "idx_serial_items_resource_id" ON "serial_items" ("resource_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_serial_items_org_serial" ON "serial_items" ("organization_id","serial_number");
+CREATE INDEX IF NOT EXISTS "idx_serial_items_organization_id" ON "serial_items" ("organization_id");
+CREATE INDEX IF NOT EXISTS "idx_serial_items_deleted_at" ON "serial_items" ("deleted_at");
+
+CREATE TABLE "stocktakes" (
+    "id" integer PRIMARY KEY AUTOINCREMENT,
+    "created_at" datetime,
+    "updated_at" datetime,
+    "deleted_at" datetime,
+    "organization_id" integer NOT NULL DEFAULT 0,
+    "status" text NOT NULL DEFAULT 'open',
+    "note" text,
+    "opened_by_id" integer NOT NULL,
+    "posted_by_id" integer,
+    "closed_at" datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_stocktakes_open" ON "stocktakes" ("organization_id") WHERE status = 'open';
+CREATE INDEX IF NOT EXISTS "idx_stocktakes_organization_id" ON "stocktakes" ("organization_id");
+CREATE INDEX IF NOT EXISTS "idx_stocktakes_deleted_at" ON "stocktakes" ("deleted_at");
+
+CREATE TABLE "stocktake_lines" (
+    "id" integer PRIMARY KEY AUTOINCREMENT,
+    "created_at" datetime,
+    "updated_at" datetime,
+    "stocktake_id" integer NOT NULL,
+    "resource_id" integer NOT NULL,
+    "expected_quantity" integer NOT NULL,
+    CONSTRAINT "fk_stocktake_lines_resource" FOREIGN KEY ("resource_id") REFERENCES "resources"("id") ON DELETE CASCADE ON UPDATE CASCADE,
+    CONSTRAINT "fk_stocktakes_lines" FOREIGN KEY ("stocktake_id") REFERENCES "stocktakes"("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_stocktake_line" ON "stocktake_lines" ("stocktake_id","resource_id");
+
+CREATE TABLE "stocktake_counts" (
+    "id" integer PRIMARY KEY AUTOINCREMENT,
+    "created_at" datetime,
+    "updated_at" datetime,
+    "stocktake_line_id" integer NOT NULL,
+    "user_id" integer NOT NULL,
+    "quantity" integer NOT NULL,
+    CONSTRAINT "fk_stocktake_lines_counts" FOREIGN KEY ("stocktake_line_id") REFERENCES "stocktake_lines"("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_stocktake_count" ON "stocktake_counts" ("stocktake_line_id","user_id");
+
+CREATE TABLE "exchange_rates" (
+    "id" integer PRIMARY KEY AUTOINCREMENT,
+    "created_at" datetime,
+    "updated_at" datetime,
+    "currency" text NOT NULL,
+    "effective_date" datetime NOT NULL,
+    "rate" real NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_exchange_rate" ON "exchange_rates" ("currency","effective_date");
+
+CREATE TABLE "generated_reports" (
+    "id" integer PRIMARY KEY AUTOINCREMENT,
+    "created_at" datetime,
+    "organization_id" integer NOT NULL DEFAULT 0,
+    "format" text NOT NULL,
+    "period_from" datetime NOT NULL,
+    "period_to" datetime NOT NULL,
+    "size" integer,
+    "access_token" text,
+    "content" blob NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_generated_reports_access_token" ON "generated_reports" ("access_token");
+CREATE INDEX IF NOT EXISTS "idx_generated_reports_organization_id" ON "generated_reports" ("organization_id");
+
+CREATE TABLE "notifications" (
+    "id" integer PRIMARY KEY AUTOINCREMENT,
+    "created_at" datetime,
+    "updated_at" datetime,
+    "user_id" integer,
+    "kind" text NOT NULL,
+    "to" text NOT NULL,
+    "subject" text NOT NULL,
+    "body" text NOT NULL,
+    "status" text NOT NULL DEFAULT 'pending',
+    "attempts" integer NOT NULL DEFAULT 0,
+    "next_attempt_at" datetime NOT NULL,
+    "last_error" text,
+    "sent_at" datetime
+);
+CREATE INDEX IF NOT EXISTS "idx_notification_due" ON "notifications" ("status","next_attempt_at");
+CREATE INDEX IF NOT EXISTS "idx_notifications_user_id" ON "notifications" ("user_id");
+
+CREATE TABLE "notification_preferences" (
+    "user_id" integer,
+    "created_at" datetime,
+    "updated_at" datetime,
+    "language" text NOT NULL,
+    "stock_changes" numeric NOT NULL,
+    "stock_change_threshold" integer NOT NULL,
+    "account_events" numeric NOT NULL,
+    PRIMARY KEY ("user_id")
+);
+
+CREATE TABLE "user_tokens" (
+    "id" integer PRIMARY KEY AUTOINCREMENT,
+    "created_at" datetime,
+    "user_id" integer NOT NULL,
+    "purpose" text NOT NULL,
+    "token_hash" text NOT NULL,
+    "expires_at" datetime NOT NULL,
+    "used_at" datetime,
+    CONSTRAINT "fk_user_tokens_user" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_user_tokens_token_hash" ON "user_tokens" ("token_hash");
+CREATE INDEX IF NOT EXISTS "idx_user_tokens_user_id" ON "user_tokens" ("user_id");
+
+CREATE TABLE "recovery_codes" (
+    "id" integer PRIMARY KEY AUTOINCREMENT,
+    "created_at" datetime,
+    "user_id" integer NOT NULL,
+    "code_hash" text NOT NULL,
+    "used_at" datetime,
+    CONSTRAINT "fk_recovery_codes_user" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_recovery_codes_code_hash" ON "recovery_codes" ("code_hash");
+CREATE INDEX IF NOT EXISTS "idx_recovery_codes_user_id" ON "recovery_codes" ("user_id");
+
+CREATE TABLE "two_factor_policies" (
+    "role" text,
+    "updated_at" datetime,
+    "required" numeric NOT NULL,
+    PRIMARY KEY ("role")
+);
+
+CREATE TABLE "rate_limits" (
+    "bucket" text,
+    "hits" integer NOT NULL,
+    "expires_at" datetime NOT NULL,
+    PRIMARY KEY ("bucket")
+);
+CREATE INDEX IF NOT EXISTS "idx_rate_limits_expires_at" ON "rate_limits" ("expires_at");
+
+CREATE TABLE "signing_keys" (
+    "id" integer PRIMARY KEY AUTOINCREMENT,
+    "created_at" datetime,
+    "kid" text NOT NULL,
+    "algorithm" text NOT NULL,
+    "private_key" text NOT NULL,
+    "public_key" text NOT NULL,
+    "rotated_at" datetime,
+    "retires_at" datetime
+);
+CREATE INDEX IF NOT EXISTS "idx_signing_keys_retires_at" ON "signing_keys" ("retires_at");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_signing_keys_kid" ON "signing_keys" ("kid");
+
+CREATE TABLE "api_keys" (
+    "id" integer PRIMARY KEY AUTOINCREMENT,
+    "created_at" datetime,
+    "updated_at" datetime,
+    "user_id" integer NOT NULL,
+    "name" text NOT NULL,
+    "prefix" text NOT NULL,
+    "key_hash" text NOT NULL,
+    "scopes" text NOT NULL,
+    "organization_id" integer,
+    "expires_at" datetime,
+    "last_used_at" datetime,
+    "revoked_at" datetime,
+    CONSTRAINT "fk_api_keys_user" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_api_keys_revoked_at" ON "api_keys" ("revoked_at");
+CREATE INDEX IF NOT EXISTS "idx_api_keys_organization_id" ON "api_keys" ("organization_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_api_keys_key_hash" ON "api_keys" ("key_hash");
+CREATE INDEX IF NOT EXISTS "idx_api_keys_user_id" ON "api_keys" ("user_id");
+
+CREATE TABLE "permission_grants" (
+    "id" integer PRIMARY KEY AUTOINCREMENT,
+    "created_at" datetime,
+    "organization_id" integer NOT NULL DEFAULT 0,
+    "user_id" integer,
+    "role" text,
+    "action" text NOT NULL,
+    "group_id" integer,
+    CONSTRAINT "fk_permission_grants_user" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE ON UPDATE CASCADE,
+    CONSTRAINT "fk_permission_grants_group" FOREIGN KEY ("group_id") REFERENCES "resource_groups"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_permission_grants_group_id" ON "permission_grants" ("group_id");
+CREATE INDEX IF NOT EXISTS "idx_permission_grants_role" ON "permission_grants" ("role");
+CREATE INDEX IF NOT EXISTS "idx_permission_grants_user_id" ON "permission_grants" ("user_id");
+CREATE INDEX IF NOT EXISTS "idx_permission_grants_organization_id" ON "permission_grants" ("organization_id");
+
+CREATE TABLE "organizations" (
+    "id" integer PRIMARY KEY AUTOINCREMENT,
+    "created_at" datetime,
+    "updated_at" datetime,
+    "name" text NOT NULL,
+    "slug" text NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_organizations_slug" ON "organizations" ("slug");
+
+CREATE TABLE "memberships" (
+    "id" integer PRIMARY KEY AUTOINCREMENT,
+    "created_at" datetime,
+    "updated_at" datetime,
+    "user_id" integer NOT NULL,
+    "organization_id" integer NOT NULL,
+    "role" text NOT NULL DEFAULT 'user',
+    CONSTRAINT "fk_memberships_user" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE ON UPDATE CASCADE,
+    CONSTRAINT "fk_memberships_organization" FOREIGN KEY ("organization_id") REFERENCES "organizations"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_memberships_organization_id" ON "memberships" ("organization_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_memberships_user_org" ON "memberships" ("user_id","organization_id");
@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+// APIKey lets a program act as its owner without logging in. Only the hash of
+// the key is stored; the key itself is shown once, when it is created.
+type APIKey struct {
+	ID             uint       `gorm:"primarykey" json:"id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	UserID         uint       `gorm:"not null;index" json:"user_id"`          // Owner whose permissions the key uses
+	Name           string     `gorm:"not null;size:100" json:"name"`          // What the key is for, e.g. "ERP sync"
+	Prefix         string     `gorm:"not null;size:16" json:"prefix"`         // Start of the key, to recognise it
+	KeyHash        string     `gorm:"uniqueIndex;not null;size:64" json:"-"`  // SHA-256 of the key
+	Scopes         string     `gorm:"not null;size:100" json:"scopes"`        // Space-separated: read, write, admin
+	OrganizationID *uint      `gorm:"index" json:"organization_id,omitempty"` // Organization the key acts in, nil for the owner's default
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`                   // Nil for keys that do not expire
+	LastUsedAt     *time.Time `json:"last_used_at,omitempty"`                 // Updated at most once a minute
+	RevokedAt      *time.Time `gorm:"index" json:"revoked_at,omitempty"`      // Set when the key is revoked
+
+	User User `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
+
+// Usable reports whether the key authenticates at t
+func (k APIKey) Usable(t time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || t.Before(*k.ExpiresAt))
+}
@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// ExchangeRate gives the value of one unit of a currency in the base currency
+// from its effective date until the next rate of the same currency
+type ExchangeRate struct {
+	ID            uint      `gorm:"primarykey" json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Currency      string    `gorm:"not null;size:3;uniqueIndex:idx_exchange_rate" json:"currency"` // ISO 4217 code
+	EffectiveDate time.Time `gorm:"not null;uniqueIndex:idx_exchange_rate" json:"effective_date"`
+	Rate          float64   `gorm:"not null" json:"rate"` // Base currency units per one unit of Currency
+}
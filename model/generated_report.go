@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// GeneratedReport is a rendered inventory report kept for download
+type GeneratedReport struct {
+	ID             uint      `gorm:"primarykey" json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	OrganizationID uint      `gorm:"not null;default:0;index" json:"organization_id"` // Organization whose inventory is reported
+	Format         string    `gorm:"not null;size:10" json:"format"`                  // pdf or html
+	PeriodFrom     time.Time `gorm:"not null" json:"period_from"`
+	PeriodTo       time.Time `gorm:"not null" json:"period_to"`
+	Size           int       `json:"size"`                         // Content length in bytes
+	AccessToken    *string   `gorm:"uniqueIndex;size:64" json:"-"` // Allows downloading without logging in; nil once revoked
+	Content        []byte    `gorm:"not null" json:"-"`
+}
@@ -0,0 +1,33 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Lot is a batch of a resource received at once with a common expiry date
+type Lot struct {
+	ID              uint           `gorm:"primarykey" json:"id"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+	OrganizationID  uint           `gorm:"not null;default:0;index" json:"organization_id"`
+	ResourceID      uint           `gorm:"not null;index" json:"resource_id"`
+	LotNumber       string         `gorm:"size:100" json:"lot_number"`            // Supplier lot number
+	InitialQuantity int            `gorm:"not null" json:"initial_quantity"`      // Quantity received
+	Quantity        int            `gorm:"not null" json:"quantity"`              // Quantity still in stock
+	ReceivedAt      time.Time      `gorm:"not null" json:"received_at"`           // When the lot arrived
+	ExpiresAt       *time.Time     `gorm:"index" json:"expires_at,omitempty"`     // Nil for lots that never expire
+	Certificate     string         `gorm:"size:255" json:"certificate,omitempty"` // Certificate number or link
+	UnitCost        *float64       `json:"unit_cost,omitempty"`                   // Purchase cost per unit
+	Currency        string         `gorm:"size:3" json:"currency,omitempty"`      // ISO 4217 code of the unit cost
+
+	// Relations
+	Resource Resource `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"resource,omitempty"`
+}
+
+// Expired reports whether the lot is past its expiry date at t
+func (l Lot) Expired(t time.Time) bool {
+	return l.ExpiresAt != nil && !l.ExpiresAt.After(t)
+}
@@ -0,0 +1,50 @@
+package model
+
+import "time"
+
+// Statuses of an outbox notification
+const (
+	NotificationPending = "pending"
+	NotificationSent    = "sent"
+	NotificationFailed  = "failed"
+)
+
+// Notification is an email waiting in or delivered from the outbox
+type Notification struct {
+	ID            uint       `gorm:"primarykey" json:"id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	UserID        *uint      `gorm:"index" json:"user_id,omitempty"` // Recipient user, if any
+	Kind          string     `gorm:"not null;size:50" json:"kind"`   // Template used, e.g. stock_change
+	To            string     `gorm:"not null;size:255" json:"to"`
+	Subject       string     `gorm:"not null" json:"subject"`
+	Body          string     `gorm:"type:text;not null" json:"body"`
+	Status        string     `gorm:"not null;size:20;default:pending;index:idx_notification_due" json:"status"` // pending, sent, failed
+	Attempts      int        `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt time.Time  `gorm:"not null;index:idx_notification_due" json:"next_attempt_at"`
+	LastError     string     `json:"last_error,omitempty"`
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+}
+
+// NotificationPreference holds what a user wants to be notified about.
+// Users without a stored preference get DefaultNotificationPreference.
+type NotificationPreference struct {
+	UserID               uint      `gorm:"primarykey;autoIncrement:false" json:"user_id"`
+	CreatedAt            time.Time `json:"created_at"`
+	UpdatedAt            time.Time `json:"updated_at"`
+	Language             string    `gorm:"not null;size:2" json:"language"` // ru or en
+	StockChanges         bool      `gorm:"not null" json:"stock_changes"`
+	StockChangeThreshold int       `gorm:"not null" json:"stock_change_threshold"` // Minimum change in percent
+	AccountEvents        bool      `gorm:"not null" json:"account_events"`
+}
+
+// DefaultNotificationPreference returns the preference of a user who never changed it
+func DefaultNotificationPreference(userID uint) NotificationPreference {
+	return NotificationPreference{
+		UserID:               userID,
+		Language:             "ru",
+		StockChanges:         false,
+		StockChangeThreshold: 20,
+		AccountEvents:        true,
+	}
+}
@@ -0,0 +1,28 @@
+package model
+
+import "time"
+
+// Organization owns its inventory: resources, their history, lots, items,
+// stocktakes and reports are only visible inside it
+type Organization struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Name      string    `gorm:"not null;size:100" json:"name"`
+	Slug      string    `gorm:"uniqueIndex;not null;size:50" json:"slug"` // Short unique name, e.g. for SIGNUP_ORGANIZATION
+}
+
+// Membership makes a user part of an organization with a role there. The role
+// replaces the user's own role inside the organization; admins of the
+// deployment (users with the admin role) may act in every organization.
+type Membership struct {
+	ID             uint      `gorm:"primarykey" json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	UserID         uint      `gorm:"not null;uniqueIndex:idx_memberships_user_org" json:"user_id"`
+	OrganizationID uint      `gorm:"not null;uniqueIndex:idx_memberships_user_org;index" json:"organization_id"`
+	Role           string    `gorm:"not null;size:20;default:user" json:"role"` // user or admin
+
+	User         *User         `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"user,omitempty"`
+	Organization *Organization `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"organization,omitempty"`
+}
@@ -0,0 +1,42 @@
+package model
+
+import "time"
+
+// Actions on resources that permissions grant
+const (
+	ActionRead   = "read"
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+	ActionAdjust = "adjust" // Change the quantity: receive, issue, add items
+)
+
+// Actions lists every action in display order
+var Actions = []string{ActionRead, ActionCreate, ActionUpdate, ActionDelete, ActionAdjust}
+
+// ResourceGroup is a named set of resources of an organization, such as IT
+// equipment or chemicals, that permissions can be limited to
+type ResourceGroup struct {
+	ID             uint      `gorm:"primarykey" json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	OrganizationID uint      `gorm:"not null;default:0;uniqueIndex:idx_resource_groups_org_name" json:"organization_id"` // Owning organization
+	Name           string    `gorm:"not null;size:100;uniqueIndex:idx_resource_groups_org_name" json:"name"`             // Unique within the organization
+	Description    string    `json:"description"`
+}
+
+// PermissionGrant allows a user, or every user with a role, one action on all
+// resources or on the resources of one group, in one organization. Admins are
+// allowed everything.
+type PermissionGrant struct {
+	ID             uint      `gorm:"primarykey" json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	OrganizationID uint      `gorm:"not null;default:0;index" json:"organization_id"` // Organization the grant applies in
+	UserID         *uint     `gorm:"index" json:"user_id,omitempty"`                  // Grantee user, or nil for a role grant
+	Role           string    `gorm:"size:20;index" json:"role,omitempty"`             // Grantee role when UserID is nil
+	Action         string    `gorm:"not null;size:20" json:"action"`                  // read, create, update, delete or adjust
+	GroupID        *uint     `gorm:"index" json:"group_id,omitempty"`                 // Resource group, nil for all resources
+
+	User  *User          `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	Group *ResourceGroup `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"group,omitempty"`
+}
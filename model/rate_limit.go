@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+// RateLimit is a counter of the database rate limit store, shared by all
+// processes of the server
+type RateLimit struct {
+	Bucket    string    `gorm:"primarykey;size:255" json:"bucket"` // e.g. login:ip:10.0.0.1 or lock:user:42
+	Hits      int       `gorm:"not null" json:"hits"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"` // End of the window; the row is void afterwards
+}
@@ -7,12 +7,19 @@ import (
 )
 
 type Resource struct {
-	ID          uint           `gorm:"primarykey" json:"id"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
-	Name        string         `gorm:"unique;not null" json:"name"`
-	Description string         `json:"description"`
-	Unit        string         `json:"unit"` // кг, л и т.п.
-	Quantity    int            `json:"quantity"`
+	ID             uint           `gorm:"primarykey" json:"id"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+	OrganizationID uint           `gorm:"not null;default:0;uniqueIndex:idx_resources_org_name" json:"organization_id"` // Owning organization
+	Name           string         `gorm:"not null;uniqueIndex:idx_resources_org_name" json:"name"`                      // Unique within the organization
+	Description    string         `json:"description"`
+	Unit           string         `json:"unit"`       // кг, л и т.п.
+	Quantity       int            `json:"quantity"`   // Derived from in-stock items for serialized resources
+	Serialized     bool           `json:"serialized"` // Units are tracked individually by serial number
+	Price          *float64       `json:"price,omitempty"`
+	Currency       string         `gorm:"size:3" json:"currency,omitempty"` // ISO 4217 code of the price, empty for the base currency
+	GroupID        *uint          `gorm:"index" json:"group_id,omitempty"`  // Resource group that scopes permissions, nil for none
+
+	Group *ResourceGroup `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"group,omitempty"`
 }
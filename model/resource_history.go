@@ -8,17 +8,23 @@ import (
 
 // ResourceHistory tracks all changes made to resources
 type ResourceHistory struct {
-	ID          uint           `gorm:"primarykey" json:"id"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
-	ResourceID  uint           `gorm:"not null" json:"resource_id"`                         // ID of the resource being changed
-	Action      string         `gorm:"not null" json:"action"`                              // CREATE, UPDATE, DELETE
-	UserID      uint           `gorm:"not null" json:"user_id"`                             // User who made the change
-	OldData     string         `gorm:"type:text" json:"old_data,omitempty"`                 // JSON of old data (for UPDATE/DELETE)
-	NewData     string         `gorm:"type:text" json:"new_data,omitempty"`                 // JSON of new data (for CREATE/UPDATE)
-	Timestamp   time.Time      `gorm:"not null;default:CURRENT_TIMESTAMP" json:"timestamp"` // When the change happened
-	Description string         `json:"description,omitempty"`                               // Optional description of the change
+	ID             uint           `gorm:"primarykey" json:"id"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+	OrganizationID uint           `gorm:"not null;default:0;index" json:"organization_id"`     // Organization owning the resource
+	ResourceID     uint           `gorm:"not null" json:"resource_id"`                         // ID of the resource being changed
+	Action         string         `gorm:"not null" json:"action"`                              // CREATE, UPDATE, DELETE, RECEIVE, ISSUE, ITEM_ADD, ASSIGN, ITEM_STATUS, ITEM_UPDATE, ADJUST
+	UserID         uint           `gorm:"not null" json:"user_id"`                             // User who made the change
+	OldData        string         `gorm:"type:text" json:"old_data,omitempty"`                 // JSON of old data (for UPDATE/DELETE)
+	NewData        string         `gorm:"type:text" json:"new_data,omitempty"`                 // JSON of new data (for CREATE/UPDATE)
+	Timestamp      time.Time      `gorm:"not null;default:CURRENT_TIMESTAMP" json:"timestamp"` // When the change happened
+	Description    string         `json:"description,omitempty"`                               // Optional description of the change
+	SerialItemID   *uint          `gorm:"index" json:"serial_item_id,omitempty"`               // Serialized item concerned by the change
+	UnitCost       *float64       `json:"unit_cost,omitempty"`                                 // Cost per unit of the quantity received
+	Currency       string         `gorm:"size:3" json:"currency,omitempty"`                    // ISO 4217 code of the unit cost, empty for the base currency
+	StocktakeID    *uint          `gorm:"index" json:"stocktake_id,omitempty"`                 // Stocktake session that caused an ADJUST
+	APIKeyID       *uint          `gorm:"index" json:"api_key_id,omitempty"`                   // API key the user made the change with
 
 	// Relations
 	Resource Resource `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"resource,omitempty"`
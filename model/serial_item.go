@@ -0,0 +1,43 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Statuses of a serialized item
+const (
+	SerialStatusInStock  = "in_stock"
+	SerialStatusAssigned = "assigned"
+	SerialStatusInRepair = "in_repair"
+	SerialStatusRetired  = "retired"
+)
+
+// SerialItem is an individually tracked unit of a serialized resource
+type SerialItem struct {
+	ID              uint           `gorm:"primarykey" json:"id"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+	OrganizationID  uint           `gorm:"not null;default:0;index;uniqueIndex:idx_serial_items_org_serial" json:"organization_id"`
+	ResourceID      uint           `gorm:"not null;index" json:"resource_id"`
+	SerialNumber    string         `gorm:"not null;size:100;uniqueIndex:idx_serial_items_org_serial" json:"serial_number"` // Unique within the organization
+	InventoryNumber string         `gorm:"index;size:100" json:"inventory_number,omitempty"`
+	Status          string         `gorm:"not null;size:20;default:in_stock" json:"status"` // in_stock, assigned, in_repair, retired
+	AssigneeID      *uint          `gorm:"index" json:"assignee_id,omitempty"`              // User holding the item when assigned
+	Note            string         `json:"note,omitempty"`
+
+	// Relations
+	Resource Resource `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"resource,omitempty"`
+	Assignee *User    `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"assignee,omitempty"`
+}
+
+// ValidSerialStatus reports whether s is a known serialized item status
+func ValidSerialStatus(s string) bool {
+	switch s {
+	case SerialStatusInStock, SerialStatusAssigned, SerialStatusInRepair, SerialStatusRetired:
+		return true
+	}
+	return false
+}
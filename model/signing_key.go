@@ -0,0 +1,21 @@
+package model
+
+import "time"
+
+// SigningKey is a key pair that signs session tokens. The newest key signs;
+// rotated keys only verify until they retire.
+type SigningKey struct {
+	ID         uint       `gorm:"primarykey" json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Kid        string     `gorm:"not null;size:64;uniqueIndex" json:"kid"` // Key ID sent in the token header
+	Algorithm  string     `gorm:"not null;size:10" json:"algorithm"`       // RS256 or EdDSA
+	PrivateKey string     `gorm:"type:text;not null" json:"-"`             // PKCS #8 PEM
+	PublicKey  string     `gorm:"type:text;not null" json:"public_key"`    // PKIX PEM
+	RotatedAt  *time.Time `json:"rotated_at,omitempty"`                    // When the key stopped signing
+	RetiresAt  *time.Time `gorm:"index" json:"retires_at,omitempty"`       // When tokens signed by it stop being accepted
+}
+
+// Retired reports whether tokens signed by the key are rejected at t
+func (k SigningKey) Retired(t time.Time) bool {
+	return k.RetiresAt != nil && !k.RetiresAt.After(t)
+}
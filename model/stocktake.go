@@ -0,0 +1,66 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Statuses of a stocktake session
+const (
+	StocktakeStatusOpen      = "open"
+	StocktakeStatusPosted    = "posted"
+	StocktakeStatusCancelled = "cancelled"
+)
+
+// Stocktake is a physical inventory count session
+type Stocktake struct {
+	ID             uint            `gorm:"primarykey" json:"id"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt  `gorm:"index" json:"deleted_at,omitempty"`
+	OrganizationID uint            `gorm:"not null;default:0;index;uniqueIndex:idx_stocktakes_open,where:status = 'open'" json:"organization_id"` // One session per organization is open at most
+	Status         string          `gorm:"not null;size:20;default:open" json:"status"`                                                           // open, posted, cancelled
+	Note           string          `json:"note,omitempty"`
+	OpenedByID     uint            `gorm:"not null" json:"opened_by_id"` // User who opened the session
+	PostedByID     *uint           `json:"posted_by_id,omitempty"`       // User who posted or cancelled the session
+	ClosedAt       *time.Time      `json:"closed_at,omitempty"`          // When the session was posted or cancelled
+	Lines          []StocktakeLine `json:"lines,omitempty"`
+}
+
+// StocktakeLine holds the expected quantity of one resource snapshotted when the session opened
+type StocktakeLine struct {
+	ID               uint             `gorm:"primarykey" json:"id"`
+	CreatedAt        time.Time        `json:"created_at"`
+	UpdatedAt        time.Time        `json:"updated_at"`
+	StocktakeID      uint             `gorm:"not null;uniqueIndex:idx_stocktake_line" json:"stocktake_id"`
+	ResourceID       uint             `gorm:"not null;uniqueIndex:idx_stocktake_line" json:"resource_id"`
+	ExpectedQuantity int              `gorm:"not null" json:"expected_quantity"`
+	Counts           []StocktakeCount `json:"counts,omitempty"`
+
+	// Relations
+	Resource Resource `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"resource,omitempty"`
+}
+
+// StocktakeCount is the quantity of a resource counted by one user.
+// Several users may count the same resource in different places; their counts add up.
+type StocktakeCount struct {
+	ID              uint      `gorm:"primarykey" json:"id"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+	StocktakeLineID uint      `gorm:"not null;uniqueIndex:idx_stocktake_count" json:"stocktake_line_id"`
+	UserID          uint      `gorm:"not null;uniqueIndex:idx_stocktake_count" json:"user_id"`
+	Quantity        int       `gorm:"not null" json:"quantity"`
+}
+
+// CountedQuantity sums the counts of all users, or returns nil if nobody counted the line
+func (l StocktakeLine) CountedQuantity() *int {
+	if len(l.Counts) == 0 {
+		return nil
+	}
+	total := 0
+	for _, c := range l.Counts {
+		total += c.Quantity
+	}
+	return &total
+}
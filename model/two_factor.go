@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// RecoveryCode is a one-time code that replaces a TOTP code when the
+// authenticator is lost. Only the SHA-256 hash of the code is stored.
+type RecoveryCode struct {
+	ID        uint       `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	CodeHash  string     `gorm:"not null;size:64;uniqueIndex" json:"-"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+
+	// Relations
+	User User `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
+
+// TwoFactorPolicy tells whether users of a role must use two-factor authentication.
+// Roles without a policy do not require it.
+type TwoFactorPolicy struct {
+	Role      string    `gorm:"primarykey;size:20" json:"role"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Required  bool      `gorm:"not null" json:"required"`
+}
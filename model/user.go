@@ -3,9 +3,19 @@ package model
 import (
 	"time"
 
+	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
+// User roles
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// PasswordCost is the bcrypt cost of stored password hashes
+const PasswordCost = bcrypt.DefaultCost
+
 // User struct
 type User struct {
 	ID        uint           `gorm:"primarykey" json:"id"`
@@ -16,4 +26,39 @@ type User struct {
 	Email     string         `gorm:"uniqueIndex;not null;size:255;" validate:"required,email" json:"email"`
 	Password  string         `gorm:"not null;" validate:"required,min=6,max=50" json:"password"`
 	Names     string         `json:"names"`
+	Role      string         `gorm:"not null;size:20;default:user" json:"role"`
+
+	ServiceAccount bool `gorm:"not null;default:false" json:"service_account"` // Acts through API keys only and cannot log in
+
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"` // Nil until the user confirms the address
+
+	TOTPSecret    string     `gorm:"size:64" json:"-"`            // Base32 secret, set during enrollment
+	TOTPEnabledAt *time.Time `json:"totp_enabled_at,omitempty"`   // Nil while two-factor authentication is off
+	TOTPLastStep  int64      `gorm:"not null;default:0" json:"-"` // Last accepted TOTP period, prevents code replay
+
+	OIDCIssuer  *string `gorm:"column:oidc_issuer;size:255;uniqueIndex:idx_users_oidc" json:"-"`  // Identity provider the user logs in with, nil for local users
+	OIDCSubject *string `gorm:"column:oidc_subject;size:255;uniqueIndex:idx_users_oidc" json:"-"` // Subject of the user at that provider
+}
+
+// PublicUser is what the user routes show of a user: no password hash, role or
+// account settings
+type PublicUser struct {
+	ID        uint      `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Username  string    `json:"username"`
+	Email     string    `json:"email"`
+	Names     string    `json:"names"`
+}
+
+// Public returns the public fields of the user
+func (u User) Public() PublicUser {
+	return PublicUser{
+		ID:        u.ID,
+		CreatedAt: u.CreatedAt,
+		UpdatedAt: u.UpdatedAt,
+		Username:  u.Username,
+		Email:     u.Email,
+		Names:     u.Names,
+	}
 }
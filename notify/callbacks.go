@@ -0,0 +1,133 @@
+package notify
+
+import (
+	"log"
+	"time"
+
+	"app/inventory"
+	"app/model"
+
+	"gorm.io/gorm"
+)
+
+// stockChangeData is the template data of stock change notifications
+type stockChangeData struct {
+	Username    string
+	Resource    string
+	Unit        string
+	Old         int
+	New         int
+	Delta       int
+	Percent     int
+	Action      string
+	Description string
+	Time        time.Time
+}
+
+// RegisterCallbacks makes every stored resource history entry that changes a
+// quantity enqueue stock change notifications in the same transaction
+func RegisterCallbacks(db *gorm.DB) error {
+	return db.Callback().Create().After("gorm:create").Register("notify:stock_change", stockChanged)
+}
+
+func stockChanged(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil || db.Statement.Schema.Table != "resource_histories" {
+		return
+	}
+
+	var entries []model.ResourceHistory
+	switch dest := db.Statement.Dest.(type) {
+	case *model.ResourceHistory:
+		entries = []model.ResourceHistory{*dest}
+	case []model.ResourceHistory:
+		entries = dest
+	case *[]model.ResourceHistory:
+		entries = *dest
+	default:
+		return
+	}
+
+	tx := db.Session(&gorm.Session{NewDB: true})
+	for _, entry := range entries {
+		if err := enqueueStockChange(tx, entry); err != nil {
+			db.AddError(err)
+			return
+		}
+	}
+}
+
+// changePercent is the size of a quantity change relative to the old quantity;
+// anything coming from an empty stock counts as 100%
+func changePercent(before, after int) int {
+	delta := after - before
+	if delta < 0 {
+		delta = -delta
+	}
+	if before <= 0 {
+		return 100
+	}
+	return delta * 100 / before
+}
+
+func enqueueStockChange(tx *gorm.DB, entry model.ResourceHistory) error {
+	m := inventory.FromHistory(entry)
+	if m.Delta() == 0 {
+		return nil
+	}
+	percent := changePercent(m.Before, m.After)
+
+	type recipient struct {
+		ID       uint
+		Username string
+		Email    string
+		Language string
+	}
+	var recipients []recipient
+	if err := tx.Model(&model.User{}).
+		Select("users.id, users.username, users.email, notification_preferences.language").
+		Joins("JOIN notification_preferences ON notification_preferences.user_id = users.id").
+		// Only members see the stock of an organization
+		Joins("JOIN memberships ON memberships.user_id = users.id AND memberships.organization_id = ?", entry.OrganizationID).
+		Where("notification_preferences.stock_changes AND notification_preferences.stock_change_threshold <= ?", percent).
+		Find(&recipients).Error; err != nil {
+		return err
+	}
+	if len(recipients) == 0 {
+		return nil
+	}
+
+	var resource model.Resource
+	if err := tx.Unscoped().First(&resource, entry.ResourceID).Error; err != nil {
+		return err
+	}
+
+	when := entry.Timestamp
+	if when.IsZero() {
+		when = time.Now()
+	}
+	for _, r := range recipients {
+		data := stockChangeData{
+			Username:    r.Username,
+			Resource:    resource.Name,
+			Unit:        resource.Unit,
+			Old:         m.Before,
+			New:         m.After,
+			Delta:       m.Delta(),
+			Percent:     percent,
+			Action:      entry.Action,
+			Description: entry.Description,
+			Time:        when,
+		}
+		id := r.ID
+		notification, err := newNotification(&id, r.Email, KindStockChange, r.Language, data)
+		if err != nil {
+			// A broken template must not block stock operations
+			log.Println("❌ Cannot render stock change notification:", err)
+			continue
+		}
+		if err := tx.Create(&notification).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package notify
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"app/config"
+	"app/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Enqueue renders a notification and stores it in the outbox. Pass the
+// transaction of the change being reported so both are committed together.
+func Enqueue(db *gorm.DB, userID *uint, to, kind, lang string, data interface{}) error {
+	notification, err := newNotification(userID, to, kind, lang, data)
+	if err != nil {
+		return err
+	}
+	return db.Create(&notification).Error
+}
+
+// newNotification renders a pending notification that is due immediately
+func newNotification(userID *uint, to, kind, lang string, data interface{}) (model.Notification, error) {
+	subject, body, err := Render(kind, lang, data)
+	if err != nil {
+		return model.Notification{}, err
+	}
+	return model.Notification{
+		UserID:        userID,
+		Kind:          kind,
+		To:            to,
+		Subject:       subject,
+		Body:          body,
+		Status:        model.NotificationPending,
+		NextAttemptAt: time.Now(),
+	}, nil
+}
+
+// Preference returns the stored preference of a user or the default one
+func Preference(db *gorm.DB, userID uint) (model.NotificationPreference, error) {
+	var pref model.NotificationPreference
+	err := db.First(&pref, userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		pref = model.DefaultNotificationPreference(userID)
+		pref.Language = DefaultLanguage()
+		return pref, nil
+	}
+	return pref, err
+}
+
+// accountData is the template data of account notifications
+type accountData struct {
+	Username  string
+	Email     string
+	Time      time.Time
+	Link      string    // Action link of verification and reset emails
+	ExpiresAt time.Time // When the link stops working
+}
+
+// AccountEvent notifies a user about a change to their account unless they
+// turned account notifications off
+func AccountEvent(db *gorm.DB, user model.User, kind string) error {
+	if user.ServiceAccount {
+		return nil // Nobody reads their mail
+	}
+	pref, err := Preference(db, user.ID)
+	if err != nil {
+		return err
+	}
+	if !pref.AccountEvents {
+		return nil
+	}
+	data := accountData{Username: user.Username, Email: user.Email, Time: time.Now()}
+	return Enqueue(db, &user.ID, user.Email, kind, pref.Language, data)
+}
+
+// AccountLink sends a user a link to act on their account, such as an email
+// verification or password reset. It ignores preferences since the user asked for it.
+func AccountLink(db *gorm.DB, user model.User, kind, link string, expiresAt time.Time) error {
+	pref, err := Preference(db, user.ID)
+	if err != nil {
+		return err
+	}
+	data := accountData{Username: user.Username, Email: user.Email, Time: time.Now(), Link: link, ExpiresAt: expiresAt}
+	return Enqueue(db, &user.ID, user.Email, kind, pref.Language, data)
+}
+
+// Worker delivers pending notifications from the outbox
+type Worker struct {
+	db          *gorm.DB
+	sender      Sender
+	interval    time.Duration // Pause between outbox polls
+	batch       int           // Notifications sent per poll
+	maxAttempts int           // Deliveries tried before a notification is marked failed
+	backoff     time.Duration // Delay after the first failure, doubled on each retry
+	lease       time.Duration // Time a claimed notification is left to the worker sending it
+
+	stop chan struct{}
+	done sync.WaitGroup
+}
+
+// NewWorker creates a worker that gives up after NOTIFY_MAX_ATTEMPTS failed
+// deliveries (default 5)
+func NewWorker(db *gorm.DB, sender Sender) *Worker {
+	return &Worker{
+		db:          db,
+		sender:      sender,
+		interval:    10 * time.Second,
+		batch:       20,
+		maxAttempts: config.Get().NotifyMaxAttempts,
+		backoff:     time.Minute,
+		lease:       5 * time.Minute,
+		stop:        make(chan struct{}),
+	}
+}
+
+// Start polls the outbox in the background
+func (w *Worker) Start() {
+	w.done.Add(1)
+	go func() {
+		defer w.done.Done()
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			if _, err := w.Flush(); err != nil {
+				log.Println("❌ Notification delivery failed:", err)
+			}
+			select {
+			case <-w.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop stops polling and waits for the current batch to finish
+func (w *Worker) Stop() {
+	close(w.stop)
+	w.done.Wait()
+}
+
+// Flush sends the notifications that are due and returns how many were sent.
+// They are claimed first, so that no row stays locked and no transaction stays
+// open while the SMTP server answers, and the results are recorded afterwards.
+func (w *Worker) Flush() (int, error) {
+	due, err := w.claim()
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for i := range due {
+		n := &due[i]
+		if err := w.sender.Send(Message{To: n.To, Subject: n.Subject, Body: n.Body}); err != nil {
+			n.LastError = err.Error()
+			if n.Attempts >= w.maxAttempts {
+				n.Status = model.NotificationFailed
+			} else {
+				n.NextAttemptAt = time.Now().Add(w.backoff << (n.Attempts - 1))
+			}
+		} else {
+			now := time.Now()
+			n.Status = model.NotificationSent
+			n.SentAt = &now
+			n.LastError = ""
+			sent++
+		}
+	}
+
+	err = w.db.Transaction(func(tx *gorm.DB) error {
+		for i := range due {
+			if err := tx.Save(&due[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return sent, err
+}
+
+// claim counts an attempt for each due notification and postpones it by the
+// lease, so that other workers leave it alone while it is sent. Should the
+// worker stop before recording the result, the notification is due again once
+// the lease ends. Rows are locked with SKIP LOCKED so several workers never
+// claim the same one.
+func (w *Worker) claim() ([]model.Notification, error) {
+	var due []model.Notification
+	err := w.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", model.NotificationPending, now).
+			Order("next_attempt_at").Order("id").Limit(w.batch).
+			Find(&due).Error; err != nil {
+			return err
+		}
+		if len(due) == 0 {
+			return nil
+		}
+
+		ids := make([]uint, len(due))
+		for i := range due {
+			due[i].Attempts++
+			due[i].NextAttemptAt = now.Add(w.lease)
+			ids[i] = due[i].ID
+		}
+		return tx.Model(&model.Notification{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+			"attempts":        gorm.Expr("attempts + 1"),
+			"next_attempt_at": now.Add(w.lease),
+		}).Error
+	})
+	return due, err
+}
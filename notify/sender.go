@@ -0,0 +1,104 @@
+// Package notify sends email notifications through a persistent outbox.
+// Messages are rendered from templates, stored as pending rows and delivered
+// by a background worker that retries failed deliveries.
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"app/config"
+)
+
+// Message is a rendered email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers messages; SMTPSender is the production implementation
+type Sender interface {
+	Send(msg Message) error
+}
+
+// SMTPSender delivers messages through an SMTP server
+type SMTPSender struct {
+	Host     string
+	Port     int
+	Username string // Authentication is skipped when empty
+	Password string
+	From     string // Sender address, optionally with a display name
+}
+
+// NewSMTPSender reads SMTP_HOST, SMTP_PORT (default 587), SMTP_USERNAME,
+// SMTP_PASSWORD and SMTP_FROM. It returns nil when no host is configured.
+func NewSMTPSender() (*SMTPSender, error) {
+	cfg := config.Get()
+	if cfg.SMTPHost == "" {
+		return nil, nil
+	}
+	if _, err := mail.ParseAddress(cfg.SMTPFrom); err != nil {
+		return nil, fmt.Errorf("invalid SMTP_FROM %q: %w", cfg.SMTPFrom, err)
+	}
+
+	return &SMTPSender{
+		Host:     cfg.SMTPHost,
+		Port:     cfg.SMTPPort,
+		Username: cfg.SMTPUsername,
+		Password: cfg.SMTPPassword,
+		From:     cfg.SMTPFrom,
+	}, nil
+}
+
+// Send delivers a message; STARTTLS is used when the server offers it
+func (s *SMTPSender) Send(msg Message) error {
+	from, err := mail.ParseAddress(s.From)
+	if err != nil {
+		return err
+	}
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return err
+	}
+
+	content, err := compose(from, to, msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+	addr := net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+	return smtp.SendMail(addr, auth, from.Address, []string{to.Address}, content)
+}
+
+// compose builds a UTF-8 plain text MIME message
+func compose(from, to *mail.Address, msg Message, date time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", to.String())
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	w := quotedprintable.NewWriter(&buf)
+	if _, err := w.Write([]byte(msg.Body)); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
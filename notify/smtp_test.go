@@ -0,0 +1,219 @@
+package notify
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// envelope is a message received by the fake SMTP server
+type envelope struct {
+	From string
+	To   []string
+	Data string
+}
+
+// fakeSMTP starts a minimal SMTP server without TLS or authentication
+// and returns its address and a channel of received messages
+func fakeSMTP(t *testing.T) (string, <-chan envelope) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	received := make(chan envelope, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, received)
+		}
+	}()
+	return ln.Addr().String(), received
+}
+
+func serveSMTP(conn net.Conn, received chan<- envelope) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+	reply("220 localhost fake SMTP")
+	var env envelope
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch verb {
+		case "EHLO", "HELO":
+			reply("250 localhost")
+		case "MAIL":
+			env = envelope{From: strings.TrimSuffix(strings.TrimPrefix(line, "MAIL FROM:<"), ">")}
+			reply("250 OK")
+		case "RCPT":
+			env.To = append(env.To, strings.TrimSuffix(strings.TrimPrefix(line, "RCPT TO:<"), ">"))
+			reply("250 OK")
+		case "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(l, "."))
+			}
+			env.Data = data.String()
+			received <- env
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestSMTPSenderDeliversEncodedMessage(t *testing.T) {
+	addr, received := fakeSMTP(t)
+	host, port, _ := net.SplitHostPort(addr)
+	portNumber, _ := strconv.Atoi(port)
+
+	sender := &SMTPSender{Host: host, Port: portNumber, From: "Склад <stock@example.com>"}
+	msg := Message{To: "ivan@example.com", Subject: "Остаток изменился", Body: "Остаток «Мука» изменился с 100 до 40 кг.\n"}
+	if err := sender.Send(msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	var env envelope
+	select {
+	case env = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+	}
+
+	if env.From != "stock@example.com" {
+		t.Errorf("envelope sender = %q", env.From)
+	}
+	if len(env.To) != 1 || env.To[0] != "ivan@example.com" {
+		t.Errorf("envelope recipients = %v", env.To)
+	}
+
+	parsed, err := mail.ReadMessage(strings.NewReader(env.Data))
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil || subject != msg.Subject {
+		t.Errorf("subject = %q, %v", subject, err)
+	}
+	from, err := parsed.Header.AddressList("From")
+	if err != nil || from[0].Name != "Склад" {
+		t.Errorf("from = %v, %v", from, err)
+	}
+	if got := parsed.Header.Get("Content-Type"); got != "text/plain; charset=utf-8" {
+		t.Errorf("content type = %q", got)
+	}
+	if _, err := parsed.Header.Date(); err != nil {
+		t.Errorf("date: %v", err)
+	}
+
+	body, err := io.ReadAll(quotedprintable.NewReader(parsed.Body))
+	if err != nil {
+		t.Fatalf("body: %v", err)
+	}
+	if got := strings.ReplaceAll(string(body), "\r\n", "\n"); got != msg.Body {
+		t.Errorf("body = %q, want %q", got, msg.Body)
+	}
+}
+
+func TestSMTPSenderReportsRefusedConnection(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().(*net.TCPAddr)
+	ln.Close()
+
+	sender := &SMTPSender{Host: "127.0.0.1", Port: addr.Port, From: "stock@example.com"}
+	if err := sender.Send(Message{To: "ivan@example.com", Subject: "x", Body: "x"}); err == nil {
+		t.Fatal("expected an error from a closed port")
+	}
+}
+
+func TestRenderTemplatesInBothLanguages(t *testing.T) {
+	data := stockChangeData{
+		Username: "ivan",
+		Resource: "Мука",
+		Unit:     "кг",
+		Old:      100,
+		New:      40,
+		Delta:    -60,
+		Percent:  60,
+		Action:   "ISSUE",
+		Time:     time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC),
+	}
+
+	subject, body, err := Render(KindStockChange, "ru", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject != "Остаток «Мука» изменился на 60%" {
+		t.Errorf("ru subject = %q", subject)
+	}
+	if !strings.Contains(body, "с 100 до 40 кг (-60, 60%)") || !strings.Contains(body, "01.03.2024 09:30") {
+		t.Errorf("ru body = %q", body)
+	}
+
+	subject, body, err = Render(KindStockChange, "en", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject != `Stock of "Мука" changed by 60%` {
+		t.Errorf("en subject = %q", subject)
+	}
+	if !strings.Contains(body, "from 100 to 40 кг (-60, 60%)") {
+		t.Errorf("en body = %q", body)
+	}
+
+	for _, lang := range Languages {
+		for _, kind := range []string{KindEmailVerification, KindPasswordReset, KindAccountRegistered, KindPasswordChanged, KindAccountDeleted} {
+			account := accountData{Username: "ivan", Email: "ivan@example.com", Time: data.Time,
+				Link: "http://localhost:3000/reset-password?token=abc", ExpiresAt: data.Time.Add(time.Hour)}
+			if _, _, err := Render(kind, lang, account); err != nil {
+				t.Errorf("%s/%s: %v", lang, kind, err)
+			}
+		}
+	}
+}
+
+func TestChangePercent(t *testing.T) {
+	cases := []struct{ before, after, want int }{
+		{100, 80, 20},
+		{100, 130, 30},
+		{0, 5, 100},
+		{40, 0, 100},
+	}
+	for _, c := range cases {
+		if got := changePercent(c.before, c.after); got != c.want {
+			t.Errorf("changePercent(%d, %d) = %d, want %d", c.before, c.after, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package notify
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"strings"
+	"text/template"
+
+	"app/config"
+)
+
+// Kinds of notifications, each with a template per language
+const (
+	KindStockChange       = "stock_change"
+	KindEmailVerification = "email_verification"
+	KindPasswordReset     = "password_reset"
+	KindAccountRegistered = "account_registered"
+	KindPasswordChanged   = "password_changed"
+	KindAccountDeleted    = "account_deleted"
+)
+
+// Languages lists the languages templates are available in
+var Languages = []string{"ru", "en"}
+
+//go:embed templates
+var templateFS embed.FS
+
+// templates holds the parsed templates keyed by "lang/kind"
+var templates = mustParseTemplates()
+
+func mustParseTemplates() map[string]*template.Template {
+	funcs := template.FuncMap{
+		"signed": func(n int) string { return fmt.Sprintf("%+d", n) },
+	}
+
+	parsed := map[string]*template.Template{}
+	paths, err := fs.Glob(templateFS, "templates/*/*.txt")
+	if err != nil {
+		panic(err)
+	}
+	for _, path := range paths {
+		content, err := templateFS.ReadFile(path)
+		if err != nil {
+			panic(err)
+		}
+		key := strings.TrimSuffix(strings.TrimPrefix(path, "templates/"), ".txt")
+		parsed[key] = template.Must(template.New(key).Funcs(funcs).Parse(string(content)))
+	}
+	return parsed
+}
+
+// DefaultLanguage is the language used for recipients without a preference
+// (NOTIFY_DEFAULT_LANGUAGE, ru by default)
+func DefaultLanguage() string {
+	return config.Get().NotifyDefaultLanguage
+}
+
+// SupportedLanguage reports whether templates exist for the language
+func SupportedLanguage(lang string) bool {
+	for _, l := range Languages {
+		if l == lang {
+			return true
+		}
+	}
+	return false
+}
+
+// Render produces the subject and body of a notification. Templates start with
+// a "Subject:" line followed by an empty line and the body.
+func Render(kind, lang string, data interface{}) (subject, body string, err error) {
+	if !SupportedLanguage(lang) {
+		lang = DefaultLanguage()
+	}
+	tmpl, ok := templates[lang+"/"+kind]
+	if !ok {
+		return "", "", fmt.Errorf("no %s template for notification kind %q", lang, kind)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", "", err
+	}
+
+	head, body, ok := strings.Cut(buf.String(), "\n\n")
+	if !ok || !strings.HasPrefix(head, "Subject:") {
+		return "", "", fmt.Errorf("template %s/%s has no subject line", lang, kind)
+	}
+	return strings.TrimSpace(strings.TrimPrefix(head, "Subject:")), strings.TrimSpace(body) + "\n", nil
+}
@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"strconv"
+	"time"
+
+	"app/config"
+)
+
+// Lockout locks an account after repeated failures. Each failure past the
+// limit doubles the lock, up to MaxDelay.
+type Lockout struct {
+	store       Store
+	MaxFailures int           // Failures allowed before the first lock
+	BaseDelay   time.Duration // First lock
+	MaxDelay    time.Duration // Longest lock
+	Memory      time.Duration // How long failures are remembered after the first one
+}
+
+// NewLockout reads LOGIN_MAX_FAILURES (default 5) and locks for 1 minute,
+// doubling up to 1 hour; failures are forgotten after 24 hours
+func NewLockout(store Store) *Lockout {
+	return &Lockout{
+		store:       store,
+		MaxFailures: config.Get().LoginMaxFailures,
+		BaseDelay:   time.Minute,
+		MaxDelay:    time.Hour,
+		Memory:      24 * time.Hour,
+	}
+}
+
+// Locked returns how long the account stays locked, zero when it is not
+func (l *Lockout) Locked(account string) (time.Duration, error) {
+	_, until, err := l.store.Get("lock:" + account)
+	if err != nil || until.IsZero() {
+		return 0, err
+	}
+	return time.Until(until), nil
+}
+
+// Fail records a failure and returns the lock it caused, zero if none
+func (l *Lockout) Fail(account string) (time.Duration, error) {
+	failures, _, err := l.store.Incr("fail:"+account, l.Memory)
+	if err != nil || failures < l.MaxFailures {
+		return 0, err
+	}
+
+	delay := l.BaseDelay
+	for i := l.MaxFailures; i < failures && delay < l.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > l.MaxDelay {
+		delay = l.MaxDelay
+	}
+	return delay, l.store.Set("lock:"+account, failures, time.Now().Add(delay))
+}
+
+// Succeed clears the failures of an account
+func (l *Lockout) Succeed(account string) error {
+	if err := l.store.Delete("fail:" + account); err != nil {
+		return err
+	}
+	return l.store.Delete("lock:" + account)
+}
+
+// RetryAfter formats a wait for the Retry-After header in whole seconds
+func RetryAfter(wait time.Duration) string {
+	seconds := int((wait + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return strconv.Itoa(seconds)
+}
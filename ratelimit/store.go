@@ -0,0 +1,179 @@
+// Package ratelimit counts requests in fixed windows and locks accounts out
+// after repeated failures. Counters live in a Store so that all prefork
+// processes share them.
+package ratelimit
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"app/config"
+	"app/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Store keeps counters that expire at the end of their window
+type Store interface {
+	// Incr counts a hit on a bucket. A bucket without a live window starts a
+	// new one lasting window. It returns the hits and the end of the window.
+	Incr(bucket string, window time.Duration) (int, time.Time, error)
+	// Get returns the hits and window end of a live bucket, or zero values
+	Get(bucket string) (int, time.Time, error)
+	// Set overwrites a bucket
+	Set(bucket string, hits int, expiresAt time.Time) error
+	// Delete forgets a bucket
+	Delete(bucket string) error
+}
+
+var (
+	shared     Store
+	sharedOnce sync.Once
+)
+
+// Shared returns the store of the process: the database store unless
+// RATE_LIMIT_STORE=memory, which only suits a server without prefork
+func Shared(db *gorm.DB) Store {
+	sharedOnce.Do(func() {
+		if config.Get().RateLimitStore == "memory" {
+			shared = NewMemoryStore()
+		} else {
+			shared = NewDBStore(db)
+		}
+	})
+	return shared
+}
+
+// SetShared replaces the store of the process, for tests that give each case
+// a database of its own
+func SetShared(store Store) {
+	sharedOnce.Do(func() {})
+	shared = store
+}
+
+// ----------  DATABASE -------------------------------------------------
+
+// DBStore keeps counters in the rate_limits table
+type DBStore struct {
+	db        *gorm.DB
+	lastPurge atomic.Int64 // Unix time of the last removal of expired rows
+}
+
+// purgeInterval is how often a process removes expired rows
+const purgeInterval = 10 * time.Minute
+
+// NewDBStore creates a store on the rate_limits table
+func NewDBStore(db *gorm.DB) *DBStore {
+	return &DBStore{db: db}
+}
+
+// Incr counts a hit with a single upsert so concurrent processes never lose one
+func (s *DBStore) Incr(bucket string, window time.Duration) (int, time.Time, error) {
+	now := time.Now()
+	s.purge(now)
+
+	var row model.RateLimit
+	err := s.db.Raw(`INSERT INTO rate_limits (bucket, hits, expires_at) VALUES (?, 1, ?)
+ON CONFLICT (bucket) DO UPDATE SET
+	hits = CASE WHEN rate_limits.expires_at <= ? THEN 1 ELSE rate_limits.hits + 1 END,
+	expires_at = CASE WHEN rate_limits.expires_at <= ? THEN excluded.expires_at ELSE rate_limits.expires_at END
+RETURNING bucket, hits, expires_at`, bucket, now.Add(window), now, now).Scan(&row).Error
+	return row.Hits, row.ExpiresAt, err
+}
+
+// Get returns a live bucket
+func (s *DBStore) Get(bucket string) (int, time.Time, error) {
+	var row model.RateLimit
+	err := s.db.Where("bucket = ? AND expires_at > ?", bucket, time.Now()).First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, time.Time{}, nil
+	}
+	return row.Hits, row.ExpiresAt, err
+}
+
+// Set overwrites a bucket
+func (s *DBStore) Set(bucket string, hits int, expiresAt time.Time) error {
+	return s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "bucket"}},
+		DoUpdates: clause.AssignmentColumns([]string{"hits", "expires_at"}),
+	}).Create(&model.RateLimit{Bucket: bucket, Hits: hits, ExpiresAt: expiresAt}).Error
+}
+
+// Delete forgets a bucket
+func (s *DBStore) Delete(bucket string) error {
+	return s.db.Where("bucket = ?", bucket).Delete(&model.RateLimit{}).Error
+}
+
+// purge removes expired rows at most once per purgeInterval per process
+func (s *DBStore) purge(now time.Time) {
+	last := s.lastPurge.Load()
+	if now.Unix()-last < int64(purgeInterval.Seconds()) || !s.lastPurge.CompareAndSwap(last, now.Unix()) {
+		return
+	}
+	s.db.Where("expires_at <= ?", now).Delete(&model.RateLimit{})
+}
+
+// ----------  MEMORY ---------------------------------------------------
+
+type memoryEntry struct {
+	hits      int
+	expiresAt time.Time
+}
+
+// MemoryStore keeps counters in the process
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+}
+
+// NewMemoryStore creates an empty in-process store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: map[string]memoryEntry{}}
+}
+
+// Incr counts a hit
+func (s *MemoryStore) Incr(bucket string, window time.Duration) (int, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	entry := s.entries[bucket]
+	if !entry.expiresAt.After(now) {
+		entry = memoryEntry{expiresAt: now.Add(window)}
+	}
+	entry.hits++
+	s.entries[bucket] = entry
+	return entry.hits, entry.expiresAt, nil
+}
+
+// Get returns a live bucket
+func (s *MemoryStore) Get(bucket string) (int, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[bucket]
+	if !ok || !entry.expiresAt.After(time.Now()) {
+		delete(s.entries, bucket)
+		return 0, time.Time{}, nil
+	}
+	return entry.hits, entry.expiresAt, nil
+}
+
+// Set overwrites a bucket
+func (s *MemoryStore) Set(bucket string, hits int, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[bucket] = memoryEntry{hits: hits, expiresAt: expiresAt}
+	return nil
+}
+
+// Delete forgets a bucket
+func (s *MemoryStore) Delete(bucket string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, bucket)
+	return nil
+}
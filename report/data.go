@@ -0,0 +1,111 @@
+// Package report renders inventory reports as HTML or PDF and generates them on a schedule.
+package report
+
+import (
+	"sort"
+	"time"
+
+	"app/inventory"
+	"app/model"
+
+	"gorm.io/gorm"
+)
+
+// Formats a report can be rendered in
+const (
+	FormatHTML = "html"
+	FormatPDF  = "pdf"
+)
+
+// StockLine is the current stock of one resource
+type StockLine struct {
+	Name     string
+	Unit     string
+	Quantity int
+}
+
+// MovementLine is one history entry within the report period
+type MovementLine struct {
+	Time        time.Time
+	Resource    string
+	Unit        string
+	Action      string
+	Delta       int
+	User        string
+	Description string
+}
+
+// Data is the content of an inventory report
+type Data struct {
+	GeneratedAt       time.Time
+	From              time.Time
+	To                time.Time
+	LowStockThreshold int
+	Stock             []StockLine
+	Movements         []MovementLine
+	LowStock          []StockLine
+	TotalQuantity     int
+}
+
+// LastDay is the last instant covered by the report period, which excludes To
+func (d Data) LastDay() time.Time {
+	return d.To.Add(-time.Nanosecond)
+}
+
+// Scope limits a query on resources, or on a table naming them in its
+// resource_id column, to the resources a report covers
+type Scope func(db *gorm.DB, table string) *gorm.DB
+
+// Collect reads the current stock and the movements between from and to of
+// the resources in scope, every resource when scope is nil. Resources below
+// the threshold are listed as low stock, lowest first.
+func Collect(db *gorm.DB, scope Scope, from, to time.Time, lowStockThreshold int) (Data, error) {
+	data := Data{GeneratedAt: time.Now(), From: from, To: to, LowStockThreshold: lowStockThreshold}
+	if scope == nil {
+		scope = func(db *gorm.DB, table string) *gorm.DB { return db }
+	}
+
+	var resources []model.Resource
+	if err := scope(db, "resources").Order("name").Find(&resources).Error; err != nil {
+		return data, err
+	}
+	for _, r := range resources {
+		line := StockLine{Name: r.Name, Unit: r.Unit, Quantity: r.Quantity}
+		data.Stock = append(data.Stock, line)
+		data.TotalQuantity += r.Quantity
+		if r.Quantity < lowStockThreshold {
+			data.LowStock = append(data.LowStock, line)
+		}
+	}
+	sort.SliceStable(data.LowStock, func(i, j int) bool { return data.LowStock[i].Quantity < data.LowStock[j].Quantity })
+
+	var history []model.ResourceHistory
+	if err := scope(db, "resource_histories").Preload("Resource", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+		Preload("User", func(db *gorm.DB) *gorm.DB { return db.Unscoped().Select("id", "username") }).
+		Where("timestamp >= ? AND timestamp < ?", from, to).
+		Order("timestamp").Order("id").Find(&history).Error; err != nil {
+		return data, err
+	}
+	for _, h := range history {
+		data.Movements = append(data.Movements, MovementLine{
+			Time:        h.Timestamp,
+			Resource:    h.Resource.Name,
+			Unit:        h.Resource.Unit,
+			Action:      h.Action,
+			Delta:       inventory.FromHistory(h).Delta(),
+			User:        h.User.Username,
+			Description: h.Description,
+		})
+	}
+	return data, nil
+}
+
+// Render renders the report in the given format and returns its content type
+func Render(data Data, format string) ([]byte, string, error) {
+	if format == FormatPDF {
+		content, err := RenderPDF(data)
+		return content, "application/pdf", err
+	}
+	content, err := RenderHTML(data)
+	return content, "text/html; charset=utf-8", err
+}
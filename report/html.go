@@ -0,0 +1,37 @@
+package report
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"time"
+)
+
+//go:embed templates/inventory.html
+var templates embed.FS
+
+var funcs = template.FuncMap{
+	"date":     func(t time.Time) string { return t.Format("02.01.2006") },
+	"datetime": func(t time.Time) string { return t.Format("02.01.2006 15:04") },
+	"signed":   signed,
+}
+
+var inventoryHTML = template.Must(template.New("inventory.html").Funcs(funcs).ParseFS(templates, "templates/inventory.html"))
+
+// signed formats a quantity change with an explicit plus sign
+func signed(n int) string {
+	if n > 0 {
+		return fmt.Sprintf("+%d", n)
+	}
+	return fmt.Sprintf("%d", n)
+}
+
+// RenderHTML renders the report as a standalone HTML page
+func RenderHTML(data Data) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := inventoryHTML.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
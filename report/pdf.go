@@ -0,0 +1,124 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/go-pdf/fpdf"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// column of a PDF table
+type column struct {
+	title string
+	width float64
+	align string
+}
+
+// pdfWriter wraps fpdf with the table helpers used by the report
+type pdfWriter struct {
+	*fpdf.Fpdf
+}
+
+// RenderPDF renders the report as an A4 PDF document. The Go fonts are
+// embedded so that Cyrillic names render without any system fonts.
+func RenderPDF(data Data) ([]byte, error) {
+	pdf := pdfWriter{fpdf.New("P", "mm", "A4", "")}
+	pdf.AddUTF8FontFromBytes("go", "", goregular.TTF)
+	pdf.AddUTF8FontFromBytes("go", "B", gobold.TTF)
+	pdf.SetMargins(10, 12, 10)
+	pdf.SetAutoPageBreak(true, 15)
+	pdf.AliasNbPages("")
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-12)
+		pdf.SetFont("go", "", 8)
+		pdf.CellFormat(0, 6, fmt.Sprintf("Page %d/{nb}", pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+	pdf.AddPage()
+
+	pdf.SetFont("go", "B", 16)
+	pdf.CellFormat(0, 9, "Inventory report", "", 1, "L", false, 0, "")
+	pdf.SetFont("go", "", 10)
+	pdf.CellFormat(0, 6, fmt.Sprintf("Period %s – %s, generated %s",
+		data.From.Format("02.01.2006"), data.LastDay().Format("02.01.2006"), data.GeneratedAt.Format("02.01.2006 15:04")),
+		"", 1, "L", false, 0, "")
+
+	stockColumns := []column{{"Resource", 120, "L"}, {"Quantity", 40, "R"}, {"Unit", 30, "L"}}
+
+	pdf.heading(fmt.Sprintf("Low stock (below %d)", data.LowStockThreshold))
+	if len(data.LowStock) == 0 {
+		pdf.note("No resources below the threshold.")
+	} else {
+		pdf.header(stockColumns)
+		for _, s := range data.LowStock {
+			pdf.row(stockColumns, s.Name, fmt.Sprint(s.Quantity), s.Unit)
+		}
+	}
+
+	pdf.heading("Movements")
+	if len(data.Movements) == 0 {
+		pdf.note("No movements in this period.")
+	} else {
+		columns := []column{{"Time", 27, "L"}, {"Resource", 38, "L"}, {"Action", 22, "L"}, {"Change", 25, "R"}, {"User", 22, "L"}, {"Description", 56, "L"}}
+		pdf.header(columns)
+		for _, m := range data.Movements {
+			pdf.row(columns, m.Time.Format("02.01.2006 15:04"), m.Resource, m.Action,
+				signed(m.Delta)+" "+m.Unit, m.User, m.Description)
+		}
+	}
+
+	pdf.heading("Current stock")
+	pdf.header(stockColumns)
+	for _, s := range data.Stock {
+		pdf.row(stockColumns, s.Name, fmt.Sprint(s.Quantity), s.Unit)
+	}
+	pdf.SetFont("go", "B", 9)
+	pdf.row(stockColumns, fmt.Sprintf("Total (%d resources)", len(data.Stock)), fmt.Sprint(data.TotalQuantity), "")
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (pdf pdfWriter) heading(text string) {
+	pdf.Ln(4)
+	pdf.SetFont("go", "B", 12)
+	pdf.CellFormat(0, 8, text, "", 1, "L", false, 0, "")
+}
+
+func (pdf pdfWriter) note(text string) {
+	pdf.SetFont("go", "", 9)
+	pdf.CellFormat(0, 6, text, "", 1, "L", false, 0, "")
+}
+
+func (pdf pdfWriter) header(columns []column) {
+	pdf.SetFont("go", "B", 9)
+	pdf.SetFillColor(242, 242, 242)
+	for _, c := range columns {
+		pdf.CellFormat(c.width, 6, c.title, "1", 0, c.align, true, 0, "")
+	}
+	pdf.Ln(-1)
+	pdf.SetFont("go", "", 9)
+}
+
+// row prints one table row, shortening texts that do not fit their column
+func (pdf pdfWriter) row(columns []column, values ...string) {
+	for i, c := range columns {
+		pdf.CellFormat(c.width, 6, pdf.fit(values[i], c.width-2), "1", 0, c.align, false, 0, "")
+	}
+	pdf.Ln(-1)
+}
+
+func (pdf pdfWriter) fit(text string, width float64) string {
+	if pdf.GetStringWidth(text) <= width {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 && pdf.GetStringWidth(string(runes)+"…") > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "…"
+}
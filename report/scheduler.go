@@ -0,0 +1,117 @@
+package report
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+
+	"app/config"
+	"app/model"
+	"app/tenant"
+
+	"github.com/robfig/cron/v3"
+	"gorm.io/gorm"
+)
+
+// LowStockThreshold is the quantity under which resources are reported as low
+// stock (LOW_STOCK_THRESHOLD, 100 by default)
+func LowStockThreshold() int {
+	return config.Get().LowStockThreshold
+}
+
+// Generate renders a report for the period and stores it for download. The
+// context of db names the organization reported on.
+func Generate(db *gorm.DB, format string, from, to time.Time) (model.GeneratedReport, error) {
+	data, err := Collect(db, nil, from, to, LowStockThreshold())
+	if err != nil {
+		return model.GeneratedReport{}, err
+	}
+	content, _, err := Render(data, format)
+	if err != nil {
+		return model.GeneratedReport{}, err
+	}
+
+	token, err := NewAccessToken()
+	if err != nil {
+		return model.GeneratedReport{}, err
+	}
+
+	report := model.GeneratedReport{
+		Format:      format,
+		PeriodFrom:  from,
+		PeriodTo:    to,
+		Size:        len(content),
+		AccessToken: &token,
+		Content:     content,
+	}
+	return report, db.Create(&report).Error
+}
+
+// NewAccessToken returns a random token for downloading a stored report
+// without logging in
+func NewAccessToken() (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
+
+// Scheduler generates reports on a cron expression
+type Scheduler struct {
+	cron   *cron.Cron
+	db     *gorm.DB
+	format string
+	period int // days covered by each report
+}
+
+// NewScheduler reads REPORT_SCHEDULE (standard 5-field cron expression or a
+// descriptor such as @weekly), REPORT_FORMAT (pdf or html, default pdf) and
+// REPORT_PERIOD_DAYS (default 7). It returns nil when no schedule is configured.
+func NewScheduler(db *gorm.DB) (*Scheduler, error) {
+	cfg := config.Get()
+	spec := cfg.ReportSchedule
+	if spec == "" {
+		return nil, nil
+	}
+
+	s := &Scheduler{cron: cron.New(), db: db, format: cfg.ReportFormat, period: cfg.ReportPeriodDays}
+	if _, err := s.cron.AddFunc(spec, s.run); err != nil {
+		return nil, fmt.Errorf("invalid REPORT_SCHEDULE %q: %w", spec, err)
+	}
+	return s, nil
+}
+
+// run generates one report for each organization
+func (s *Scheduler) run() {
+	to := time.Now()
+	from := to.AddDate(0, 0, -s.period)
+
+	var organizations []model.Organization
+	if err := s.db.Order("id").Find(&organizations).Error; err != nil {
+		log.Println("❌ Scheduled report failed:", err)
+		return
+	}
+	for _, organization := range organizations {
+		db := s.db.WithContext(tenant.WithOrganization(context.Background(), organization.ID))
+		report, err := Generate(db, s.format, from, to)
+		if err != nil {
+			log.Printf("❌ Scheduled report of %s failed: %v", organization.Slug, err)
+			continue
+		}
+		log.Printf("✅ Scheduled %s report #%d of %s generated", report.Format, report.ID, organization.Slug)
+	}
+}
+
+// Start runs the schedule in the background
+func (s *Scheduler) Start() {
+	s.cron.Start()
+}
+
+// Stop stops scheduling; the returned context is done once a running report finishes
+func (s *Scheduler) Stop() context.Context {
+	return s.cron.Stop()
+}
@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"app/access"
+	"app/model"
+
+	"gorm.io/gorm"
+)
+
+// Gorm keeps the repositories in the database. Queries on tenant-owned tables
+// are scoped by the tenant callbacks registered on the connection.
+type Gorm struct {
+	db *gorm.DB
+}
+
+// NewGorm returns a store on the database connection
+func NewGorm(db *gorm.DB) *Gorm {
+	return &Gorm{db: db}
+}
+
+func (s *Gorm) Resources() ResourceRepository     { return gormResources{s.db} }
+func (s *Gorm) History() HistoryRepository        { return gormHistory{s.db} }
+func (s *Gorm) Users() UserRepository             { return gormUsers{s.db} }
+func (s *Gorm) Permissions() PermissionRepository { return gormPermissions{s.db} }
+
+func (s *Gorm) Transaction(ctx context.Context, fn func(tx Store) error) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(&Gorm{db: tx})
+	})
+}
+
+// notFound translates the error of a lookup by id
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// ----------  RESOURCES ------------------------------------------------
+
+type gormResources struct {
+	db *gorm.DB
+}
+
+func (r gormResources) List(ctx context.Context, grants access.Grants, action string) ([]model.Resource, error) {
+	var resources []model.Resource
+	err := grants.Filter(r.db.WithContext(ctx), action).Order("id").Find(&resources).Error
+	return resources, err
+}
+
+func (r gormResources) Get(ctx context.Context, id uint) (model.Resource, error) {
+	var resource model.Resource
+	err := r.db.WithContext(ctx).First(&resource, id).Error
+	return resource, notFound(err)
+}
+
+func (r gormResources) Create(ctx context.Context, resource *model.Resource) error {
+	return r.db.WithContext(ctx).Create(resource).Error
+}
+
+func (r gormResources) Save(ctx context.Context, resource *model.Resource) error {
+	return r.db.WithContext(ctx).Save(resource).Error
+}
+
+func (r gormResources) Delete(ctx context.Context, resource *model.Resource) error {
+	return r.db.WithContext(ctx).Delete(resource).Error
+}
+
+func (r gormResources) GetGroup(ctx context.Context, id uint) (model.ResourceGroup, error) {
+	var group model.ResourceGroup
+	err := r.db.WithContext(ctx).First(&group, id).Error
+	return group, notFound(err)
+}
+
+func (r gormResources) CountInStock(ctx context.Context, resourceID uint) (int, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&model.SerialItem{}).
+		Where("resource_id = ? AND status = ?", resourceID, model.SerialStatusInStock).
+		Count(&count).Error
+	return int(count), err
+}
+
+// ----------  HISTORY --------------------------------------------------
+
+type gormHistory struct {
+	db *gorm.DB
+}
+
+func (r gormHistory) Create(ctx context.Context, history *model.ResourceHistory) error {
+	return r.db.WithContext(ctx).Create(history).Error
+}
+
+func (r gormHistory) ListByResource(ctx context.Context, resourceID uint) ([]model.ResourceHistory, error) {
+	var history []model.ResourceHistory
+	err := r.db.WithContext(ctx).Preload("User").
+		Where("resource_id = ?", resourceID).
+		Order("timestamp desc").Order("id desc").
+		Find(&history).Error
+	return history, err
+}
+
+// ----------  USERS ----------------------------------------------------
+
+type gormUsers struct {
+	db *gorm.DB
+}
+
+func (r gormUsers) List(ctx context.Context) ([]model.User, error) {
+	var users []model.User
+	err := r.db.WithContext(ctx).Order("id").Find(&users).Error
+	return users, err
+}
+
+func (r gormUsers) Get(ctx context.Context, id uint) (model.User, error) {
+	var user model.User
+	err := r.db.WithContext(ctx).First(&user, id).Error
+	return user, notFound(err)
+}
+
+func (r gormUsers) FindByUsername(ctx context.Context, username string) (model.User, error) {
+	var user model.User
+	err := r.db.WithContext(ctx).Where("username = ?", username).First(&user).Error
+	return user, notFound(err)
+}
+
+func (r gormUsers) Create(ctx context.Context, user *model.User) error {
+	return r.db.WithContext(ctx).Create(user).Error
+}
+
+func (r gormUsers) Save(ctx context.Context, user *model.User) error {
+	return r.db.WithContext(ctx).Save(user).Error
+}
+
+func (r gormUsers) Delete(ctx context.Context, user *model.User) error {
+	return r.db.WithContext(ctx).Delete(user).Error
+}
+
+// ----------  PERMISSIONS ----------------------------------------------
+
+type gormPermissions struct {
+	db *gorm.DB
+}
+
+func (r gormPermissions) Grants(ctx context.Context, user model.User, role string) (access.Grants, error) {
+	return access.Load(r.db.WithContext(ctx), user, role)
+}
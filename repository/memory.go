@@ -0,0 +1,393 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"app/access"
+	"app/model"
+	"app/tenant"
+)
+
+// Memory keeps the repositories in memory, for tests. Like the database it
+// scopes resources, history and grants to the organization of the context and
+// stamps it on the rows it creates; a context without an organization fails
+// with tenant.ErrNoOrganization.
+//
+// Transactions run one at a time. A failed transaction restores the data as it
+// was when the transaction began.
+type Memory struct {
+	tx   sync.Mutex // Held by the running transaction
+	mu   sync.Mutex // Guards data
+	data memoryData
+}
+
+type memoryData struct {
+	lastID    uint
+	resources map[uint]model.Resource
+	history   map[uint]model.ResourceHistory
+	users     map[uint]model.User
+	groups    map[uint]model.ResourceGroup
+	items     map[uint]model.SerialItem
+	grants    map[uint]model.PermissionGrant
+}
+
+// NewMemory returns an empty in-memory store
+func NewMemory() *Memory {
+	return &Memory{data: memoryData{
+		resources: map[uint]model.Resource{},
+		history:   map[uint]model.ResourceHistory{},
+		users:     map[uint]model.User{},
+		groups:    map[uint]model.ResourceGroup{},
+		items:     map[uint]model.SerialItem{},
+		grants:    map[uint]model.PermissionGrant{},
+	}}
+}
+
+// AddGroups stores resource groups, which the repositories only read
+func (m *Memory) AddGroups(groups ...model.ResourceGroup) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, group := range groups {
+		if group.ID == 0 {
+			group.ID = m.data.nextID()
+		}
+		m.data.groups[group.ID] = group
+	}
+}
+
+// AddItems stores serial items, which the repositories only count
+func (m *Memory) AddItems(items ...model.SerialItem) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, item := range items {
+		if item.ID == 0 {
+			item.ID = m.data.nextID()
+		}
+		m.data.items[item.ID] = item
+	}
+}
+
+// AddGrants stores permission grants, which the repositories only read
+func (m *Memory) AddGrants(grants ...model.PermissionGrant) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, grant := range grants {
+		if grant.ID == 0 {
+			grant.ID = m.data.nextID()
+		}
+		m.data.grants[grant.ID] = grant
+	}
+}
+
+func (m *Memory) Resources() ResourceRepository     { return memoryResources{m} }
+func (m *Memory) History() HistoryRepository        { return memoryHistory{m} }
+func (m *Memory) Users() UserRepository             { return memoryUsers{m} }
+func (m *Memory) Permissions() PermissionRepository { return memoryPermissions{m} }
+
+func (m *Memory) Transaction(ctx context.Context, fn func(tx Store) error) error {
+	m.tx.Lock()
+	defer m.tx.Unlock()
+
+	m.mu.Lock()
+	saved := m.data.clone()
+	m.mu.Unlock()
+
+	if err := fn(m); err != nil {
+		m.mu.Lock()
+		m.data = saved
+		m.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (d *memoryData) nextID() uint {
+	d.lastID++
+	return d.lastID
+}
+
+func (d memoryData) clone() memoryData {
+	c := memoryData{
+		lastID:    d.lastID,
+		resources: make(map[uint]model.Resource, len(d.resources)),
+		history:   make(map[uint]model.ResourceHistory, len(d.history)),
+		users:     make(map[uint]model.User, len(d.users)),
+		groups:    make(map[uint]model.ResourceGroup, len(d.groups)),
+		items:     make(map[uint]model.SerialItem, len(d.items)),
+		grants:    make(map[uint]model.PermissionGrant, len(d.grants)),
+	}
+	for id, r := range d.resources {
+		c.resources[id] = r
+	}
+	for id, h := range d.history {
+		c.history[id] = h
+	}
+	for id, u := range d.users {
+		c.users[id] = u
+	}
+	for id, g := range d.groups {
+		c.groups[id] = g
+	}
+	for id, i := range d.items {
+		c.items[id] = i
+	}
+	for id, g := range d.grants {
+		c.grants[id] = g
+	}
+	return c
+}
+
+// visible reports whether a row of the organization can be seen from the
+// scope of a context, as returned by tenant.Scope
+func visible(scope, organizationID uint) bool {
+	return scope == 0 || scope == organizationID
+}
+
+// ----------  RESOURCES ------------------------------------------------
+
+type memoryResources struct {
+	m *Memory
+}
+
+func (r memoryResources) List(ctx context.Context, grants access.Grants, action string) ([]model.Resource, error) {
+	scope, err := tenant.Scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	resources := []model.Resource{}
+	for _, resource := range r.m.data.resources {
+		if visible(scope, resource.OrganizationID) && grants.Allows(action, resource.GroupID) {
+			resources = append(resources, resource)
+		}
+	}
+	sort.Slice(resources, func(i, j int) bool { return resources[i].ID < resources[j].ID })
+	return resources, nil
+}
+
+func (r memoryResources) Get(ctx context.Context, id uint) (model.Resource, error) {
+	scope, err := tenant.Scope(ctx)
+	if err != nil {
+		return model.Resource{}, err
+	}
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	resource, ok := r.m.data.resources[id]
+	if !ok || !visible(scope, resource.OrganizationID) {
+		return model.Resource{}, ErrNotFound
+	}
+	return resource, nil
+}
+
+func (r memoryResources) Create(ctx context.Context, resource *model.Resource) error {
+	scope, err := tenant.Scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if scope != 0 {
+		resource.OrganizationID = scope
+	}
+	resource.ID = r.m.data.nextID()
+	resource.CreatedAt = time.Now()
+	resource.UpdatedAt = resource.CreatedAt
+	r.m.data.resources[resource.ID] = *resource
+	return nil
+}
+
+func (r memoryResources) Save(ctx context.Context, resource *model.Resource) error {
+	scope, err := tenant.Scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if old, ok := r.m.data.resources[resource.ID]; !ok || !visible(scope, old.OrganizationID) {
+		return ErrNotFound
+	}
+	resource.UpdatedAt = time.Now()
+	r.m.data.resources[resource.ID] = *resource
+	return nil
+}
+
+func (r memoryResources) Delete(ctx context.Context, resource *model.Resource) error {
+	scope, err := tenant.Scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if old, ok := r.m.data.resources[resource.ID]; ok && visible(scope, old.OrganizationID) {
+		delete(r.m.data.resources, resource.ID)
+	}
+	return nil
+}
+
+func (r memoryResources) GetGroup(ctx context.Context, id uint) (model.ResourceGroup, error) {
+	scope, err := tenant.Scope(ctx)
+	if err != nil {
+		return model.ResourceGroup{}, err
+	}
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	group, ok := r.m.data.groups[id]
+	if !ok || !visible(scope, group.OrganizationID) {
+		return model.ResourceGroup{}, ErrNotFound
+	}
+	return group, nil
+}
+
+func (r memoryResources) CountInStock(ctx context.Context, resourceID uint) (int, error) {
+	scope, err := tenant.Scope(ctx)
+	if err != nil {
+		return 0, err
+	}
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	count := 0
+	for _, item := range r.m.data.items {
+		if item.ResourceID == resourceID && item.Status == model.SerialStatusInStock && visible(scope, item.OrganizationID) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// ----------  HISTORY --------------------------------------------------
+
+type memoryHistory struct {
+	m *Memory
+}
+
+func (r memoryHistory) Create(ctx context.Context, history *model.ResourceHistory) error {
+	scope, err := tenant.Scope(ctx)
+	if err != nil {
+		return err
+	}
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if scope != 0 {
+		history.OrganizationID = scope
+	}
+	history.ID = r.m.data.nextID()
+	history.CreatedAt = time.Now()
+	history.UpdatedAt = history.CreatedAt
+	r.m.data.history[history.ID] = *history
+	return nil
+}
+
+func (r memoryHistory) ListByResource(ctx context.Context, resourceID uint) ([]model.ResourceHistory, error) {
+	scope, err := tenant.Scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	history := []model.ResourceHistory{}
+	for _, h := range r.m.data.history {
+		if h.ResourceID == resourceID && visible(scope, h.OrganizationID) {
+			h.User = r.m.data.users[h.UserID]
+			history = append(history, h)
+		}
+	}
+	sort.Slice(history, func(i, j int) bool {
+		if !history[i].Timestamp.Equal(history[j].Timestamp) {
+			return history[i].Timestamp.After(history[j].Timestamp)
+		}
+		return history[i].ID > history[j].ID
+	})
+	return history, nil
+}
+
+// ----------  USERS ----------------------------------------------------
+
+type memoryUsers struct {
+	m *Memory
+}
+
+func (r memoryUsers) List(ctx context.Context) ([]model.User, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	users := []model.User{}
+	for _, user := range r.m.data.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+func (r memoryUsers) Get(ctx context.Context, id uint) (model.User, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	user, ok := r.m.data.users[id]
+	if !ok {
+		return user, ErrNotFound
+	}
+	return user, nil
+}
+
+func (r memoryUsers) FindByUsername(ctx context.Context, username string) (model.User, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for _, user := range r.m.data.users {
+		if user.Username == username {
+			return user, nil
+		}
+	}
+	return model.User{}, ErrNotFound
+}
+
+func (r memoryUsers) Create(ctx context.Context, user *model.User) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	user.ID = r.m.data.nextID()
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = user.CreatedAt
+	r.m.data.users[user.ID] = *user
+	return nil
+}
+
+func (r memoryUsers) Save(ctx context.Context, user *model.User) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if _, ok := r.m.data.users[user.ID]; !ok {
+		return ErrNotFound
+	}
+	user.UpdatedAt = time.Now()
+	r.m.data.users[user.ID] = *user
+	return nil
+}
+
+func (r memoryUsers) Delete(ctx context.Context, user *model.User) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	delete(r.m.data.users, user.ID)
+	return nil
+}
+
+// ----------  PERMISSIONS ----------------------------------------------
+
+type memoryPermissions struct {
+	m *Memory
+}
+
+func (r memoryPermissions) Grants(ctx context.Context, user model.User, role string) (access.Grants, error) {
+	scope, err := tenant.Scope(ctx)
+	if err != nil {
+		return access.Collect(user, role, nil), err
+	}
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	rows := []model.PermissionGrant{}
+	for _, grant := range r.m.data.grants {
+		if visible(scope, grant.OrganizationID) {
+			rows = append(rows, grant)
+		}
+	}
+	return access.Collect(user, role, rows), nil
+}
@@ -0,0 +1,69 @@
+// Package repository stores resources, their history, users and permissions
+// behind interfaces, so the code using them does not depend on a database.
+// Gorm keeps them in the database, Memory in memory for tests.
+//
+// Methods take the context of the request: tenant-owned rows are read and
+// written in the organization of the context, as with tenant.WithOrganization.
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"app/access"
+	"app/model"
+)
+
+// ErrNotFound is returned when the record looked up does not exist, or
+// belongs to another organization
+var ErrNotFound = errors.New("record not found")
+
+// ResourceRepository stores resources and the groups and items they refer to
+type ResourceRepository interface {
+	// List returns the resources the grants allow the action on, by id
+	List(ctx context.Context, grants access.Grants, action string) ([]model.Resource, error)
+	Get(ctx context.Context, id uint) (model.Resource, error)
+	Create(ctx context.Context, resource *model.Resource) error
+	Save(ctx context.Context, resource *model.Resource) error
+	Delete(ctx context.Context, resource *model.Resource) error
+
+	GetGroup(ctx context.Context, id uint) (model.ResourceGroup, error)
+	// CountInStock counts the in-stock items of a serialized resource
+	CountInStock(ctx context.Context, resourceID uint) (int, error)
+}
+
+// HistoryRepository stores the change history of resources
+type HistoryRepository interface {
+	Create(ctx context.Context, history *model.ResourceHistory) error
+	// ListByResource returns the history of a resource with its users, newest first
+	ListByResource(ctx context.Context, resourceID uint) ([]model.ResourceHistory, error)
+}
+
+// UserRepository stores users, who belong to no organization
+type UserRepository interface {
+	List(ctx context.Context) ([]model.User, error)
+	Get(ctx context.Context, id uint) (model.User, error)
+	FindByUsername(ctx context.Context, username string) (model.User, error)
+	Create(ctx context.Context, user *model.User) error
+	Save(ctx context.Context, user *model.User) error
+	Delete(ctx context.Context, user *model.User) error
+}
+
+// PermissionRepository reads the permission grants of organizations
+type PermissionRepository interface {
+	// Grants returns the permissions of a user acting with a role in the
+	// organization of the context
+	Grants(ctx context.Context, user model.User, role string) (access.Grants, error)
+}
+
+// Store gives access to the repositories and runs transactions over them
+type Store interface {
+	Resources() ResourceRepository
+	History() HistoryRepository
+	Users() UserRepository
+	Permissions() PermissionRepository
+
+	// Transaction runs fn with a store whose changes are kept only when fn
+	// returns nil
+	Transaction(ctx context.Context, fn func(tx Store) error) error
+}
@@ -0,0 +1,76 @@
+package router_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"app/model"
+)
+
+// createAPIKey creates a key with the scopes through the session of its owner
+// and returns it with its id
+func (a *testApp) createAPIKey(session, scopes string) (string, uint) {
+	a.t.Helper()
+	r := a.request("POST", "/api/api-keys/", map[string]string{"name": "ERP sync", "scopes": scopes}, session)
+	expect(a.t, r, 201)
+	var created struct {
+		Key    string       `json:"key"`
+		APIKey model.APIKey `json:"api_key"`
+	}
+	r.decode(a.t, &created)
+	return created.Key, created.APIKey.ID
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	a := newTestApp(t)
+	session := a.login(a.createUser("alice", model.RoleUser))
+	resource := map[string]interface{}{"name": "Бумага", "unit": "пачка", "quantity": 10}
+
+	// A read key reads but does not write
+	read, _ := a.createAPIKey(session, "read")
+	expect(t, a.request("GET", "/api/resource/", nil, read), 200)
+	expect(t, a.request("POST", "/api/resource/", resource, read), 403)
+
+	write, _ := a.createAPIKey(session, "read write")
+	expect(t, a.request("POST", "/api/resource/", resource, write), 200)
+
+	// Keys cannot manage keys or anything else reserved to sessions
+	expect(t, a.request("GET", "/api/api-keys/", nil, write), 403)
+	expect(t, a.request("POST", "/api/api-keys/", map[string]string{"name": "Копия", "scopes": "read"}, write), 403)
+	expect(t, a.request("POST", "/api/2fa/setup", nil, write), 403)
+}
+
+func TestAPIKeyAdminScope(t *testing.T) {
+	a := newTestApp(t)
+	session := a.login(a.createUser("root", model.RoleAdmin))
+
+	// Keys of an admin reach admin endpoints with the admin scope only
+	read, _ := a.createAPIKey(session, "read write")
+	expect(t, a.request("GET", "/api/service-accounts/", nil, read), 403)
+	admin, _ := a.createAPIKey(session, "read admin")
+	expect(t, a.request("GET", "/api/service-accounts/", nil, admin), 200)
+
+	// The admin scope does not make the key of a user an admin
+	user := a.login(a.createUser("alice", model.RoleUser))
+	key, _ := a.createAPIKey(user, "read admin")
+	expect(t, a.request("GET", "/api/service-accounts/", nil, key), 403)
+}
+
+func TestAPIKeyRevokedOrExpired(t *testing.T) {
+	a := newTestApp(t)
+	session := a.login(a.createUser("alice", model.RoleUser))
+
+	revoked, id := a.createAPIKey(session, "read")
+	expect(t, a.request("GET", "/api/resource/", nil, revoked), 200)
+	expect(t, a.request("DELETE", fmt.Sprintf("/api/api-keys/%d", id), nil, session), 200)
+	expect(t, a.request("GET", "/api/resource/", nil, revoked), 401)
+
+	expired, id := a.createAPIKey(session, "read")
+	if err := a.db.Model(&model.APIKey{}).Where("id = ?", id).Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatal(err)
+	}
+	expect(t, a.request("GET", "/api/resource/", nil, expired), 401)
+
+	expect(t, a.request("GET", "/api/resource/", nil, "ik_0000000000000000"), 401)
+}
@@ -0,0 +1,142 @@
+package router_test
+
+import (
+	"testing"
+
+	"app/model"
+)
+
+func TestRegisterAndLogin(t *testing.T) {
+	a := newTestApp(t)
+
+	r := a.request("POST", "/api/auth/register", map[string]string{
+		"username": "newuser", "email": "newuser@example.com", "password": "newuser-password",
+	}, "")
+	expect(t, r, 200)
+	var registered struct {
+		ID       uint   `json:"id"`
+		Username string `json:"username"`
+	}
+	r.decode(t, &registered)
+	if registered.ID == 0 || registered.Username != "newuser" {
+		t.Fatalf("registered %+v", registered)
+	}
+
+	// Registered users join the signup organization with the user role
+	var user model.User
+	if err := a.db.First(&user, registered.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if user.Role != model.RoleUser || user.Password == "newuser-password" {
+		t.Fatalf("stored user %+v", user)
+	}
+	var memberships int64
+	a.db.Model(&model.Membership{}).Where("user_id = ?", user.ID).Count(&memberships)
+	if memberships != 1 {
+		t.Fatalf("%d memberships, want 1", memberships)
+	}
+
+	// and are welcomed along with the address verification
+	var kinds []string
+	a.db.Model(&model.Notification{}).Where("user_id = ?", user.ID).Order("kind").Pluck("kind", &kinds)
+	if len(kinds) != 2 || kinds[0] != "account_registered" || kinds[1] != "email_verification" {
+		t.Fatalf("notifications queued on registration %v", kinds)
+	}
+
+	r = a.request("POST", "/api/auth/login", map[string]string{"username": "newuser", "password": "newuser-password"}, "")
+	expect(t, r, 200)
+	var session struct {
+		Token string `json:"token"`
+		User  struct {
+			ID uint `json:"id"`
+		} `json:"user"`
+	}
+	r.decode(t, &session)
+	if session.Token == "" || session.User.ID != user.ID {
+		t.Fatalf("session %+v", session)
+	}
+
+	// Logging in by email works as well
+	r = a.request("POST", "/api/auth/login", map[string]string{"username": "newuser@example.com", "password": "newuser-password"}, "")
+	expect(t, r, 200)
+}
+
+func TestRegisterDuplicate(t *testing.T) {
+	a := newTestApp(t)
+	a.createUser("taken", model.RoleUser)
+
+	r := a.request("POST", "/api/auth/register", map[string]string{
+		"username": "taken", "email": "other@example.com", "password": "taken-password",
+	}, "")
+	expect(t, r, 500)
+}
+
+func TestLoginRejected(t *testing.T) {
+	a := newTestApp(t)
+	user := a.createUser("alice", model.RoleUser)
+
+	r := a.request("POST", "/api/auth/login", map[string]string{"username": "alice", "password": "wrong"}, "")
+	expect(t, r, 401)
+	r = a.request("POST", "/api/auth/login", map[string]string{"username": "nobody", "password": "wrong"}, "")
+	expect(t, r, 401)
+	r = a.request("POST", "/api/auth/login", "{not json", "")
+	expect(t, r, 400)
+
+	// Service accounts only use API keys
+	a.db.Model(&user).Update("service_account", true)
+	r = a.request("POST", "/api/auth/login", map[string]string{"username": "alice", "password": "alice-password"}, "")
+	expect(t, r, 403)
+}
+
+func TestLoginLockout(t *testing.T) {
+	a := newTestApp(t)
+	a.createUser("bob", model.RoleUser)
+
+	// LOGIN_MAX_FAILURES defaults to 5
+	for i := 0; i < 5; i++ {
+		r := a.request("POST", "/api/auth/login", map[string]string{"username": "bob", "password": "wrong"}, "")
+		expect(t, r, 401)
+	}
+	r := a.request("POST", "/api/auth/login", map[string]string{"username": "bob", "password": "bob-password"}, "")
+	expect(t, r, 429)
+}
+
+func TestRegisterRateLimit(t *testing.T) {
+	a := newTestApp(t)
+
+	// Five registrations per hour; invalid bodies count as well
+	for i := 0; i < 5; i++ {
+		r := a.request("POST", "/api/auth/register", "{not json", "")
+		expect(t, r, 400)
+	}
+	r := a.request("POST", "/api/auth/register", "{not json", "")
+	expect(t, r, 429)
+
+	// Creating a user is registering under another path
+	r = a.request("POST", "/api/user/", "{not json", "")
+	expect(t, r, 429)
+}
+
+func TestProtectedRoutes(t *testing.T) {
+	a := newTestApp(t)
+	user := a.createUser("carol", model.RoleUser)
+
+	r := a.request("GET", "/api/resource/", nil, "")
+	expect(t, r, 400)
+	if r.Message != "Missing or malformed JWT" {
+		t.Fatalf("message %q", r.Message)
+	}
+	r = a.request("GET", "/api/resource/", nil, "not.a.token")
+	expect(t, r, 401)
+
+	token := a.login(user)
+	r = a.request("GET", "/api/resource/", nil, token)
+	expect(t, r, 200)
+
+	// Admin routes refuse other roles
+	r = a.request("GET", "/api/signing-keys/", nil, token)
+	expect(t, r, 403)
+	admin := a.login(a.createUser("root", model.RoleAdmin))
+	r = a.request("GET", "/api/signing-keys/", nil, admin)
+	expect(t, r, 200)
+}
@@ -0,0 +1,40 @@
+package router_test
+
+import "testing"
+
+func TestHealthChecks(t *testing.T) {
+	a := newTestApp(t)
+
+	expect(t, a.request("GET", "/healthz", nil, ""), 200)
+	expect(t, a.request("GET", "/readyz", nil, ""), 200)
+
+	// A database missing a migration is not ready
+	if err := a.db.Exec("DELETE FROM schema_migrations WHERE version = 2").Error; err != nil {
+		t.Fatal(err)
+	}
+	r := a.request("GET", "/readyz", nil, "")
+	expect(t, r, 503)
+	var pending []int
+	r.decode(t, &pending)
+	if len(pending) != 1 || pending[0] != 2 {
+		t.Fatalf("pending %v, want [2]", pending)
+	}
+}
+
+func TestDatabaseDown(t *testing.T) {
+	a := newTestApp(t)
+	sqlDB, err := a.db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.Close()
+
+	// The process stays alive but neither ready nor able to serve data
+	expect(t, a.request("GET", "/healthz", nil, ""), 200)
+	expect(t, a.request("GET", "/readyz", nil, ""), 503)
+	r := a.request("GET", "/api/user/", nil, "")
+	expect(t, r, 503)
+	if r.Message != "Database unavailable, try again later" {
+		t.Fatalf("message %q", r.Message)
+	}
+}
@@ -0,0 +1,67 @@
+package router_test
+
+import (
+	"fmt"
+	"testing"
+
+	"app/model"
+)
+
+func TestUpdateItem(t *testing.T) {
+	a := newTestApp(t)
+	user := a.createUser("alice", model.RoleUser)
+	token := a.login(user)
+
+	r := a.request("POST", "/api/resource/", map[string]interface{}{"name": "Ноутбуки", "unit": "шт", "serialized": true}, token)
+	expect(t, r, 200)
+	var laptops model.Resource
+	r.decode(t, &laptops)
+	r = a.request("POST", fmt.Sprintf("/api/resource/%d/items", laptops.ID), map[string]string{"serial_number": "SN-1"}, token)
+	expect(t, r, 200)
+	var item model.SerialItem
+	r.decode(t, &item)
+	path := fmt.Sprintf("/api/items/%d", item.ID)
+
+	// Each change applies to the item as the last one left it
+	expect(t, a.request("PATCH", path, map[string]interface{}{"assignee_id": user.ID}, token), 200)
+	r = a.request("PATCH", path, map[string]interface{}{"note": "Царапина на крышке"}, token)
+	expect(t, r, 200)
+	r.decode(t, &item)
+	if item.Status != model.SerialStatusAssigned || item.AssigneeID == nil || *item.AssigneeID != user.ID || item.Note == "" {
+		t.Fatalf("item after a note %+v", item)
+	}
+	expect(t, a.request("PATCH", path, map[string]interface{}{"status": model.SerialStatusAssigned}, token), 200)
+
+	r = a.request("PATCH", path, map[string]interface{}{"status": model.SerialStatusInStock}, token)
+	expect(t, r, 200)
+	var returned model.SerialItem
+	r.decode(t, &returned)
+	if returned.AssigneeID != nil || returned.Note == "" {
+		t.Fatalf("item back in stock %+v", returned)
+	}
+	expect(t, a.request("PATCH", path, map[string]interface{}{"status": model.SerialStatusAssigned}, token), 400)
+	expect(t, a.request("PATCH", path, map[string]interface{}{"assignee_id": 999}, token), 400)
+	expect(t, a.request("PATCH", "/api/items/999", map[string]interface{}{"note": "?"}, token), 404)
+
+	var resource model.Resource
+	r = a.request("GET", fmt.Sprintf("/api/resource/%d", laptops.ID), nil, token)
+	r.decode(t, &resource)
+	if resource.Quantity != 1 {
+		t.Fatalf("quantity %d with the item in stock, want 1", resource.Quantity)
+	}
+	r = a.request("GET", path+"/history", nil, token)
+	expect(t, r, 200)
+	var history []model.ResourceHistory
+	r.decode(t, &history)
+	// Newest first: returned, assigned again to the same user, noted, assigned
+	// and added. Only a change of assignee is logged as an assignment.
+	want := []string{"ITEM_STATUS", "ITEM_UPDATE", "ITEM_UPDATE", "ASSIGN", "ITEM_ADD"}
+	if len(history) != len(want) {
+		t.Fatalf("history %+v", history)
+	}
+	for i, action := range want {
+		if history[i].Action != action {
+			t.Errorf("history[%d] action %s, want %s", i, history[i].Action, action)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package router_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"app/config"
+	"app/database"
+	"app/model"
+	"app/ratelimit"
+	"app/repository"
+	"app/router"
+	"app/service"
+	"app/signing"
+	"app/tenant"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// The tests run the routes of SetupRoutes against an in-memory SQLite
+// database created and migrated for each test. The database, signing keys
+// and settings are package globals, so tests must not run in parallel.
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// testApp is the API on a fresh database
+type testApp struct {
+	t   *testing.T
+	app *fiber.App
+	db  *gorm.DB
+}
+
+var apps int
+
+func newTestApp(t *testing.T) *testApp {
+	t.Helper()
+	apps++
+	_, err := config.Load([]string{
+		"-secret=test-secret", "-db-driver=sqlite",
+		fmt.Sprintf("-db-dsn=file:test%d?mode=memory&cache=shared", apps),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Open(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	db := database.DB
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	db.Logger = logger.Default.LogMode(logger.Silent)
+
+	if err := database.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	ratelimit.SetShared(ratelimit.NewDBStore(db))
+	if err := database.RegisterCallbacks(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := signing.Rotate(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := signing.Init(db); err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	router.SetupRoutes(app, service.New(repository.NewGorm(db)))
+	return &testApp{t: t, app: app, db: db}
+}
+
+// response is the JSON envelope every endpoint answers with
+type response struct {
+	Status  string          `json:"status"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+	Errors  interface{}     `json:"errors"`
+
+	code int
+}
+
+// decode reads the data of the response into v
+func (r response) decode(t *testing.T, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(r.Data, v); err != nil {
+		t.Fatalf("cannot decode %s: %v", r.Data, err)
+	}
+}
+
+// request calls the API with a JSON body, or a raw one when body is a string,
+// authenticated by token unless it is empty
+func (a *testApp) request(method, path string, body interface{}, token string) response {
+	a.t.Helper()
+	var reader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		reader = strings.NewReader(b)
+	default:
+		content, err := json.Marshal(b)
+		if err != nil {
+			a.t.Fatal(err)
+		}
+		reader = bytes.NewReader(content)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	if token != "" {
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	}
+
+	resp, err := a.app.Test(req, -1)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	r := response{code: resp.StatusCode}
+	if len(content) > 0 {
+		if err := json.Unmarshal(content, &r); err != nil {
+			a.t.Fatalf("%s %s: answer is not JSON: %s", method, path, content)
+		}
+	}
+	return r
+}
+
+// fetch calls the API for an answer that is not JSON, such as a rendered report
+func (a *testApp) fetch(path, token string) (int, string) {
+	a.t.Helper()
+	req := httptest.NewRequest("GET", path, nil)
+	if token != "" {
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	}
+	resp, err := a.app.Test(req, -1)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return resp.StatusCode, string(content)
+}
+
+// expect fails the test unless the response has the status code and, for
+// errors, the error envelope
+func expect(t *testing.T, r response, code int) {
+	t.Helper()
+	if r.code != code {
+		t.Fatalf("status %d, want %d: %s %s %v", r.code, code, r.Message, r.Data, r.Errors)
+	}
+	want := "success"
+	if code >= 400 {
+		want = "error"
+	}
+	if r.Status != want || (code >= 400 && r.Message == "") {
+		t.Fatalf("envelope %q %q, want status %q with a message", r.Status, r.Message, want)
+	}
+}
+
+// defaultDB is the database as seen by requests in the default organization
+func (a *testApp) defaultDB() *gorm.DB {
+	a.t.Helper()
+	var organization model.Organization
+	if err := a.db.Where("slug = ?", database.DefaultOrganizationSlug).First(&organization).Error; err != nil {
+		a.t.Fatal(err)
+	}
+	return a.db.WithContext(tenant.WithOrganization(context.Background(), organization.ID))
+}
+
+// createUser adds a verified member of the default organization directly to
+// the database; the cheap hash keeps logins fast
+func (a *testApp) createUser(username, role string) model.User {
+	a.t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(username+"-password"), bcrypt.MinCost)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	now := time.Now()
+	user := model.User{
+		Username: username, Email: username + "@example.com", Password: string(hash),
+		Role: role, EmailVerifiedAt: &now,
+	}
+	if err := a.db.Create(&user).Error; err != nil {
+		a.t.Fatal(err)
+	}
+	var organization model.Organization
+	if err := a.db.Where("slug = ?", database.DefaultOrganizationSlug).First(&organization).Error; err != nil {
+		a.t.Fatal(err)
+	}
+	membership := model.Membership{UserID: user.ID, OrganizationID: organization.ID, Role: role}
+	if err := a.db.Create(&membership).Error; err != nil {
+		a.t.Fatal(err)
+	}
+	return user
+}
+
+// login logs a user made by createUser in and returns their token
+func (a *testApp) login(user model.User) string {
+	a.t.Helper()
+	r := a.request("POST", "/api/auth/login", map[string]string{
+		"username": user.Username, "password": user.Username + "-password",
+	}, "")
+	expect(a.t, r, 200)
+	var data struct {
+		Token string `json:"token"`
+	}
+	r.decode(a.t, &data)
+	return data.Token
+}
@@ -0,0 +1,267 @@
+package router_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"app/model"
+)
+
+// stocked is the inventory created in one organization: a resource with an
+// expired lot and a serialized resource with one item
+type stocked struct {
+	resource, laptops model.Resource
+	item              model.SerialItem
+}
+
+// twoOrganizations sets up the default organization and a branch, each with
+// its own inventory. Bob is a user in the default organization and the admin
+// of the branch; alice is a user in both.
+type twoOrganizations struct {
+	*testApp
+	root, alice, bob, aliceBranch, bobBranch string
+	aliceUser                                model.User
+	branch                                   model.Organization
+	main, other                              stocked // In the default organization and in the branch
+}
+
+func newTwoOrganizations(t *testing.T) *twoOrganizations {
+	a := newTestApp(t)
+	o := &twoOrganizations{testApp: a, root: a.login(a.createUser("root", model.RoleAdmin))}
+	o.aliceUser = a.createUser("alice", model.RoleUser)
+	bob := a.createUser("bob", model.RoleUser)
+	o.alice, o.bob = a.login(o.aliceUser), a.login(bob)
+
+	r := a.request("POST", "/api/organizations/", map[string]string{"name": "Филиал", "slug": "branch"}, o.root)
+	expect(t, r, 201)
+	r.decode(t, &o.branch)
+	for user, role := range map[uint]string{o.aliceUser.ID: model.RoleUser, bob.ID: model.RoleAdmin} {
+		path := fmt.Sprintf("/api/organizations/%d/members/%d", o.branch.ID, user)
+		expect(t, a.request("PUT", path, map[string]string{"role": role}, o.root), 200)
+	}
+	o.aliceBranch = o.switchTo(o.alice)
+	o.bobBranch = o.switchTo(o.bob)
+
+	o.main = o.stock(o.root, "")
+	o.other = o.stock(o.bobBranch, " филиала")
+	return o
+}
+
+// switchTo returns a token of the same user acting in the branch
+func (o *twoOrganizations) switchTo(token string) string {
+	o.t.Helper()
+	r := o.request("POST", fmt.Sprintf("/api/organizations/%d/switch", o.branch.ID), nil, token)
+	expect(o.t, r, 200)
+	var data struct {
+		Token string `json:"token"`
+	}
+	r.decode(o.t, &data)
+	return data.Token
+}
+
+// stock creates inventory in the organization of the token, suffix telling
+// the names apart
+func (o *twoOrganizations) stock(token, suffix string) stocked {
+	t := o.t
+	t.Helper()
+	var s stocked
+	r := o.request("POST", "/api/resource/", map[string]interface{}{
+		"name": "Бумага" + suffix, "unit": "пачка", "quantity": 10, "price": 100,
+	}, token)
+	expect(t, r, 200)
+	r.decode(t, &s.resource)
+	path := fmt.Sprintf("/api/resource/%d/lots", s.resource.ID)
+	expect(t, o.request("POST", path, map[string]interface{}{"quantity": 5, "expires_at": "2020-01-01"}, token), 200)
+
+	r = o.request("POST", "/api/resource/", map[string]interface{}{
+		"name": "Ноутбуки" + suffix, "unit": "шт", "serialized": true,
+	}, token)
+	expect(t, r, 200)
+	r.decode(t, &s.laptops)
+	r = o.request("POST", fmt.Sprintf("/api/resource/%d/items", s.laptops.ID), map[string]string{"serial_number": "SN" + suffix}, token)
+	expect(t, r, 200)
+	r.decode(t, &s.item)
+	return s
+}
+
+func TestOrganizationsIsolateInventory(t *testing.T) {
+	o := newTwoOrganizations(t)
+
+	// Resources and their history
+	r := o.request("GET", "/api/resource/", nil, o.aliceBranch)
+	expect(t, r, 200)
+	var resources []model.Resource
+	r.decode(t, &resources)
+	if len(resources) != 2 {
+		t.Fatalf("%d resources listed in the branch, want 2", len(resources))
+	}
+	for _, resource := range resources {
+		if resource.OrganizationID != o.branch.ID {
+			t.Fatalf("resource %q of organization %d listed in the branch", resource.Name, resource.OrganizationID)
+		}
+	}
+	expect(t, o.request("GET", fmt.Sprintf("/api/resource/%d", o.main.resource.ID), nil, o.aliceBranch), 404)
+	expect(t, o.request("GET", fmt.Sprintf("/api/resource/%d/history", o.main.resource.ID), nil, o.aliceBranch), 404)
+
+	// Lots and items
+	r = o.request("GET", "/api/lots/expiring", nil, o.aliceBranch)
+	expect(t, r, 200)
+	var lots []model.Lot
+	r.decode(t, &lots)
+	if len(lots) != 1 || lots[0].ResourceID != o.other.resource.ID {
+		t.Fatalf("lots %+v", lots)
+	}
+	r = o.request("GET", "/api/items/", nil, o.aliceBranch)
+	expect(t, r, 200)
+	var items []model.SerialItem
+	r.decode(t, &items)
+	if len(items) != 1 || items[0].ID != o.other.item.ID {
+		t.Fatalf("items %+v", items)
+	}
+	expect(t, o.request("GET", fmt.Sprintf("/api/items/%d", o.main.item.ID), nil, o.aliceBranch), 404)
+
+	// Stocktakes
+	r = o.request("POST", "/api/stocktakes/", map[string]string{}, o.aliceBranch)
+	expect(t, r, 200)
+	var stocktake model.Stocktake
+	r.decode(t, &stocktake)
+	// Serialized resources are counted by item, outside stocktakes
+	if len(stocktake.Lines) != 1 || stocktake.Lines[0].ResourceID != o.other.resource.ID {
+		t.Fatalf("lines of the branch stocktake %+v", stocktake.Lines)
+	}
+	count := map[string]interface{}{"counts": []map[string]interface{}{{"resource_id": o.main.resource.ID, "quantity": 1}}}
+	expect(t, o.request("PUT", fmt.Sprintf("/api/stocktakes/%d/counts", stocktake.ID), count, o.aliceBranch), 400)
+	expect(t, o.request("GET", fmt.Sprintf("/api/stocktakes/%d", stocktake.ID), nil, o.alice), 404)
+	// Each organization has its own open session
+	expect(t, o.request("POST", "/api/stocktakes/", map[string]string{}, o.alice), 200)
+
+	// Reports
+	var report struct {
+		Resources []struct {
+			ResourceID uint `json:"resource_id"`
+		} `json:"resources"`
+	}
+	r = o.request("GET", "/api/reports/valuation", nil, o.aliceBranch)
+	expect(t, r, 200)
+	r.decode(t, &report)
+	for _, row := range report.Resources {
+		if row.ResourceID != o.other.resource.ID && row.ResourceID != o.other.laptops.ID {
+			t.Fatalf("valuation of the branch reports resource %d", row.ResourceID)
+		}
+	}
+	expect(t, o.request("GET", fmt.Sprintf("/api/reports/forecast?resource_id=%d", o.main.resource.ID), nil, o.aliceBranch), 404)
+	code, body := o.fetch("/api/reports/inventory?format=html", o.aliceBranch)
+	if code != 200 || !strings.Contains(body, o.other.resource.Name) || strings.Contains(body, ">"+o.main.resource.Name+"<") {
+		t.Fatalf("inventory report of the branch %d: %s", code, body)
+	}
+
+	expect(t, o.request("POST", "/api/reports/generated", nil, o.bobBranch), 200)
+	var reports []model.GeneratedReport
+	r = o.request("GET", "/api/reports/generated", nil, o.root)
+	expect(t, r, 200)
+	r.decode(t, &reports)
+	if len(reports) != 0 {
+		t.Fatalf("%d reports of the branch listed in the default organization", len(reports))
+	}
+	r = o.request("GET", "/api/reports/generated", nil, o.bobBranch)
+	expect(t, r, 200)
+	r.decode(t, &reports)
+	if len(reports) != 1 || reports[0].OrganizationID != o.branch.ID {
+		t.Fatalf("reports %+v", reports)
+	}
+}
+
+func TestOrganizationItemAssignee(t *testing.T) {
+	o := newTwoOrganizations(t)
+	carol := o.createUser("carol", model.RoleUser)
+
+	// Items are assigned to members of their organization only
+	path := fmt.Sprintf("/api/items/%d", o.other.item.ID)
+	expect(t, o.request("PATCH", path, map[string]interface{}{"assignee_id": carol.ID}, o.bobBranch), 400)
+	r := o.request("PATCH", path, map[string]interface{}{"assignee_id": o.aliceUser.ID}, o.bobBranch)
+	expect(t, r, 200)
+	var item model.SerialItem
+	r.decode(t, &item)
+	if item.AssigneeID == nil || *item.AssigneeID != o.aliceUser.ID || item.Status != model.SerialStatusAssigned {
+		t.Fatalf("assigned item %+v", item)
+	}
+}
+
+func TestOrganizationsIsolatePermissions(t *testing.T) {
+	o := newTwoOrganizations(t)
+
+	// Groups are seen and named within their organization only
+	r := o.request("POST", "/api/resource-groups/", map[string]string{"name": "Серверная"}, o.root)
+	expect(t, r, 201)
+	var group model.ResourceGroup
+	r.decode(t, &group)
+	r = o.request("GET", "/api/resource-groups/", nil, o.bobBranch)
+	expect(t, r, 200)
+	var groups []model.ResourceGroup
+	r.decode(t, &groups)
+	if len(groups) != 0 {
+		t.Fatalf("groups of another organization listed: %+v", groups)
+	}
+	expect(t, o.request("POST", "/api/resource-groups/", map[string]string{"name": "Серверная"}, o.bobBranch), 201)
+	expect(t, o.request("PUT", fmt.Sprintf("/api/resource-groups/%d", group.ID), map[string]string{"name": "Склад"}, o.bobBranch), 404)
+	expect(t, o.request("DELETE", fmt.Sprintf("/api/resource-groups/%d", group.ID), nil, o.bobBranch), 404)
+
+	// Nor can they be assigned or granted in another organization
+	path := fmt.Sprintf("/api/resource/%d", o.other.resource.ID)
+	expect(t, o.request("PUT", path, map[string]interface{}{"group_id": group.ID}, o.bobBranch), 400)
+	grant := map[string]interface{}{"role": model.RoleUser, "action": model.ActionRead, "group_id": group.ID}
+	expect(t, o.request("POST", "/api/permissions/", grant, o.bobBranch), 404)
+
+	// The branch admin manages the grants of the branch, not those of the
+	// organization where they are a plain user
+	expect(t, o.request("GET", "/api/permissions/", nil, o.bob), 403)
+	r = o.request("GET", "/api/permissions/?role=user", nil, o.bobBranch)
+	expect(t, r, 200)
+	var grants []model.PermissionGrant
+	r.decode(t, &grants)
+	if len(grants) != len(model.Actions) {
+		t.Fatalf("%d role grants in a new organization, want %d", len(grants), len(model.Actions))
+	}
+	for _, grant := range grants {
+		if grant.OrganizationID != o.branch.ID {
+			t.Fatalf("grant %d of organization %d listed in the branch", grant.ID, grant.OrganizationID)
+		}
+		expect(t, o.request("DELETE", fmt.Sprintf("/api/permissions/%d", grant.ID), nil, o.bobBranch), 200)
+	}
+
+	// Users are granted actions where they are members only, and their grants
+	// stay there
+	carol := o.createUser("carol", model.RoleUser)
+	grant = map[string]interface{}{"user_id": carol.ID, "action": model.ActionRead}
+	expect(t, o.request("POST", "/api/permissions/", grant, o.bobBranch), 404)
+	grant = map[string]interface{}{"user_id": o.aliceUser.ID, "action": model.ActionRead}
+	expect(t, o.request("POST", "/api/permissions/", grant, o.root), 201)
+	if n := o.resourceCount(o.aliceBranch); n != 0 {
+		t.Fatalf("%d resources listed in the branch without a grant there", n)
+	}
+	if n := o.resourceCount(o.alice); n != 2 {
+		t.Fatalf("%d resources listed in the default organization, want 2", n)
+	}
+}
+
+// resourceCount is the number of resources listed to the token
+func (o *twoOrganizations) resourceCount(token string) int {
+	o.t.Helper()
+	r := o.request("GET", "/api/resource/", nil, token)
+	expect(o.t, r, 200)
+	var resources []model.Resource
+	r.decode(o.t, &resources)
+	return len(resources)
+}
+
+func TestOrganizationSerialNumbers(t *testing.T) {
+	o := newTwoOrganizations(t)
+
+	// A serial number is taken within its organization only
+	path := fmt.Sprintf("/api/resource/%d/items", o.main.laptops.ID)
+	expect(t, o.request("POST", path, map[string]string{"serial_number": "SN"}, o.root), 409)
+	path = fmt.Sprintf("/api/resource/%d/items", o.other.laptops.ID)
+	expect(t, o.request("POST", path, map[string]string{"serial_number": "SN"}, o.bobBranch), 200)
+	expect(t, o.request("POST", path, map[string]string{"serial_number": "SN"}, o.bobBranch), 409)
+}
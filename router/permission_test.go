@@ -0,0 +1,181 @@
+package router_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"app/model"
+)
+
+// groupRestricted sets up two resource groups with a plain resource, a lot and
+// a serialized item in each, and a user who may only read and adjust the first
+type groupRestricted struct {
+	*testApp
+	admin, token string
+	user         model.User
+	// In the group the user may access and in the other one
+	allowed, hidden         model.Resource
+	allowedItem, hiddenItem model.SerialItem
+}
+
+func newGroupRestricted(t *testing.T) *groupRestricted {
+	a := newTestApp(t)
+	g := &groupRestricted{testApp: a, admin: a.login(a.createUser("root", model.RoleAdmin))}
+	g.user = a.createUser("alice", model.RoleUser)
+	g.token = a.login(g.user)
+
+	var groups [2]model.ResourceGroup
+	for i, name := range []string{"Канцелярия", "Серверная"} {
+		r := a.request("POST", "/api/resource-groups/", map[string]string{"name": name}, g.admin)
+		expect(t, r, 201)
+		r.decode(t, &groups[i])
+	}
+
+	var resources, items [2]model.Resource
+	var serial [2]model.SerialItem
+	for i, group := range groups {
+		r := a.request("POST", "/api/resource/", map[string]interface{}{
+			"name": "Расходники " + group.Name, "unit": "шт", "quantity": 10, "group_id": group.ID, "price": 100,
+		}, g.admin)
+		expect(t, r, 200)
+		r.decode(t, &resources[i])
+
+		path := fmt.Sprintf("/api/resource/%d/lots", resources[i].ID)
+		expect(t, a.request("POST", path, map[string]interface{}{"quantity": 5, "expires_at": "2020-01-01"}, g.admin), 200)
+
+		r = a.request("POST", "/api/resource/", map[string]interface{}{
+			"name": "Ноутбуки " + group.Name, "unit": "шт", "group_id": group.ID, "serialized": true,
+		}, g.admin)
+		expect(t, r, 200)
+		r.decode(t, &items[i])
+		r = a.request("POST", fmt.Sprintf("/api/resource/%d/items", items[i].ID), map[string]string{"serial_number": fmt.Sprintf("SN-%d", i)}, g.admin)
+		expect(t, r, 200)
+		r.decode(t, &serial[i])
+	}
+	g.allowed, g.hidden = resources[0], resources[1]
+	g.allowedItem, g.hiddenItem = serial[0], serial[1]
+
+	// The user keeps only what is granted to them on the first group
+	if err := a.defaultDB().Where("user_id IS NULL AND role = ?", model.RoleUser).Delete(&model.PermissionGrant{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, action := range []string{model.ActionRead, model.ActionAdjust} {
+		r := a.request("POST", "/api/permissions/", map[string]interface{}{
+			"user_id": g.user.ID, "action": action, "group_id": groups[0].ID,
+		}, g.admin)
+		expect(t, r, 201)
+	}
+	return g
+}
+
+func TestGroupRestrictedLists(t *testing.T) {
+	g := newGroupRestricted(t)
+
+	r := g.request("GET", "/api/items/", nil, g.token)
+	expect(t, r, 200)
+	var items []model.SerialItem
+	r.decode(t, &items)
+	if len(items) != 1 || items[0].ID != g.allowedItem.ID {
+		t.Fatalf("items %+v", items)
+	}
+	expect(t, g.request("GET", fmt.Sprintf("/api/items/%d", g.allowedItem.ID), nil, g.token), 200)
+	expect(t, g.request("GET", fmt.Sprintf("/api/items/%d", g.hiddenItem.ID), nil, g.token), 404)
+	expect(t, g.request("GET", fmt.Sprintf("/api/items/%d/history", g.hiddenItem.ID), nil, g.token), 404)
+
+	r = g.request("GET", "/api/lots/expiring", nil, g.token)
+	expect(t, r, 200)
+	var lots []model.Lot
+	r.decode(t, &lots)
+	if len(lots) != 1 || lots[0].ResourceID != g.allowed.ID {
+		t.Fatalf("lots %+v", lots)
+	}
+
+	// Admins still see both groups
+	r = g.request("GET", "/api/lots/expiring", nil, g.admin)
+	expect(t, r, 200)
+	r.decode(t, &lots)
+	if len(lots) != 2 {
+		t.Fatalf("%d lots listed to an admin, want 2", len(lots))
+	}
+}
+
+func TestGroupRestrictedReports(t *testing.T) {
+	g := newGroupRestricted(t)
+
+	var report struct {
+		Resources []struct {
+			ResourceID uint `json:"resource_id"`
+		} `json:"resources"`
+	}
+	for _, path := range []string{"/api/reports/valuation", "/api/reports/forecast"} {
+		r := g.request("GET", path, nil, g.token)
+		expect(t, r, 200)
+		r.decode(t, &report)
+		for _, row := range report.Resources {
+			if row.ResourceID == g.hidden.ID {
+				t.Fatalf("%s reports a resource of another group", path)
+			}
+		}
+		if len(report.Resources) == 0 {
+			t.Fatalf("%s reports nothing", path)
+		}
+	}
+	expect(t, g.request("GET", fmt.Sprintf("/api/reports/forecast?resource_id=%d", g.hidden.ID), nil, g.token), 404)
+
+	code, body := g.fetch("/api/reports/inventory?format=html", g.token)
+	if code != 200 || !strings.Contains(body, g.allowed.Name) || strings.Contains(body, g.hidden.Name) {
+		t.Fatalf("inventory report %d, allowed %t, hidden %t", code, strings.Contains(body, g.allowed.Name), strings.Contains(body, g.hidden.Name))
+	}
+
+	// Stored reports cover every group
+	expect(t, g.request("POST", "/api/reports/generated", nil, g.token), 403)
+	expect(t, g.request("GET", "/api/reports/generated", nil, g.token), 403)
+	expect(t, g.request("POST", "/api/reports/generated", nil, g.admin), 200)
+}
+
+func TestGroupRestrictedStocktake(t *testing.T) {
+	g := newGroupRestricted(t)
+
+	// The session the user opens only covers the resources they may read
+	r := g.request("POST", "/api/stocktakes/", map[string]string{}, g.token)
+	expect(t, r, 200)
+	var stocktake model.Stocktake
+	r.decode(t, &stocktake)
+	if len(stocktake.Lines) != 1 || stocktake.Lines[0].ResourceID != g.allowed.ID {
+		t.Fatalf("lines %+v", stocktake.Lines)
+	}
+	path := fmt.Sprintf("/api/stocktakes/%d", stocktake.ID)
+	expect(t, g.request("POST", path+"/cancel", nil, g.token), 200)
+
+	// One opened by an admin covers both groups, but the user neither sees
+	// nor counts the other one
+	r = g.request("POST", "/api/stocktakes/", map[string]string{}, g.admin)
+	expect(t, r, 200)
+	r.decode(t, &stocktake)
+	path = fmt.Sprintf("/api/stocktakes/%d", stocktake.ID)
+	r = g.request("GET", path, nil, g.token)
+	expect(t, r, 200)
+	r.decode(t, &stocktake)
+	if len(stocktake.Lines) != 1 {
+		t.Fatalf("%d lines shown, want 1", len(stocktake.Lines))
+	}
+	count := func(resource model.Resource, quantity int) map[string]interface{} {
+		return map[string]interface{}{"counts": []map[string]interface{}{{"resource_id": resource.ID, "quantity": quantity}}}
+	}
+	expect(t, g.request("PUT", path+"/counts", count(g.hidden, 7), g.token), 400)
+	expect(t, g.request("PUT", path+"/counts", count(g.allowed, 9), g.token), 200)
+
+	// Posting adjusts the other group too, which the user may not do; the
+	// received lot left 15 in stock
+	expect(t, g.request("PUT", path+"/counts", count(g.hidden, 7), g.admin), 200)
+	expect(t, g.request("POST", path+"/post", nil, g.token), 403)
+	r = g.request("GET", fmt.Sprintf("/api/resource/%d", g.allowed.ID), nil, g.token)
+	expect(t, r, 200)
+	var unchanged model.Resource
+	r.decode(t, &unchanged)
+	if unchanged.Quantity != 15 {
+		t.Fatalf("quantity %d after a refused post, want 15", unchanged.Quantity)
+	}
+	expect(t, g.request("POST", path+"/post", nil, g.admin), 200)
+}
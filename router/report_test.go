@@ -0,0 +1,60 @@
+package router_test
+
+import (
+	"fmt"
+	"testing"
+
+	"app/model"
+)
+
+func TestReportAccessToken(t *testing.T) {
+	a := newTestApp(t)
+	admin := a.login(a.createUser("root", model.RoleAdmin))
+	a.createResource(admin, "Бумага", 10)
+
+	var generated struct {
+		ID          uint    `json:"id"`
+		AccessToken *string `json:"access_token"`
+	}
+	r := a.request("POST", "/api/reports/generated", nil, admin)
+	expect(t, r, 200)
+	r.decode(t, &generated)
+	if generated.AccessToken == nil {
+		t.Fatal("no access token on the generated report")
+	}
+	shared := "/api/shared-reports/" + *generated.AccessToken
+	if code, _ := a.fetch(shared, ""); code != 200 {
+		t.Fatalf("shared report %d, want 200", code)
+	}
+
+	// The token is shown once, not in the list
+	r = a.request("GET", "/api/reports/generated", nil, admin)
+	expect(t, r, 200)
+	var reports []map[string]interface{}
+	r.decode(t, &reports)
+	if len(reports) != 1 {
+		t.Fatalf("%d reports, want 1", len(reports))
+	}
+	if _, ok := reports[0]["access_token"]; ok {
+		t.Fatal("the list shows the access token")
+	}
+
+	// Admins rotate and revoke it
+	path := fmt.Sprintf("/api/reports/generated/%d/token", generated.ID)
+	user := a.login(a.createUser("alice", model.RoleUser))
+	expect(t, a.request("POST", path, nil, user), 403)
+	r = a.request("POST", path, nil, admin)
+	expect(t, r, 200)
+	r.decode(t, &generated)
+	if code, _ := a.fetch(shared, ""); code != 404 {
+		t.Fatalf("replaced token %d, want 404", code)
+	}
+	shared = "/api/shared-reports/" + *generated.AccessToken
+	if code, _ := a.fetch(shared, ""); code != 200 {
+		t.Fatalf("rotated token %d, want 200", code)
+	}
+	expect(t, a.request("DELETE", path, nil, admin), 200)
+	if code, _ := a.fetch(shared, ""); code != 404 {
+		t.Fatalf("revoked token %d, want 404", code)
+	}
+}
@@ -0,0 +1,211 @@
+package router_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"app/model"
+	"app/tenant"
+)
+
+func TestResourceCRUD(t *testing.T) {
+	a := newTestApp(t)
+	user := a.createUser("alice", model.RoleUser)
+	token := a.login(user)
+
+	r := a.request("POST", "/api/resource/", map[string]interface{}{
+		"name": "Бумага А4", "unit": "пачка", "quantity": 10, "unit_cost": 250.5, "currency": "RUB",
+	}, token)
+	expect(t, r, 200)
+	var created model.Resource
+	r.decode(t, &created)
+	if created.ID == 0 || created.Quantity != 10 || created.OrganizationID == 0 {
+		t.Fatalf("created %+v", created)
+	}
+	path := fmt.Sprintf("/api/resource/%d", created.ID)
+
+	r = a.request("GET", path, nil, token)
+	expect(t, r, 200)
+	var found model.Resource
+	r.decode(t, &found)
+	if found.Name != "Бумага А4" {
+		t.Fatalf("found %+v", found)
+	}
+
+	r = a.request("GET", "/api/resource/", nil, token)
+	expect(t, r, 200)
+	var list []model.Resource
+	r.decode(t, &list)
+	if len(list) != 1 || list[0].ID != created.ID {
+		t.Fatalf("list %+v", list)
+	}
+
+	r = a.request("PUT", path, map[string]interface{}{"description": "Офисная", "quantity": 15}, token)
+	expect(t, r, 200)
+	var updated model.Resource
+	r.decode(t, &updated)
+	if updated.Description != "Офисная" || updated.Quantity != 15 || updated.Name != "Бумага А4" {
+		t.Fatalf("updated %+v", updated)
+	}
+
+	expect(t, a.request("DELETE", path, nil, token), 200)
+	expect(t, a.request("GET", path, nil, token), 404)
+	expect(t, a.request("PUT", path, map[string]interface{}{"quantity": 1}, token), 404)
+	expect(t, a.request("DELETE", path, nil, token), 404)
+}
+
+func TestResourceHistory(t *testing.T) {
+	a := newTestApp(t)
+	user := a.createUser("alice", model.RoleUser)
+	token := a.login(user)
+
+	r := a.request("POST", "/api/resource/", map[string]interface{}{"name": "Картридж", "unit": "шт", "quantity": 2}, token)
+	expect(t, r, 200)
+	var resource model.Resource
+	r.decode(t, &resource)
+	path := fmt.Sprintf("/api/resource/%d", resource.ID)
+
+	expect(t, a.request("PUT", path, map[string]interface{}{"quantity": 5, "unit_cost": 900}, token), 200)
+
+	r = a.request("GET", path+"/history", nil, token)
+	expect(t, r, 200)
+	var history []model.ResourceHistory
+	r.decode(t, &history)
+	if len(history) != 2 {
+		t.Fatalf("%d history entries, want 2", len(history))
+	}
+	update, create := history[0], history[1]
+	if create.Action != "CREATE" || update.Action != "UPDATE" {
+		t.Fatalf("actions %q, %q; want UPDATE first", update.Action, create.Action)
+	}
+	if update.UserID != user.ID || update.User.Username != "alice" {
+		t.Fatalf("update by %d %q", update.UserID, update.User.Username)
+	}
+	if update.UnitCost == nil || *update.UnitCost != 900 {
+		t.Fatalf("unit cost %v, want 900", update.UnitCost)
+	}
+	var before, after model.Resource
+	if err := json.Unmarshal([]byte(update.OldData), &before); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(update.NewData), &after); err != nil {
+		t.Fatal(err)
+	}
+	if before.Quantity != 2 || after.Quantity != 5 || create.OldData != "" {
+		t.Fatalf("snapshots %d -> %d, create old data %q", before.Quantity, after.Quantity, create.OldData)
+	}
+
+	// Deleting keeps the history, with the last state of the resource
+	expect(t, a.request("DELETE", path, nil, token), 200)
+	expect(t, a.request("GET", path+"/history", nil, token), 404)
+	var deleted model.ResourceHistory
+	ctx := tenant.WithOrganization(context.Background(), resource.OrganizationID)
+	if err := a.db.WithContext(ctx).Where("resource_id = ? AND action = ?", resource.ID, "DELETE").First(&deleted).Error; err != nil {
+		t.Fatal(err)
+	}
+	if deleted.OldData == "" || deleted.NewData != "" {
+		t.Fatalf("delete snapshots %q, %q", deleted.OldData, deleted.NewData)
+	}
+}
+
+func TestResourceErrors(t *testing.T) {
+	a := newTestApp(t)
+	token := a.login(a.createUser("alice", model.RoleUser))
+
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		body   interface{}
+		code   int
+	}{
+		{"invalid json", "POST", "/api/resource/", "{not json", 400},
+		{"missing unit", "POST", "/api/resource/", map[string]interface{}{"name": "Скрепки"}, 400},
+		{"short name", "POST", "/api/resource/", map[string]interface{}{"name": "x", "unit": "шт"}, 400},
+		{"negative quantity", "POST", "/api/resource/", map[string]interface{}{"name": "Скрепки", "unit": "шт", "quantity": -1}, 400},
+		{"bad currency", "POST", "/api/resource/", map[string]interface{}{"name": "Скрепки", "unit": "шт", "currency": "XXXX"}, 400},
+		{"serialized quantity", "POST", "/api/resource/", map[string]interface{}{"name": "Ноутбук", "unit": "шт", "quantity": 3, "serialized": true}, 400},
+		{"unknown group", "POST", "/api/resource/", map[string]interface{}{"name": "Скрепки", "unit": "шт", "group_id": 99}, 400},
+		{"invalid id", "GET", "/api/resource/abc", nil, 400},
+		{"unknown id", "GET", "/api/resource/999", nil, 404},
+		{"unknown history", "GET", "/api/resource/999/history", nil, 404},
+		{"update invalid id", "PUT", "/api/resource/abc", map[string]interface{}{}, 400},
+		{"delete invalid id", "DELETE", "/api/resource/abc", nil, 400},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			expect(t, a.request(tc.method, tc.path, tc.body, token), tc.code)
+		})
+	}
+}
+
+func TestResourcePermissions(t *testing.T) {
+	a := newTestApp(t)
+	token := a.login(a.createUser("alice", model.RoleUser))
+	admin := a.login(a.createUser("root", model.RoleAdmin))
+
+	r := a.request("POST", "/api/resource/", map[string]interface{}{"name": "Стулья", "unit": "шт", "quantity": 4}, token)
+	expect(t, r, 200)
+	var resource model.Resource
+	r.decode(t, &resource)
+	path := fmt.Sprintf("/api/resource/%d", resource.ID)
+
+	// Without the update grant the user may still adjust the quantity
+	if err := a.defaultDB().Where("role = ? AND action = ?", model.RoleUser, model.ActionUpdate).Delete(&model.PermissionGrant{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	expect(t, a.request("PUT", path, map[string]interface{}{"name": "Кресла"}, token), 403)
+	expect(t, a.request("PUT", path, map[string]interface{}{"quantity": 6}, token), 200)
+
+	// Moving a resource to a group is for admins only
+	group := model.ResourceGroup{Name: "Мебель"}
+	if err := a.defaultDB().Create(&group).Error; err != nil {
+		t.Fatal(err)
+	}
+	expect(t, a.request("PUT", path, map[string]interface{}{"group_id": group.ID}, token), 403)
+	expect(t, a.request("PUT", path, map[string]interface{}{"group_id": group.ID}, admin), 200)
+
+	// Resources the user may not read are not found rather than forbidden
+	if err := a.defaultDB().Where("role = ? AND action = ?", model.RoleUser, model.ActionRead).Delete(&model.PermissionGrant{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	expect(t, a.request("GET", path, nil, token), 404)
+	r = a.request("GET", "/api/resource/", nil, token)
+	expect(t, r, 200)
+	var list []model.Resource
+	r.decode(t, &list)
+	if len(list) != 0 {
+		t.Fatalf("%d resources listed without the read grant", len(list))
+	}
+	expect(t, a.request("DELETE", path, nil, token), 404)
+}
+
+func TestResourceOrganizations(t *testing.T) {
+	a := newTestApp(t)
+	token := a.login(a.createUser("alice", model.RoleUser))
+
+	other := model.Organization{Name: "Филиал", Slug: "branch"}
+	if err := a.db.Create(&other).Error; err != nil {
+		t.Fatal(err)
+	}
+	resource := model.Resource{Name: "Столы", Unit: "шт", Quantity: 3}
+	ctx := tenant.WithOrganization(context.Background(), other.ID)
+	if err := a.db.WithContext(ctx).Create(&resource).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// Resources of other organizations are out of reach
+	path := fmt.Sprintf("/api/resource/%d", resource.ID)
+	expect(t, a.request("GET", path, nil, token), 404)
+	expect(t, a.request("PUT", path, map[string]interface{}{"quantity": 0}, token), 404)
+	expect(t, a.request("DELETE", path, nil, token), 404)
+	r := a.request("GET", "/api/resource/", nil, token)
+	expect(t, r, 200)
+	var list []model.Resource
+	r.decode(t, &list)
+	if len(list) != 0 {
+		t.Fatalf("%d resources of another organization listed", len(list))
+	}
+}
@@ -1,39 +1,164 @@
 package router
 
 import (
+	"time"
+
 	"app/handler"
 	"app/middleware"
+	"app/service"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/logger"
+	"github.com/gofiber/fiber/v2/middleware/recover"
 )
 
-// SetupRoutes setup router api
-func SetupRoutes(app *fiber.App) {
+// SetupRoutes setup router api; handlers that read and change resources and
+// users do so through the services
+func SetupRoutes(app *fiber.App, services *service.Services) {
+	resources := handler.NewResourceHandler(services)
+	users := handler.NewUserHandler(services)
+
+	app.Get("/.well-known/jwks.json", handler.JWKS)
+	app.Get("/healthz", handler.Healthz)
+	app.Get("/readyz", handler.Readyz)
+
 	// Middleware
-	api := app.Group("/api", logger.New())
+	api := app.Group("/api", logger.New(), middleware.Database(), recover.New())
 	api.Get("/", handler.Hello)
 
 	// Auth
 	auth := api.Group("/auth")
-	auth.Post("/login", handler.Login)
-	auth.Post("/register", handler.Register)
+	auth.Post("/login", middleware.RateLimit("login", 10, time.Minute), handler.Login)
+	auth.Post("/register", middleware.RateLimit("register", 5, time.Hour), handler.Register)
+	auth.Post("/forgot-password", middleware.RateLimit("forgot-password", 5, time.Hour), handler.ForgotPassword)
+	auth.Post("/reset-password", middleware.RateLimit("reset-password", 10, time.Hour), handler.ResetPassword)
+	auth.Post("/verify-email", middleware.RateLimit("verify-email", 10, time.Hour), handler.VerifyEmail)
+	auth.Post("/resend-verification", middleware.Protected(), middleware.SessionOnly(), middleware.RateLimit("resend-verification", 5, time.Hour), handler.ResendVerification)
+	auth.Post("/2fa/verify", middleware.RateLimit("2fa", 10, time.Minute), handler.VerifyTwoFactor)
+	auth.Post("/2fa/enroll", middleware.RateLimit("2fa", 10, time.Minute), handler.EnrollTwoFactor)
+	auth.Post("/2fa/enroll/confirm", middleware.RateLimit("2fa", 10, time.Minute), handler.ConfirmTwoFactorEnrollment)
+	auth.Get("/oidc/login", middleware.RateLimit("oidc", 30, time.Minute), handler.OIDCLogin)
+	auth.Get("/oidc/callback", middleware.RateLimit("oidc", 30, time.Minute), handler.OIDCCallback)
+
+	// Two-factor authentication
+	twoFactor := api.Group("/2fa", middleware.Protected(), middleware.SessionOnly())
+	twoFactor.Post("/setup", handler.SetupTwoFactor)
+	twoFactor.Post("/enable", middleware.RateLimit("2fa", 10, time.Minute), handler.EnableTwoFactor)
+	twoFactor.Post("/disable", middleware.RateLimit("2fa", 10, time.Minute), handler.DisableTwoFactor)
+	twoFactor.Post("/recovery-codes", middleware.RateLimit("2fa", 10, time.Minute), handler.RegenerateRecoveryCodes)
+	twoFactor.Get("/policies", middleware.AdminOnly(), handler.GetTwoFactorPolicies)
+	twoFactor.Put("/policies/:role", middleware.AdminOnly(), handler.UpdateTwoFactorPolicy)
+
+	// Signing key
+	signingKey := api.Group("/signing-keys", middleware.Protected(), middleware.AdminOnly())
+	signingKey.Get("/", handler.GetSigningKeys)
+	signingKey.Post("/rotate", handler.RotateSigningKey)
+
+	// API key
+	apiKey := api.Group("/api-keys", middleware.Protected(), middleware.SessionOnly())
+	apiKey.Get("/", handler.GetAPIKeys)
+	apiKey.Post("/", handler.CreateAPIKey)
+	apiKey.Delete("/:id", handler.RevokeAPIKey)
+
+	// Service account
+	serviceAccount := api.Group("/service-accounts", middleware.Protected(), middleware.AdminOnly())
+	serviceAccount.Get("/", handler.GetServiceAccounts)
+	serviceAccount.Post("/", handler.CreateServiceAccount)
 
 	// User
 	user := api.Group("/user")
-	user.Get("/", handler.GetAllUsers)
-	user.Get("/:id", handler.GetUser)
-	user.Post("/", handler.CreateUser)
-	user.Patch("/:id", middleware.Protected(), handler.UpdateUser)
-	user.Delete("/:id", middleware.Protected(), handler.DeleteUser)
+	user.Get("/", users.GetAll)
+	user.Get("/:id", users.Get)
+	// Creating a user is registering: both share the register limit
+	user.Post("/", middleware.RateLimit("register", 5, time.Hour), handler.CreateUser)
+	user.Patch("/:id", middleware.Protected(), middleware.SessionOnly(), handler.UpdateUser)
+	user.Delete("/:id", middleware.Protected(), middleware.SessionOnly(), users.Delete)
+
+	// Organization
+	organization := api.Group("/organizations", middleware.Protected())
+	organization.Get("/", handler.GetOrganizations)
+	organization.Post("/", middleware.AdminOnly(), handler.CreateOrganization)
+	organization.Put("/:id", middleware.AdminOnly(), handler.UpdateOrganization)
+	organization.Post("/:id/switch", middleware.SessionOnly(), handler.SwitchOrganization)
+	organization.Get("/:id/members", handler.GetOrganizationMembers)
+	organization.Put("/:id/members/:user_id", handler.SetOrganizationMember)
+	organization.Delete("/:id/members/:user_id", handler.DeleteOrganizationMember)
 
 	// Resource
-	resource := api.Group("/resource")
-	resource.Get("/", handler.GetAllResources)
-	resource.Get("/:id", handler.GetResource)
-	resource.Post("/", middleware.Protected(), handler.CreateResource)
-	resource.Put("/:id", middleware.Protected(), handler.UpdateResource)
-	resource.Delete("/:id", middleware.Protected(), handler.DeleteResource)
-	resource.Get("/:id/history", handler.GetResourceHistory)
+	// Permissions are checked per resource, so every route needs a caller;
+	// inventory routes act in the caller's organization
+	resource := api.Group("/resource", middleware.Protected(), middleware.Tenant())
+	resource.Get("/", resources.GetAll)
+	resource.Get("/:id", resources.Get)
+	resource.Post("/", resources.Create)
+	resource.Put("/:id", resources.Update)
+	resource.Delete("/:id", resources.Delete)
+	resource.Get("/:id/history", resources.History)
+	resource.Get("/:id/lots", handler.GetResourceLots)
+	resource.Post("/:id/lots", handler.ReceiveLot)
+	resource.Post("/:id/issue", handler.IssueResource)
+	resource.Get("/:id/items", handler.GetResourceItems)
+	resource.Post("/:id/items", handler.CreateResourceItem)
+
+	// Resource group
+	resourceGroup := api.Group("/resource-groups", middleware.Protected(), middleware.Tenant())
+	resourceGroup.Get("/", handler.GetResourceGroups)
+	resourceGroup.Post("/", middleware.AdminOnly(), handler.CreateResourceGroup)
+	resourceGroup.Put("/:id", middleware.AdminOnly(), handler.UpdateResourceGroup)
+	resourceGroup.Delete("/:id", middleware.AdminOnly(), handler.DeleteResourceGroup)
+
+	// Permission
+	permission := api.Group("/permissions", middleware.Protected(), middleware.Tenant())
+	permission.Get("/me", handler.GetMyPermissions)
+	permission.Get("/", middleware.AdminOnly(), handler.GetPermissionGrants)
+	permission.Post("/", middleware.AdminOnly(), handler.CreatePermissionGrant)
+	permission.Delete("/:id", middleware.AdminOnly(), handler.DeletePermissionGrant)
+
+	// Lot
+	lot := api.Group("/lots", middleware.Protected(), middleware.Tenant())
+	lot.Get("/expiring", handler.GetExpiringLots)
+
+	// Serialized item
+	item := api.Group("/items", middleware.Protected(), middleware.Tenant())
+	item.Get("/", handler.GetItems)
+	item.Get("/:id", handler.GetItem)
+	item.Patch("/:id", handler.UpdateItem)
+	item.Get("/:id/history", handler.GetItemHistory)
+
+	// Stocktake
+	stocktake := api.Group("/stocktakes", middleware.Protected(), middleware.Tenant())
+	stocktake.Get("/", handler.GetStocktakes)
+	stocktake.Post("/", handler.OpenStocktake)
+	stocktake.Get("/:id", handler.GetStocktake)
+	stocktake.Put("/:id/counts", handler.RecordStocktakeCounts)
+	stocktake.Get("/:id/variance", handler.GetStocktakeVariance)
+	stocktake.Post("/:id/post", handler.PostStocktake)
+	stocktake.Post("/:id/cancel", handler.CancelStocktake)
+
+	// Exchange rate
+	rate := api.Group("/exchange-rates")
+	rate.Get("/", handler.GetExchangeRates)
+	rate.Post("/", middleware.Protected(), middleware.AdminOnly(), handler.CreateExchangeRate)
+	rate.Post("/import", middleware.Protected(), middleware.AdminOnly(), handler.ImportExchangeRates)
+	rate.Delete("/:id", middleware.Protected(), middleware.AdminOnly(), handler.DeleteExchangeRate)
+
+	// Report
+	report := api.Group("/reports", middleware.Protected(), middleware.Tenant())
+	report.Get("/valuation", handler.GetValuationReport)
+	report.Get("/cogs", handler.GetCOGSReport)
+	report.Get("/forecast", handler.GetForecastReport)
+	report.Get("/inventory", handler.GetInventoryReport)
+	report.Get("/generated", handler.GetGeneratedReports)
+	report.Post("/generated", handler.CreateGeneratedReport)
+	report.Get("/generated/:id/download", handler.DownloadGeneratedReport)
+	report.Post("/generated/:id/token", middleware.AdminOnly(), handler.RotateReportToken)
+	report.Delete("/generated/:id/token", middleware.AdminOnly(), handler.RevokeReportToken)
+	api.Get("/shared-reports/:token", handler.DownloadSharedReport)
 
+	// Notification
+	notification := api.Group("/notifications", middleware.Protected())
+	notification.Get("/preferences", handler.GetNotificationPreferences)
+	notification.Put("/preferences", handler.UpdateNotificationPreferences)
+	notification.Get("/", middleware.AdminOnly(), handler.GetNotifications)
+	notification.Post("/:id/retry", middleware.AdminOnly(), handler.RetryNotification)
 }
@@ -0,0 +1,136 @@
+package router_test
+
+import (
+	"fmt"
+	"testing"
+
+	"app/model"
+)
+
+// createResource adds a resource through the API, in the organization of the token
+func (a *testApp) createResource(token, name string, quantity int) model.Resource {
+	a.t.Helper()
+	r := a.request("POST", "/api/resource/", map[string]interface{}{"name": name, "unit": "шт", "quantity": quantity}, token)
+	expect(a.t, r, 200)
+	var resource model.Resource
+	r.decode(a.t, &resource)
+	return resource
+}
+
+func TestStocktakePost(t *testing.T) {
+	a := newTestApp(t)
+	user := a.createUser("alice", model.RoleUser)
+	token := a.login(user)
+	paper := a.createResource(token, "Бумага", 10)
+	pens := a.createResource(token, "Ручки", 5)
+
+	r := a.request("POST", "/api/stocktakes/", map[string]string{"note": "Квартальная"}, token)
+	expect(t, r, 200)
+	var stocktake model.Stocktake
+	r.decode(t, &stocktake)
+	if len(stocktake.Lines) != 2 {
+		t.Fatalf("%d lines, want 2", len(stocktake.Lines))
+	}
+	path := fmt.Sprintf("/api/stocktakes/%d", stocktake.ID)
+
+	// One session at a time, also when two requests race past the check
+	expect(t, a.request("POST", "/api/stocktakes/", map[string]string{}, token), 409)
+	if err := a.defaultDB().Create(&model.Stocktake{Status: model.StocktakeStatusOpen, OpenedByID: user.ID}).Error; err == nil {
+		t.Fatal("a second open session was stored")
+	}
+
+	r = a.request("PUT", path+"/counts", map[string]interface{}{"counts": []map[string]interface{}{
+		{"resource_id": paper.ID, "quantity": 8},
+		{"resource_id": pens.ID, "quantity": 5},
+	}}, token)
+	expect(t, r, 200)
+
+	r = a.request("GET", path+"/variance", nil, token)
+	expect(t, r, 200)
+	var variance struct {
+		Counted       int `json:"counted"`
+		Discrepancies int `json:"discrepancies"`
+	}
+	r.decode(t, &variance)
+	if variance.Counted != 2 || variance.Discrepancies != 1 {
+		t.Fatalf("variance %+v", variance)
+	}
+
+	r = a.request("POST", path+"/post", nil, token)
+	expect(t, r, 200)
+	var posted struct {
+		Adjusted int `json:"adjusted"`
+	}
+	r.decode(t, &posted)
+	if posted.Adjusted != 1 {
+		t.Fatalf("%d resources adjusted, want 1", posted.Adjusted)
+	}
+
+	r = a.request("GET", path, nil, token)
+	expect(t, r, 200)
+	r.decode(t, &stocktake)
+	if stocktake.Status != model.StocktakeStatusPosted || stocktake.PostedByID == nil || *stocktake.PostedByID != user.ID || stocktake.ClosedAt == nil {
+		t.Fatalf("posted stocktake %+v", stocktake)
+	}
+	expect(t, a.request("POST", path+"/post", nil, token), 409)
+
+	r = a.request("GET", fmt.Sprintf("/api/resource/%d/history", paper.ID), nil, token)
+	expect(t, r, 200)
+	var history []model.ResourceHistory
+	r.decode(t, &history)
+	if len(history) != 2 || history[0].Action != "ADJUST" {
+		t.Fatalf("history %+v", history)
+	}
+	if history[0].StocktakeID == nil || *history[0].StocktakeID != stocktake.ID {
+		t.Fatalf("adjustment of stocktake %v, want %d", history[0].StocktakeID, stocktake.ID)
+	}
+
+	var resource model.Resource
+	r = a.request("GET", fmt.Sprintf("/api/resource/%d", paper.ID), nil, token)
+	r.decode(t, &resource)
+	if resource.Quantity != 8 {
+		t.Fatalf("quantity %d, want 8", resource.Quantity)
+	}
+
+	// A new session can be opened once the last one is posted
+	expect(t, a.request("POST", "/api/stocktakes/", map[string]string{}, token), 200)
+}
+
+func TestStocktakeCancel(t *testing.T) {
+	a := newTestApp(t)
+	user := a.createUser("alice", model.RoleUser)
+	token := a.login(user)
+	paper := a.createResource(token, "Бумага", 10)
+
+	r := a.request("POST", "/api/stocktakes/", map[string]string{}, token)
+	expect(t, r, 200)
+	var stocktake model.Stocktake
+	r.decode(t, &stocktake)
+	path := fmt.Sprintf("/api/stocktakes/%d", stocktake.ID)
+
+	r = a.request("PUT", path+"/counts", map[string]interface{}{"counts": []map[string]interface{}{
+		{"resource_id": paper.ID, "quantity": 3},
+	}}, token)
+	expect(t, r, 200)
+
+	expect(t, a.request("POST", path+"/cancel", nil, token), 200)
+	r = a.request("GET", path, nil, token)
+	expect(t, r, 200)
+	r.decode(t, &stocktake)
+	if stocktake.Status != model.StocktakeStatusCancelled || stocktake.PostedByID == nil || *stocktake.PostedByID != user.ID {
+		t.Fatalf("cancelled stocktake %+v", stocktake)
+	}
+
+	// The stock is untouched and the session closed for good
+	var resource model.Resource
+	r = a.request("GET", fmt.Sprintf("/api/resource/%d", paper.ID), nil, token)
+	r.decode(t, &resource)
+	if resource.Quantity != 10 {
+		t.Fatalf("quantity %d, want 10", resource.Quantity)
+	}
+	expect(t, a.request("POST", path+"/post", nil, token), 409)
+	expect(t, a.request("PUT", path+"/counts", map[string]interface{}{"counts": []map[string]interface{}{
+		{"resource_id": paper.ID, "quantity": 4},
+	}}, token), 409)
+	expect(t, a.request("POST", "/api/stocktakes/", map[string]string{}, token), 200)
+}
@@ -0,0 +1,155 @@
+package router_test
+
+import (
+	"testing"
+	"time"
+
+	"app/model"
+	"app/totp"
+)
+
+// challenge is the answer to a correct password when a second factor is due
+type challenge struct {
+	TwoFactor      string `json:"two_factor"`
+	ChallengeToken string `json:"challenge_token"`
+	Token          string `json:"token"` // Set when no second factor is due
+}
+
+// passwordLogin logs a user made by createUser in with their password only
+func (a *testApp) passwordLogin(user model.User) challenge {
+	a.t.Helper()
+	r := a.request("POST", "/api/auth/login", map[string]string{
+		"username": user.Username, "password": user.Username + "-password",
+	}, "")
+	expect(a.t, r, 200)
+	var c challenge
+	r.decode(a.t, &c)
+	return c
+}
+
+// code is the TOTP code of the secret for the period around now at offset
+func code(t *testing.T, secret string, offset time.Duration) string {
+	t.Helper()
+	c, err := totp.Code(secret, time.Now().Add(offset))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// enrollment is what starting two-factor enrollment answers
+type enrollment struct {
+	Secret        string   `json:"secret"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// enableTwoFactor turns two-factor on for the user of the token and returns
+// the secret and the recovery codes
+func (a *testApp) enableTwoFactor(token string) enrollment {
+	a.t.Helper()
+	r := a.request("POST", "/api/2fa/setup", nil, token)
+	expect(a.t, r, 200)
+	var e enrollment
+	r.decode(a.t, &e)
+	r = a.request("POST", "/api/2fa/enable", map[string]string{"code": code(a.t, e.Secret, 0)}, token)
+	expect(a.t, r, 200)
+	r.decode(a.t, &e)
+	if len(e.RecoveryCodes) == 0 {
+		a.t.Fatal("no recovery codes")
+	}
+	return e
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	a := newTestApp(t)
+	user := a.createUser("alice", model.RoleUser)
+	e := a.enableTwoFactor(a.login(user))
+
+	c := a.passwordLogin(user)
+	if c.TwoFactor != "2fa_verify" || c.ChallengeToken == "" || c.Token != "" {
+		t.Fatalf("login answered %+v, want a challenge", c)
+	}
+
+	// The challenge is no session, and neither a wrong code nor the code
+	// used to enable two-factor lets the user in
+	expect(t, a.request("GET", "/api/permissions/me", nil, c.ChallengeToken), 401)
+	expect(t, a.request("POST", "/api/auth/2fa/enroll", map[string]string{"challenge_token": c.ChallengeToken}, ""), 401)
+	expect(t, a.request("POST", "/api/auth/2fa/verify", map[string]string{"challenge_token": c.ChallengeToken, "code": "000000"}, ""), 401)
+	expect(t, a.request("POST", "/api/auth/2fa/verify", map[string]string{"challenge_token": c.ChallengeToken, "code": code(t, e.Secret, 0)}, ""), 401)
+
+	r := a.request("POST", "/api/auth/2fa/verify", map[string]string{"challenge_token": c.ChallengeToken, "code": code(t, e.Secret, 30*time.Second)}, "")
+	expect(t, r, 200)
+	var session challenge
+	r.decode(t, &session)
+	expect(t, a.request("GET", "/api/permissions/me", nil, session.Token), 200)
+}
+
+func TestTwoFactorRecoveryCode(t *testing.T) {
+	a := newTestApp(t)
+	user := a.createUser("alice", model.RoleUser)
+	e := a.enableTwoFactor(a.login(user))
+
+	verify := func(recoveryCode string) response {
+		c := a.passwordLogin(user)
+		return a.request("POST", "/api/auth/2fa/verify", map[string]string{"challenge_token": c.ChallengeToken, "recovery_code": recoveryCode}, "")
+	}
+	expect(t, verify(e.RecoveryCodes[0]), 200)
+	// Each code works once
+	expect(t, verify(e.RecoveryCodes[0]), 401)
+	expect(t, verify(e.RecoveryCodes[1]), 200)
+}
+
+func TestTwoFactorEnforced(t *testing.T) {
+	a := newTestApp(t)
+	admin := a.login(a.createUser("root", model.RoleAdmin))
+	user := a.createUser("alice", model.RoleUser)
+	expect(t, a.request("PUT", "/api/2fa/policies/user", map[string]bool{"required": true}, admin), 200)
+
+	// Users of the role must enroll before they get a session
+	c := a.passwordLogin(user)
+	if c.TwoFactor != "2fa_enroll" || c.Token != "" {
+		t.Fatalf("login answered %+v, want an enrollment challenge", c)
+	}
+	expect(t, a.request("POST", "/api/auth/2fa/verify", map[string]string{"challenge_token": c.ChallengeToken, "code": "000000"}, ""), 401)
+
+	r := a.request("POST", "/api/auth/2fa/enroll", map[string]string{"challenge_token": c.ChallengeToken}, "")
+	expect(t, r, 200)
+	var e enrollment
+	r.decode(t, &e)
+	r = a.request("POST", "/api/auth/2fa/enroll/confirm", map[string]string{"challenge_token": c.ChallengeToken, "code": code(t, e.Secret, 0)}, "")
+	expect(t, r, 200)
+	var session struct {
+		Token         string   `json:"token"`
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	r.decode(t, &session)
+	if session.Token == "" || len(session.RecoveryCodes) == 0 {
+		t.Fatalf("enrollment answered %+v", session)
+	}
+
+	// From then on the code is asked at login, and two-factor stays on
+	if c := a.passwordLogin(user); c.TwoFactor != "2fa_verify" {
+		t.Fatalf("login after enrollment answered %+v", c)
+	}
+	disable := map[string]string{"password": "alice-password", "code": code(t, e.Secret, 30*time.Second)}
+	expect(t, a.request("POST", "/api/2fa/disable", disable, session.Token), 403)
+}
+
+func TestTwoFactorChangesLocked(t *testing.T) {
+	a := newTestApp(t)
+	user := a.createUser("alice", model.RoleUser)
+	token := a.login(user)
+	e := a.enableTwoFactor(token)
+
+	// Wrong passwords and codes count towards the lockout of the account
+	for i := 0; i < 3; i++ {
+		disable := map[string]string{"password": "wrong", "code": code(t, e.Secret, 30*time.Second)}
+		expect(t, a.request("POST", "/api/2fa/disable", disable, token), 403)
+	}
+	for i := 0; i < 2; i++ {
+		expect(t, a.request("POST", "/api/2fa/recovery-codes", map[string]string{"code": "000000"}, token), 401)
+	}
+	disable := map[string]string{"password": "alice-password", "code": code(t, e.Secret, 30*time.Second)}
+	expect(t, a.request("POST", "/api/2fa/disable", disable, token), 429)
+	expect(t, a.request("POST", "/api/2fa/recovery-codes", map[string]string{"code": e.RecoveryCodes[0]}, token), 429)
+}
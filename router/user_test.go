@@ -0,0 +1,104 @@
+package router_test
+
+import (
+	"fmt"
+	"testing"
+
+	"app/model"
+)
+
+func TestCreateUser(t *testing.T) {
+	a := newTestApp(t)
+
+	r := a.request("POST", "/api/user/", map[string]string{
+		"username": "dave", "email": "dave@example.com", "password": "dave-password", "role": model.RoleAdmin,
+	}, "")
+	expect(t, r, 200)
+	var created struct {
+		Username string `json:"username"`
+		Email    string `json:"email"`
+	}
+	r.decode(t, &created)
+	if created.Username != "dave" || created.Email != "dave@example.com" {
+		t.Fatalf("created %+v", created)
+	}
+
+	// Roles are granted by admins only
+	var user model.User
+	if err := a.db.Where("username = ?", "dave").First(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if user.Role != model.RoleUser {
+		t.Fatalf("role %q, want %q", user.Role, model.RoleUser)
+	}
+
+	r = a.request("POST", "/api/user/", map[string]string{"username": "ed", "email": "not-an-email", "password": "ed-password"}, "")
+	expect(t, r, 400)
+}
+
+func TestGetUsers(t *testing.T) {
+	a := newTestApp(t)
+	alice := a.createUser("alice", model.RoleUser)
+	a.createUser("bob", model.RoleUser)
+
+	r := a.request("GET", "/api/user/", nil, "")
+	expect(t, r, 200)
+	var users []map[string]interface{}
+	r.decode(t, &users)
+	if len(users) != 2 {
+		t.Fatalf("%d users, want 2", len(users))
+	}
+	// Anyone may list users, so only their public fields are shown
+	for _, field := range []string{"password", "role", "service_account", "totp_enabled_at"} {
+		if _, ok := users[0][field]; ok {
+			t.Errorf("users show %s", field)
+		}
+	}
+
+	r = a.request("GET", fmt.Sprintf("/api/user/%d", alice.ID), nil, "")
+	expect(t, r, 200)
+	var user model.User
+	r.decode(t, &user)
+	if user.Username != "alice" {
+		t.Fatalf("user %q, want alice", user.Username)
+	}
+
+	expect(t, a.request("GET", "/api/user/999", nil, ""), 404)
+	expect(t, a.request("GET", "/api/user/abc", nil, ""), 404)
+}
+
+func TestUpdateUser(t *testing.T) {
+	a := newTestApp(t)
+	alice := a.createUser("alice", model.RoleUser)
+	bob := a.createUser("bob", model.RoleUser)
+	token := a.login(alice)
+
+	r := a.request("PATCH", fmt.Sprintf("/api/user/%d", alice.ID), map[string]string{"names": "Alice Liddell"}, token)
+	expect(t, r, 200)
+	var updated struct {
+		Names string `json:"names"`
+	}
+	r.decode(t, &updated)
+	if updated.Names != "Alice Liddell" {
+		t.Fatalf("names %q", updated.Names)
+	}
+
+	// Users only update themselves
+	r = a.request("PATCH", fmt.Sprintf("/api/user/%d", bob.ID), map[string]string{"names": "Mallory"}, token)
+	expect(t, r, 401)
+	expect(t, a.request("PATCH", fmt.Sprintf("/api/user/%d", alice.ID), map[string]string{"names": "x"}, ""), 400)
+}
+
+func TestDeleteUser(t *testing.T) {
+	a := newTestApp(t)
+	alice := a.createUser("alice", model.RoleUser)
+	bob := a.createUser("bob", model.RoleUser)
+	token := a.login(alice)
+	path := fmt.Sprintf("/api/user/%d", alice.ID)
+
+	expect(t, a.request("DELETE", path, map[string]string{"password": "wrong"}, token), 403)
+	expect(t, a.request("DELETE", fmt.Sprintf("/api/user/%d", bob.ID), map[string]string{"password": "bob-password"}, token), 401)
+
+	expect(t, a.request("DELETE", path, map[string]string{"password": "alice-password"}, token), 200)
+	expect(t, a.request("GET", path, nil, ""), 404)
+}
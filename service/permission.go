@@ -0,0 +1,28 @@
+package service
+
+import (
+	"context"
+
+	"app/access"
+	"app/repository"
+)
+
+// PermissionService looks up what users may do
+type PermissionService struct {
+	store repository.Store
+}
+
+// NewPermissionService returns a permission service on the store
+func NewPermissionService(store repository.Store) *PermissionService {
+	return &PermissionService{store: store}
+}
+
+// Grants returns the permissions of a user acting with a role in the
+// organization of the context
+func (s *PermissionService) Grants(ctx context.Context, userID uint, role string) (access.Grants, error) {
+	user, err := s.store.Users().Get(ctx, userID)
+	if err != nil {
+		return access.Grants{}, err
+	}
+	return s.store.Permissions().Grants(ctx, user, role)
+}
@@ -0,0 +1,61 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"app/model"
+	"app/repository"
+	"app/service"
+	"app/tenant"
+)
+
+func TestPermissionGrants(t *testing.T) {
+	store := repository.NewMemory()
+	alice := model.User{Username: "alice", Role: model.RoleUser}
+	if err := store.Users().Create(context.Background(), &alice); err != nil {
+		t.Fatal(err)
+	}
+	group := uint(7)
+	store.AddGrants(
+		model.PermissionGrant{OrganizationID: 1, Role: model.RoleUser, Action: model.ActionRead},
+		model.PermissionGrant{OrganizationID: 1, UserID: &alice.ID, Action: model.ActionAdjust, GroupID: &group},
+		model.PermissionGrant{OrganizationID: 1, Role: model.RoleAdmin, Action: model.ActionDelete},
+		model.PermissionGrant{OrganizationID: 2, UserID: &alice.ID, Action: model.ActionDelete},
+	)
+	permissions := service.NewPermissionService(store)
+
+	// Grants of the user and of their role apply in their organization only
+	grants, err := permissions.Grants(tenant.WithOrganization(context.Background(), 1), alice.ID, model.RoleUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !grants.Allows(model.ActionRead, nil) || !grants.Allows(model.ActionAdjust, &group) {
+		t.Fatalf("grants of the organization not applied: %v", grants.Summary())
+	}
+	if grants.Allows(model.ActionAdjust, nil) || grants.Allows(model.ActionDelete, nil) {
+		t.Fatalf("grants of another organization or role applied: %v", grants.Summary())
+	}
+
+	grants, err = permissions.Grants(tenant.WithOrganization(context.Background(), 2), alice.ID, model.RoleUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if grants.Allows(model.ActionRead, nil) || !grants.Allows(model.ActionDelete, nil) {
+		t.Fatalf("grants in the second organization: %v", grants.Summary())
+	}
+
+	// Admins of the organization may do everything there
+	grants, err = permissions.Grants(tenant.WithOrganization(context.Background(), 2), alice.ID, model.RoleAdmin)
+	if err != nil || !grants.Admin() {
+		t.Fatalf("organization admin grants %v, %v", grants.Summary(), err)
+	}
+
+	if _, err := permissions.Grants(context.Background(), alice.ID, model.RoleUser); !errors.Is(err, tenant.ErrNoOrganization) {
+		t.Fatalf("grants without an organization: %v", err)
+	}
+	if _, err := permissions.Grants(tenant.WithOrganization(context.Background(), 1), 99, model.RoleUser); !errors.Is(err, service.ErrNotFound) {
+		t.Fatalf("grants of an unknown user: %v", err)
+	}
+}
@@ -0,0 +1,242 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"app/access"
+	"app/model"
+	"app/repository"
+)
+
+var (
+	ErrGroupNotFound      = errors.New("resource group not found")
+	ErrSerializedQuantity = errors.New("quantity of a serialized resource is derived from its items")
+)
+
+// NewResource is a resource to create
+type NewResource struct {
+	Name        string
+	Description string
+	Unit        string
+	Quantity    int
+	Serialized  bool
+	UnitCost    *float64 // Cost per unit of the initial quantity
+	Price       *float64
+	Currency    string // Currency of price and unit cost
+	GroupID     *uint  // Resource group, nil for none
+}
+
+// ResourceChanges are the fields of a resource to update, nil for unchanged
+type ResourceChanges struct {
+	Name        *string
+	Description *string
+	Unit        *string
+	Quantity    *int
+	Serialized  *bool
+	UnitCost    *float64 // Cost per unit when the quantity increases
+	Price       *float64
+	Currency    *string // Currency of price and unit cost
+	GroupID     *uint   // New resource group, 0 for none (admin)
+}
+
+// ResourceService manages resources and logs every change to their history
+type ResourceService struct {
+	store repository.Store
+}
+
+// NewResourceService returns a resource service on the store
+func NewResourceService(store repository.Store) *ResourceService {
+	return &ResourceService{store: store}
+}
+
+// List returns the resources the grants allow to read
+func (s *ResourceService) List(ctx context.Context, grants access.Grants) ([]model.Resource, error) {
+	return s.store.Resources().List(ctx, grants, model.ActionRead)
+}
+
+// Get returns a resource. Resources the grants do not allow to read are
+// reported as not found so that their existence is not revealed.
+func (s *ResourceService) Get(ctx context.Context, grants access.Grants, id uint) (model.Resource, error) {
+	return readable(ctx, s.store, grants, id)
+}
+
+func readable(ctx context.Context, store repository.Store, grants access.Grants, id uint) (model.Resource, error) {
+	resource, err := store.Resources().Get(ctx, id)
+	if err != nil {
+		return resource, err
+	}
+	if !grants.Allows(model.ActionRead, resource.GroupID) {
+		return model.Resource{}, ErrNotFound
+	}
+	return resource, nil
+}
+
+// Create creates a resource with its CREATE history entry
+func (s *ResourceService) Create(ctx context.Context, grants access.Grants, by Actor, input NewResource) (model.Resource, error) {
+	// Quantity of serialized resources is derived from their items
+	if input.Serialized && input.Quantity != 0 {
+		return model.Resource{}, ErrSerializedQuantity
+	}
+	if !grants.Allows(model.ActionCreate, input.GroupID) {
+		return model.Resource{}, ErrPermissionDenied
+	}
+	if err := s.checkGroup(ctx, input.GroupID); err != nil {
+		return model.Resource{}, err
+	}
+
+	resource := model.Resource{
+		Name:        input.Name,
+		Description: input.Description,
+		Unit:        input.Unit,
+		Quantity:    input.Quantity,
+		Serialized:  input.Serialized,
+		Price:       input.Price,
+		Currency:    input.Currency,
+		GroupID:     input.GroupID,
+	}
+
+	err := s.store.Transaction(ctx, func(tx repository.Store) error {
+		if err := tx.Resources().Create(ctx, &resource); err != nil {
+			return err
+		}
+		history, err := NewHistory(resource.ID, "CREATE", by, nil, resource,
+			fmt.Sprintf("Resource '%s' created", resource.Name))
+		if err != nil {
+			return err
+		}
+		history.UnitCost = input.UnitCost
+		history.Currency = input.Currency
+		return tx.History().Create(ctx, &history)
+	})
+	return resource, err
+}
+
+// Update applies the changes to a resource with an UPDATE history entry.
+// Field changes need the update action, quantity changes adjust, and moving
+// the resource to another group is for admins only.
+func (s *ResourceService) Update(ctx context.Context, grants access.Grants, by Actor, id uint, input ResourceChanges) (model.Resource, error) {
+	resource, err := readable(ctx, s.store, grants, id)
+	if err != nil {
+		return resource, err
+	}
+
+	changesFields := input.Name != nil || input.Description != nil || input.Unit != nil ||
+		input.Serialized != nil || input.Price != nil || input.Currency != nil
+	if changesFields && !grants.Allows(model.ActionUpdate, resource.GroupID) {
+		return resource, ErrPermissionDenied
+	}
+	if input.Quantity != nil && *input.Quantity != resource.Quantity && !grants.Allows(model.ActionAdjust, resource.GroupID) {
+		return resource, ErrPermissionDenied
+	}
+
+	oldResource := resource
+
+	if input.GroupID != nil {
+		if !grants.Admin() {
+			return resource, ErrPermissionDenied
+		}
+		if *input.GroupID == 0 {
+			input.GroupID = nil
+		} else if err := s.checkGroup(ctx, input.GroupID); err != nil {
+			return resource, err
+		}
+		resource.GroupID = input.GroupID
+	}
+	if input.Name != nil {
+		resource.Name = *input.Name
+	}
+	if input.Description != nil {
+		resource.Description = *input.Description
+	}
+	if input.Unit != nil {
+		resource.Unit = *input.Unit
+	}
+	if input.Serialized != nil {
+		resource.Serialized = *input.Serialized
+	}
+	if input.Price != nil {
+		resource.Price = input.Price
+	}
+	if input.Currency != nil {
+		resource.Currency = *input.Currency
+	}
+	if input.Quantity != nil {
+		if resource.Serialized {
+			return oldResource, ErrSerializedQuantity
+		}
+		resource.Quantity = *input.Quantity
+	}
+
+	err = s.store.Transaction(ctx, func(tx repository.Store) error {
+		// Switching to serialized mode recounts the stock from the items
+		if resource.Serialized && !oldResource.Serialized {
+			count, err := tx.Resources().CountInStock(ctx, resource.ID)
+			if err != nil {
+				return fmt.Errorf("cannot count serialized items: %w", err)
+			}
+			resource.Quantity = count
+		}
+
+		history, err := NewHistory(resource.ID, "UPDATE", by, oldResource, resource,
+			fmt.Sprintf("Resource '%s' updated", resource.Name))
+		if err != nil {
+			return err
+		}
+		if resource.Quantity > oldResource.Quantity {
+			history.UnitCost = input.UnitCost
+			history.Currency = resource.Currency
+		}
+		if err := tx.History().Create(ctx, &history); err != nil {
+			return err
+		}
+		return tx.Resources().Save(ctx, &resource)
+	})
+	return resource, err
+}
+
+// Delete deletes a resource with a DELETE history entry
+func (s *ResourceService) Delete(ctx context.Context, grants access.Grants, by Actor, id uint) error {
+	resource, err := readable(ctx, s.store, grants, id)
+	if err != nil {
+		return err
+	}
+	if !grants.Allows(model.ActionDelete, resource.GroupID) {
+		return ErrPermissionDenied
+	}
+
+	return s.store.Transaction(ctx, func(tx repository.Store) error {
+		history, err := NewHistory(resource.ID, "DELETE", by, resource, nil,
+			fmt.Sprintf("Resource '%s' deleted", resource.Name))
+		if err != nil {
+			return err
+		}
+		if err := tx.History().Create(ctx, &history); err != nil {
+			return err
+		}
+		return tx.Resources().Delete(ctx, &resource)
+	})
+}
+
+// History returns the change history of a resource, newest first
+func (s *ResourceService) History(ctx context.Context, grants access.Grants, id uint) ([]model.ResourceHistory, error) {
+	if _, err := readable(ctx, s.store, grants, id); err != nil {
+		return nil, err
+	}
+	return s.store.History().ListByResource(ctx, id)
+}
+
+// checkGroup makes sure the group, if any, exists
+func (s *ResourceService) checkGroup(ctx context.Context, groupID *uint) error {
+	if groupID == nil {
+		return nil
+	}
+	if _, err := s.store.Resources().GetGroup(ctx, *groupID); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return ErrGroupNotFound
+		}
+		return err
+	}
+	return nil
+}
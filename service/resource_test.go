@@ -0,0 +1,107 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"app/access"
+	"app/model"
+	"app/repository"
+	"app/service"
+	"app/tenant"
+)
+
+// resourceFixture is a resource service on a memory store with a group in
+// each of two organizations and a user who may read, create and adjust the
+// resources of the first group
+type resourceFixture struct {
+	resources     *service.ResourceService
+	permissions   *service.PermissionService
+	ctx, otherCtx context.Context // Of the organization of the first group and of the second
+	user          service.Actor
+	group, other  model.ResourceGroup
+}
+
+func newResourceFixture(t *testing.T) resourceFixture {
+	t.Helper()
+	store := repository.NewMemory()
+	f := resourceFixture{
+		resources:   service.NewResourceService(store),
+		permissions: service.NewPermissionService(store),
+		ctx:         tenant.WithOrganization(context.Background(), 1),
+		otherCtx:    tenant.WithOrganization(context.Background(), 2),
+		group:       model.ResourceGroup{ID: 10, OrganizationID: 1, Name: "Канцелярия"},
+		other:       model.ResourceGroup{ID: 20, OrganizationID: 2, Name: "Канцелярия"},
+	}
+	store.AddGroups(f.group, f.other)
+
+	alice := model.User{Username: "alice", Role: model.RoleUser}
+	if err := store.Users().Create(context.Background(), &alice); err != nil {
+		t.Fatal(err)
+	}
+	f.user = service.Actor{UserID: alice.ID}
+	for _, action := range []string{model.ActionRead, model.ActionCreate, model.ActionAdjust} {
+		store.AddGrants(model.PermissionGrant{OrganizationID: 1, Role: model.RoleUser, Action: action, GroupID: &f.group.ID})
+	}
+	return f
+}
+
+// grants are those of the user with a role in the first organization
+func (f resourceFixture) grants(t *testing.T, role string) access.Grants {
+	t.Helper()
+	grants, err := f.permissions.Grants(f.ctx, f.user.UserID, role)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return grants
+}
+
+func TestResourceServiceGrants(t *testing.T) {
+	f := newResourceFixture(t)
+	grants := f.grants(t, model.RoleUser)
+
+	// Resources are created in the groups the user may create in, of their
+	// own organization
+	paper, err := f.resources.Create(f.ctx, grants, f.user, service.NewResource{Name: "Бумага", Unit: "пачка", Quantity: 10, GroupID: &f.group.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if paper.OrganizationID != 1 {
+		t.Fatalf("resource created in organization %d, want 1", paper.OrganizationID)
+	}
+	if _, err := f.resources.Create(f.ctx, grants, f.user, service.NewResource{Name: "Ручки", Unit: "шт"}); !errors.Is(err, service.ErrPermissionDenied) {
+		t.Fatalf("create without a group: %v", err)
+	}
+	admin := f.grants(t, model.RoleAdmin)
+	if _, err := f.resources.Create(f.ctx, admin, f.user, service.NewResource{Name: "Ручки", Unit: "шт", GroupID: &f.other.ID}); !errors.Is(err, service.ErrGroupNotFound) {
+		t.Fatalf("create in a group of another organization: %v", err)
+	}
+
+	// Quantities may be adjusted but not the other fields
+	quantity, name := 8, "Бумага A4"
+	if _, err := f.resources.Update(f.ctx, grants, f.user, paper.ID, service.ResourceChanges{Quantity: &quantity}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.resources.Update(f.ctx, grants, f.user, paper.ID, service.ResourceChanges{Name: &name}); !errors.Is(err, service.ErrPermissionDenied) {
+		t.Fatalf("update without the grant: %v", err)
+	}
+	history, err := f.resources.History(f.ctx, grants, paper.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].Action != "UPDATE" || history[0].OrganizationID != 1 {
+		t.Fatalf("history %+v", history)
+	}
+
+	// Other organizations see neither the resource nor its history
+	if _, err := f.resources.Get(f.otherCtx, grants, paper.ID); !errors.Is(err, service.ErrNotFound) {
+		t.Fatalf("resource of another organization: %v", err)
+	}
+	if _, err := f.resources.History(f.otherCtx, grants, paper.ID); !errors.Is(err, service.ErrNotFound) {
+		t.Fatalf("history of another organization: %v", err)
+	}
+	if _, err := f.resources.List(context.Background(), grants); !errors.Is(err, tenant.ErrNoOrganization) {
+		t.Fatalf("list without an organization: %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+// Package service holds the business rules of resources and users on top of
+// the repositories: permission checks, transactions and history logging. The
+// handlers only translate HTTP requests into service calls.
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"app/model"
+	"app/repository"
+)
+
+var (
+	ErrNotFound         = repository.ErrNotFound
+	ErrPermissionDenied = errors.New("permission denied")
+)
+
+// Services are the services the handlers are built with
+type Services struct {
+	Resources   *ResourceService
+	Users       *UserService
+	Permissions *PermissionService
+}
+
+// New builds the services on a store
+func New(store repository.Store) *Services {
+	return &Services{
+		Resources:   NewResourceService(store),
+		Users:       NewUserService(store),
+		Permissions: NewPermissionService(store),
+	}
+}
+
+// Actor is who makes a change: a user, possibly through one of their API keys
+type Actor struct {
+	UserID   uint
+	APIKeyID *uint
+}
+
+// NewHistory prepares a history entry so callers can fill extra references
+// before saving it
+func NewHistory(resourceID uint, action string, by Actor, oldData, newData interface{}, description string) (model.ResourceHistory, error) {
+	history := model.ResourceHistory{
+		ResourceID:  resourceID,
+		Action:      action,
+		UserID:      by.UserID,
+		APIKeyID:    by.APIKeyID,
+		Timestamp:   time.Now(),
+		Description: description,
+	}
+
+	if oldData != nil {
+		oldJSON, err := json.Marshal(oldData)
+		if err != nil {
+			return history, err
+		}
+		history.OldData = string(oldJSON)
+	}
+
+	if newData != nil {
+		newJSON, err := json.Marshal(newData)
+		if err != nil {
+			return history, err
+		}
+		history.NewData = string(newJSON)
+	}
+
+	return history, nil
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"app/model"
+	"app/repository"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// UserService reads and deletes users
+type UserService struct {
+	store repository.Store
+}
+
+// NewUserService returns a user service on the store
+func NewUserService(store repository.Store) *UserService {
+	return &UserService{store: store}
+}
+
+// List returns the public fields of every user
+func (s *UserService) List(ctx context.Context) ([]model.PublicUser, error) {
+	users, err := s.store.Users().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	public := make([]model.PublicUser, 0, len(users))
+	for _, user := range users {
+		public = append(public, user.Public())
+	}
+	return public, nil
+}
+
+// Get returns the public fields of a user
+func (s *UserService) Get(ctx context.Context, id uint) (model.PublicUser, error) {
+	user, err := s.store.Users().Get(ctx, id)
+	if err != nil {
+		return model.PublicUser{}, err
+	}
+	return user.Public(), nil
+}
+
+// Delete deletes a user who confirmed it with their password and returns them
+func (s *UserService) Delete(ctx context.Context, id uint, password string) (model.User, error) {
+	user, err := s.store.Users().Get(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		return user, ErrInvalidCredentials
+	}
+	if err != nil {
+		return user, err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+		return user, ErrInvalidCredentials
+	}
+	return user, s.store.Users().Delete(ctx, &user)
+}
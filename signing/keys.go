@@ -0,0 +1,162 @@
+// Package signing signs and verifies session tokens with asymmetric keys kept
+// in the database. Keys are rotated on a schedule; a rotated key keeps
+// verifying for an overlap window so that tokens it signed stay valid.
+package signing
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+
+	"app/config"
+	"app/model"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// Supported algorithms
+const (
+	RS256 = "RS256"
+	EdDSA = "EdDSA"
+)
+
+// TokenTTL is the lifetime of session tokens
+const TokenTTL = 72 * time.Hour
+
+// Algorithm is the algorithm of new keys (JWT_ALGORITHM, RS256 by default)
+func Algorithm() string {
+	return config.Get().JWTAlgorithm
+}
+
+// RotationPeriod is how long a key signs before it is replaced
+// (JWT_KEY_ROTATION_DAYS, 30 by default)
+func RotationPeriod() time.Duration {
+	return time.Duration(config.Get().JWTKeyRotationDays) * 24 * time.Hour
+}
+
+// Overlap is how long a rotated key keeps verifying (JWT_KEY_OVERLAP_HOURS,
+// by default the token lifetime so no issued token is cut short)
+func Overlap() time.Duration {
+	return time.Duration(config.Get().JWTKeyOverlapHours) * time.Hour
+}
+
+// GenerateKey creates a key pair for the algorithm
+func GenerateKey(algorithm string) (model.SigningKey, error) {
+	var (
+		private crypto.Signer
+		err     error
+	)
+	switch algorithm {
+	case RS256:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case EdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		err = fmt.Errorf("unsupported algorithm %q", algorithm)
+	}
+	if err != nil {
+		return model.SigningKey{}, err
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return model.SigningKey{}, err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(private.Public())
+	if err != nil {
+		return model.SigningKey{}, err
+	}
+	kid := make([]byte, 8)
+	if _, err := rand.Read(kid); err != nil {
+		return model.SigningKey{}, err
+	}
+
+	return model.SigningKey{
+		Kid:        hex.EncodeToString(kid),
+		Algorithm:  algorithm,
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER})),
+		PublicKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})),
+	}, nil
+}
+
+// Rotate creates a new signing key and schedules the retirement of the keys
+// it replaces after the overlap window
+func Rotate(db *gorm.DB) (model.SigningKey, error) {
+	overlap := Overlap()
+	key, err := GenerateKey(Algorithm())
+	if err != nil {
+		return model.SigningKey{}, err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Model(&model.SigningKey{}).Where("rotated_at IS NULL").
+			Updates(map[string]interface{}{"rotated_at": now, "retires_at": now.Add(overlap)}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&key).Error
+	})
+	if err == nil {
+		keyring.invalidate()
+	}
+	return key, err
+}
+
+// RotateIfDue rotates when there is no signing key or the current one is
+// older than the rotation period; it reports whether it rotated
+func RotateIfDue(db *gorm.DB) (bool, error) {
+	var current model.SigningKey
+	err := db.Where("rotated_at IS NULL").Order("created_at desc").First(&current).Error
+	if err == nil && time.Since(current.CreatedAt) < RotationPeriod() {
+		return false, nil
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, err
+	}
+	_, err = Rotate(db)
+	return err == nil, err
+}
+
+// parsedKey is a stored key ready for signing and verification
+type parsedKey struct {
+	model.SigningKey
+	private crypto.Signer
+	public  crypto.PublicKey
+	method  jwt.SigningMethod
+}
+
+func parseKey(k model.SigningKey) (parsedKey, error) {
+	parsed := parsedKey{SigningKey: k}
+	switch k.Algorithm {
+	case RS256:
+		parsed.method = jwt.SigningMethodRS256
+	case EdDSA:
+		parsed.method = jwt.SigningMethodEdDSA
+	default:
+		return parsed, fmt.Errorf("key %s has unsupported algorithm %q", k.Kid, k.Algorithm)
+	}
+
+	block, _ := pem.Decode([]byte(k.PrivateKey))
+	if block == nil {
+		return parsed, fmt.Errorf("key %s has no private key PEM", k.Kid)
+	}
+	private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return parsed, err
+	}
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return parsed, fmt.Errorf("key %s cannot sign", k.Kid)
+	}
+	parsed.private = signer
+	parsed.public = signer.Public()
+	return parsed, nil
+}
@@ -0,0 +1,239 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"app/model"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+const (
+	refreshInterval = time.Minute      // Keys are reloaded at least this often
+	missRefresh     = 10 * time.Second // Minimum pause between reloads caused by unknown kids
+)
+
+var (
+	ErrNoSigningKey = errors.New("no signing key available")
+	errUnknownKey   = errors.New("unknown or retired signing key")
+)
+
+// ring caches the keys of the database so that every prefork process sees
+// rotations made by the parent
+type ring struct {
+	mu       sync.RWMutex
+	db       *gorm.DB
+	keys     map[string]parsedKey
+	active   *parsedKey
+	loadedAt time.Time
+}
+
+var keyring = &ring{}
+
+// Init loads the keys; call it once the database is connected
+func Init(db *gorm.DB) error {
+	keyring.mu.Lock()
+	keyring.db = db
+	keyring.mu.Unlock()
+	return keyring.load()
+}
+
+func (r *ring) load() error {
+	r.mu.RLock()
+	db := r.db
+	r.mu.RUnlock()
+	if db == nil {
+		return ErrNoSigningKey
+	}
+
+	var stored []model.SigningKey
+	if err := db.Where("retires_at IS NULL OR retires_at > ?", time.Now()).
+		Order("created_at").Find(&stored).Error; err != nil {
+		return err
+	}
+
+	keys := make(map[string]parsedKey, len(stored))
+	var active *parsedKey
+	for _, k := range stored {
+		parsed, err := parseKey(k)
+		if err != nil {
+			log.Println("❌ Skipping signing key:", err)
+			continue
+		}
+		keys[k.Kid] = parsed
+		if k.RotatedAt == nil {
+			active = &parsed
+		}
+	}
+
+	r.mu.Lock()
+	r.keys, r.active, r.loadedAt = keys, active, time.Now()
+	r.mu.Unlock()
+	return nil
+}
+
+// invalidate makes the next use reload the keys
+func (r *ring) invalidate() {
+	r.mu.Lock()
+	r.loadedAt = time.Time{}
+	r.mu.Unlock()
+}
+
+// fresh reloads the keys when they are older than maxAge
+func (r *ring) fresh(maxAge time.Duration) {
+	r.mu.RLock()
+	stale := time.Since(r.loadedAt) > maxAge
+	r.mu.RUnlock()
+	if stale {
+		if err := r.load(); err != nil {
+			log.Println("❌ Cannot reload signing keys:", err)
+		}
+	}
+}
+
+// Sign signs claims with the current key, adding its kid to the header
+func Sign(claims jwt.Claims) (string, error) {
+	keyring.fresh(refreshInterval)
+
+	keyring.mu.RLock()
+	active := keyring.active
+	keyring.mu.RUnlock()
+	if active == nil {
+		return "", ErrNoSigningKey
+	}
+
+	token := jwt.NewWithClaims(active.method, claims)
+	token.Header["kid"] = active.Kid
+	return token.SignedString(active.private)
+}
+
+// Keyfunc returns the public key a token names in its header. Tokens with an
+// unknown kid trigger a reload in case the key was created by another process.
+func Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	keyring.fresh(refreshInterval)
+
+	key, ok := lookup(kid)
+	if !ok {
+		keyring.fresh(missRefresh)
+		key, ok = lookup(kid)
+	}
+	if !ok || key.Retired(time.Now()) {
+		return nil, errUnknownKey
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+	return key.public, nil
+}
+
+func lookup(kid string) (parsedKey, bool) {
+	keyring.mu.RLock()
+	defer keyring.mu.RUnlock()
+	key, ok := keyring.keys[kid]
+	return key, ok
+}
+
+// ----------  JWKS -----------------------------------------------------
+
+// JWK is a public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`   // RSA modulus
+	E   string `json:"e,omitempty"`   // RSA exponent
+	Crv string `json:"crv,omitempty"` // OKP curve
+	X   string `json:"x,omitempty"`   // OKP public key
+}
+
+// JWKSet is the document served at /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicKeys returns every key that still verifies tokens, newest first
+func PublicKeys() JWKSet {
+	keyring.fresh(refreshInterval)
+	keyring.mu.RLock()
+	defer keyring.mu.RUnlock()
+
+	set := JWKSet{Keys: []JWK{}}
+	now := time.Now()
+	for _, k := range keyring.keys {
+		if k.Retired(now) {
+			continue
+		}
+		jwk := JWK{Use: "sig", Alg: k.Algorithm, Kid: k.Kid}
+		switch public := k.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool {
+		return keyring.keys[set.Keys[i].Kid].CreatedAt.After(keyring.keys[set.Keys[j].Kid].CreatedAt)
+	})
+	return set
+}
+
+// ----------  ROTATION -------------------------------------------------
+
+// Rotator replaces the signing key when it is due
+type Rotator struct {
+	db   *gorm.DB
+	stop chan struct{}
+	done sync.WaitGroup
+}
+
+// NewRotator creates a rotator; run it in a single process only
+func NewRotator(db *gorm.DB) *Rotator {
+	return &Rotator{db: db, stop: make(chan struct{})}
+}
+
+// Start checks hourly whether the key is due for rotation
+func (r *Rotator) Start() {
+	r.done.Add(1)
+	go func() {
+		defer r.done.Done()
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+				if rotated, err := RotateIfDue(r.db); err != nil {
+					log.Println("❌ Signing key rotation failed:", err)
+				} else if rotated {
+					log.Println("✅ Signing key rotated")
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops the rotation checks
+func (r *Rotator) Stop() {
+	close(r.stop)
+	r.done.Wait()
+}
@@ -0,0 +1,228 @@
+// Package sso logs users in through an external OpenID Connect identity
+// provider using the authorization code flow with PKCE.
+package sso
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"app/config"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+var (
+	ErrNotConfigured = errors.New("OpenID Connect is not configured")
+	ErrNoIDToken     = errors.New("token response has no id_token")
+	ErrNonceMismatch = errors.New("id_token nonce does not match")
+)
+
+// Settings configure the identity provider
+type Settings struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string // Empty for public clients, which rely on PKCE alone
+	RedirectURL  string
+	Scopes       []string
+	GroupsClaim  string            // Claim listing the groups of the user
+	RoleMapping  map[string]string // IdP group → application role
+	DefaultRole  string            // Role of users in no mapped group; empty denies them
+}
+
+// LoadSettings reads OIDC_ISSUER, OIDC_CLIENT_ID, OIDC_CLIENT_SECRET,
+// OIDC_REDIRECT_URL, OIDC_SCOPES (default "openid email profile"),
+// OIDC_GROUPS_CLAIM (default "groups"), OIDC_ROLE_MAPPING as
+// "group=role,group=role" and OIDC_DEFAULT_ROLE (default "user", "none" denies).
+// It returns ErrNotConfigured when no issuer is set.
+func LoadSettings() (Settings, error) {
+	cfg := config.Get()
+	s := Settings{
+		Issuer:       cfg.OIDCIssuer,
+		ClientID:     cfg.OIDCClientID,
+		ClientSecret: cfg.OIDCClientSecret,
+		RedirectURL:  cfg.OIDCRedirectURL,
+		Scopes:       strings.Fields(cfg.OIDCScopes),
+		GroupsClaim:  cfg.OIDCGroupsClaim,
+		RoleMapping:  map[string]string{},
+		DefaultRole:  cfg.OIDCDefaultRole,
+	}
+	if s.Issuer == "" {
+		return s, ErrNotConfigured
+	}
+	if s.ClientID == "" || s.RedirectURL == "" {
+		return s, errors.New("OIDC_CLIENT_ID and OIDC_REDIRECT_URL are required with OIDC_ISSUER")
+	}
+	if len(s.Scopes) == 0 {
+		s.Scopes = []string{oidc.ScopeOpenID, "email", "profile"}
+	}
+	if s.GroupsClaim == "" {
+		s.GroupsClaim = "groups"
+	}
+	switch s.DefaultRole {
+	case "":
+		s.DefaultRole = "user"
+	case "none":
+		s.DefaultRole = ""
+	}
+
+	for _, pair := range strings.Split(cfg.OIDCRoleMapping, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		group, role, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(group) == "" || strings.TrimSpace(role) == "" {
+			return s, fmt.Errorf("invalid OIDC_ROLE_MAPPING entry %q, expected group=role", pair)
+		}
+		s.RoleMapping[strings.TrimSpace(group)] = strings.TrimSpace(role)
+	}
+	return s, nil
+}
+
+// Provider talks to the identity provider
+type Provider struct {
+	settings Settings
+	oauth    oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// NewProvider discovers the provider endpoints from the issuer
+func NewProvider(ctx context.Context, s Settings) (*Provider, error) {
+	provider, err := oidc.NewProvider(ctx, s.Issuer)
+	if err != nil {
+		return nil, err
+	}
+	return &Provider{
+		settings: s,
+		oauth: oauth2.Config{
+			ClientID:     s.ClientID,
+			ClientSecret: s.ClientSecret,
+			RedirectURL:  s.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       s.Scopes,
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: s.ClientID}),
+	}, nil
+}
+
+var (
+	defaultMu       sync.Mutex
+	defaultProvider *Provider
+)
+
+// Default returns the provider configured by the environment. Discovery is
+// retried on every call until it succeeds so that an unreachable provider at
+// boot does not require a restart.
+func Default(ctx context.Context) (*Provider, error) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	if defaultProvider != nil {
+		return defaultProvider, nil
+	}
+
+	settings, err := LoadSettings()
+	if err != nil {
+		return nil, err
+	}
+	provider, err := NewProvider(ctx, settings)
+	if err != nil {
+		return nil, err
+	}
+	defaultProvider = provider
+	return provider, nil
+}
+
+// Identity is what the ID token tells about the user
+type Identity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Username      string
+	Name          string
+	Groups        []string
+}
+
+// AuthCodeURL is where the user is sent to log in. The verifier is the PKCE
+// code verifier, kept by the caller until the callback.
+func (p *Provider) AuthCodeURL(state, nonce, verifier string) string {
+	return p.oauth.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+}
+
+// Exchange redeems the authorization code and verifies the returned ID token
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (Identity, error) {
+	token, err := p.oauth.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return Identity{}, err
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return Identity{}, ErrNoIDToken
+	}
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return Identity{}, err
+	}
+	if idToken.Nonce != nonce {
+		return Identity{}, ErrNonceMismatch
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return Identity{}, err
+	}
+	identity := Identity{
+		Issuer:   idToken.Issuer,
+		Subject:  idToken.Subject,
+		Email:    stringClaim(claims, "email"),
+		Username: stringClaim(claims, "preferred_username"),
+		Name:     stringClaim(claims, "name"),
+		Groups:   stringsClaim(claims, p.settings.GroupsClaim),
+	}
+	identity.EmailVerified, _ = claims["email_verified"].(bool)
+	return identity, nil
+}
+
+// Role maps the groups of an identity to an application role. The first
+// mapped group wins, admin taking precedence; ok is false when the user may
+// not log in.
+func (p *Provider) Role(identity Identity) (role string, ok bool) {
+	for _, group := range identity.Groups {
+		mapped, found := p.settings.RoleMapping[group]
+		if !found {
+			continue
+		}
+		if role == "" || mapped == "admin" {
+			role = mapped
+		}
+	}
+	if role == "" {
+		role = p.settings.DefaultRole
+	}
+	return role, role != ""
+}
+
+func stringClaim(claims map[string]interface{}, name string) string {
+	s, _ := claims[name].(string)
+	return s
+}
+
+// stringsClaim reads a claim holding a list of strings or a single string
+func stringsClaim(claims map[string]interface{}, name string) []string {
+	switch v := claims[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package sso
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+// mockProvider is a minimal OpenID Connect provider: discovery, keys and a
+// token endpoint that checks the PKCE verifier of one pending code
+type mockProvider struct {
+	t         *testing.T
+	server    *httptest.Server
+	key       *rsa.PrivateKey // Published key
+	signer    *rsa.PrivateKey // Key that signs ID tokens
+	code      string
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockProvider{t: t, key: key, signer: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                m.server.URL,
+			"authorization_endpoint":                m.server.URL + "/authorize",
+			"token_endpoint":                        m.server.URL + "/token",
+			"jwks_uri":                              m.server.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": "test",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+		if r.Form.Get("code") != m.code || base64.RawURLEncoding.EncodeToString(sum[:]) != m.challenge {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, m.claims)
+		token.Header["kid"] = "test"
+		idToken, err := token.SignedString(m.signer)
+		if err != nil {
+			t.Error(err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     idToken,
+		})
+	})
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+// authorize plays the user logging in: it records the PKCE challenge of the
+// authorization URL and returns a code
+func (m *mockProvider) authorize(authURL string) (state, code string) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" {
+		m.t.Fatalf("code_challenge_method = %q, want S256", q.Get("code_challenge_method"))
+	}
+	m.challenge = q.Get("code_challenge")
+	m.code = "code-123"
+	m.claims = jwt.MapClaims{
+		"iss":                m.server.URL,
+		"aud":                "inventory",
+		"sub":                "alice-id",
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"iat":                time.Now().Unix(),
+		"nonce":              q.Get("nonce"),
+		"email":              "alice@example.com",
+		"email_verified":     true,
+		"preferred_username": "alice",
+		"name":               "Alice",
+		"groups":             []string{"staff", "inventory-admins"},
+	}
+	return q.Get("state"), m.code
+}
+
+func newTestProvider(t *testing.T, m *mockProvider) *Provider {
+	p, err := NewProvider(context.Background(), Settings{
+		Issuer:      m.server.URL,
+		ClientID:    "inventory",
+		RedirectURL: "http://localhost:3000/api/auth/oidc/callback",
+		Scopes:      []string{"openid", "email", "profile"},
+		GroupsClaim: "groups",
+		RoleMapping: map[string]string{"inventory-admins": "admin", "staff": "user"},
+		DefaultRole: "",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestExchange(t *testing.T) {
+	m := newMockProvider(t)
+	p := newTestProvider(t, m)
+
+	verifier := oauth2.GenerateVerifier()
+	state, code := m.authorize(p.AuthCodeURL("state-1", "nonce-1", verifier))
+	if state != "state-1" {
+		t.Fatalf("state = %q", state)
+	}
+
+	identity, err := p.Exchange(context.Background(), code, verifier, "nonce-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Issuer != m.server.URL || identity.Subject != "alice-id" || identity.Email != "alice@example.com" ||
+		!identity.EmailVerified || identity.Username != "alice" || len(identity.Groups) != 2 {
+		t.Fatalf("unexpected identity %+v", identity)
+	}
+	if role, ok := p.Role(identity); !ok || role != "admin" {
+		t.Fatalf("Role() = %q, %v, want admin", role, ok)
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	m := newMockProvider(t)
+	p := newTestProvider(t, m)
+
+	_, code := m.authorize(p.AuthCodeURL("state", "nonce", oauth2.GenerateVerifier()))
+	if _, err := p.Exchange(context.Background(), code, oauth2.GenerateVerifier(), "nonce"); err == nil {
+		t.Fatal("exchange with another verifier succeeded")
+	}
+}
+
+func TestExchangeRejectsWrongNonce(t *testing.T) {
+	m := newMockProvider(t)
+	p := newTestProvider(t, m)
+
+	verifier := oauth2.GenerateVerifier()
+	_, code := m.authorize(p.AuthCodeURL("state", "nonce", verifier))
+	if _, err := p.Exchange(context.Background(), code, verifier, "other"); err != ErrNonceMismatch {
+		t.Fatalf("err = %v, want ErrNonceMismatch", err)
+	}
+}
+
+func TestExchangeRejectsForeignKey(t *testing.T) {
+	m := newMockProvider(t)
+	p := newTestProvider(t, m)
+
+	verifier := oauth2.GenerateVerifier()
+	_, code := m.authorize(p.AuthCodeURL("state", "nonce", verifier))
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.signer = other
+	if _, err := p.Exchange(context.Background(), code, verifier, "nonce"); err == nil {
+		t.Fatal("token signed by an unpublished key was accepted")
+	}
+}
+
+func TestRole(t *testing.T) {
+	p := &Provider{settings: Settings{RoleMapping: map[string]string{"ops": "user", "root": "admin"}}}
+	cases := []struct {
+		groups []string
+		role   string
+		ok     bool
+	}{
+		{[]string{"ops"}, "user", true},
+		{[]string{"root", "ops"}, "admin", true},
+		{[]string{"ops", "root"}, "admin", true},
+		{[]string{"guests"}, "", false},
+		{nil, "", false},
+	}
+	for _, c := range cases {
+		role, ok := p.Role(Identity{Groups: c.groups})
+		if role != c.role || ok != c.ok {
+			t.Errorf("Role(%v) = %q, %v, want %q, %v", c.groups, role, ok, c.role, c.ok)
+		}
+	}
+
+	p.settings.DefaultRole = "user"
+	if role, ok := p.Role(Identity{Groups: []string{"guests"}}); role != "user" || !ok {
+		t.Errorf("Role with default = %q, %v, want user", role, ok)
+	}
+}
@@ -0,0 +1,54 @@
+package tenant
+
+import (
+	"errors"
+
+	"app/model"
+
+	"gorm.io/gorm"
+)
+
+var ErrNotMember = errors.New("tenant: not a member of the organization")
+
+// Member is a user acting in an organization with a role there
+type Member struct {
+	OrganizationID uint   `json:"organization_id"`
+	Role           string `json:"role"`
+}
+
+// Resolve returns the organization a user acts in and their role there.
+// A zero organizationID selects the user's default organization, the one they
+// joined first. Admins act as admins in every organization, members or not.
+func Resolve(db *gorm.DB, user model.User, organizationID uint) (Member, error) {
+	var membership model.Membership
+	query := db.Where("user_id = ?", user.ID)
+	if organizationID != 0 {
+		query = query.Where("organization_id = ?", organizationID)
+	}
+	if err := query.Order("id").Limit(1).Find(&membership).Error; err != nil {
+		return Member{}, err
+	}
+
+	if user.Role == model.RoleAdmin {
+		if membership.ID != 0 {
+			return Member{OrganizationID: membership.OrganizationID, Role: model.RoleAdmin}, nil
+		}
+		var organization model.Organization
+		query := db.Order("id").Limit(1)
+		if organizationID != 0 {
+			query = query.Where("id = ?", organizationID)
+		}
+		if err := query.Find(&organization).Error; err != nil {
+			return Member{}, err
+		}
+		if organization.ID == 0 {
+			return Member{}, ErrNotMember
+		}
+		return Member{OrganizationID: organization.ID, Role: model.RoleAdmin}, nil
+	}
+
+	if membership.ID == 0 {
+		return Member{}, ErrNotMember
+	}
+	return Member{OrganizationID: membership.OrganizationID, Role: membership.Role}, nil
+}
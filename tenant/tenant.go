@@ -0,0 +1,151 @@
+// Package tenant isolates the data of organizations sharing one deployment.
+// Queries on tenant-owned tables are limited to the organization carried by
+// their context, so a handler that forgets a filter still cannot reach the
+// data of another organization: without an organization the query fails.
+package tenant
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Column holds the owning organization in every tenant-owned table
+const Column = "organization_id"
+
+var (
+	ErrNoOrganization    = errors.New("tenant: query on tenant data without an organization")
+	ErrOtherOrganization = errors.New("tenant: row belongs to another organization")
+)
+
+type contextKey struct{}
+
+// scope is the organization a context acts in, or every organization for
+// background jobs
+type scope struct {
+	organizationID uint
+	all            bool
+}
+
+// WithOrganization returns a context whose queries see only the data of the
+// organization
+func WithOrganization(ctx context.Context, organizationID uint) context.Context {
+	return context.WithValue(ctx, contextKey{}, scope{organizationID: organizationID})
+}
+
+// AllOrganizations returns a context whose queries see the data of every
+// organization, for background jobs and lookups by secret token. Rows created
+// with it must set their organization.
+func AllOrganizations(ctx context.Context) context.Context {
+	return context.WithValue(ctx, contextKey{}, scope{all: true})
+}
+
+// Organization returns the organization of a context, if it has exactly one
+func Organization(ctx context.Context) (uint, bool) {
+	s, _ := ctx.Value(contextKey{}).(scope)
+	return s.organizationID, s.organizationID != 0
+}
+
+// Scope returns the organization the queries of a context are limited to,
+// zero for AllOrganizations, and ErrNoOrganization for a context naming
+// neither, as the callbacks do
+func Scope(ctx context.Context) (uint, error) {
+	s, _ := ctx.Value(contextKey{}).(scope)
+	if !s.all && s.organizationID == 0 {
+		return 0, ErrNoOrganization
+	}
+	return s.organizationID, nil
+}
+
+// RegisterCallbacks scopes every query, update and delete on the tables of the
+// models and stamps the organization on the rows created in them. Raw SQL is
+// not scoped.
+func RegisterCallbacks(db *gorm.DB, models ...interface{}) error {
+	tables := map[string]bool{}
+	for _, m := range models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(m); err != nil {
+			return err
+		}
+		if stmt.Schema.LookUpField(Column) == nil {
+			return errors.New("tenant: " + stmt.Schema.Table + " has no " + Column + " column")
+		}
+		tables[stmt.Schema.Table] = true
+	}
+
+	filter := func(db *gorm.DB) { scopeStatement(db, tables) }
+	cb := db.Callback()
+	if err := cb.Query().Before("gorm:query").Register("tenant:query", filter); err != nil {
+		return err
+	}
+	if err := cb.Row().Before("gorm:row").Register("tenant:row", filter); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:update").Register("tenant:update", filter); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:delete").Register("tenant:delete", filter); err != nil {
+		return err
+	}
+	return cb.Create().Before("gorm:create").Register("tenant:create", func(db *gorm.DB) { stampCreate(db, tables) })
+}
+
+func statementScope(db *gorm.DB) scope {
+	s, _ := db.Statement.Context.Value(contextKey{}).(scope)
+	return s
+}
+
+func scopeStatement(db *gorm.DB, tables map[string]bool) {
+	if db.Error != nil || !tables[db.Statement.Table] {
+		return
+	}
+	s := statementScope(db)
+	switch {
+	case s.all:
+	case s.organizationID == 0:
+		db.AddError(ErrNoOrganization)
+	default:
+		db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+			clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: Column}, Value: s.organizationID},
+		}})
+	}
+}
+
+func stampCreate(db *gorm.DB, tables map[string]bool) {
+	if db.Error != nil || db.Statement.Schema == nil || !tables[db.Statement.Schema.Table] {
+		return
+	}
+	s := statementScope(db)
+	if s.all {
+		return
+	}
+	if s.organizationID == 0 {
+		db.AddError(ErrNoOrganization)
+		return
+	}
+
+	field := db.Statement.Schema.LookUpField(Column)
+	stamp := func(row reflect.Value) {
+		value, zero := field.ValueOf(db.Statement.Context, row)
+		if !zero && value != s.organizationID {
+			db.AddError(ErrOtherOrganization)
+			return
+		}
+		if err := field.Set(db.Statement.Context, row, s.organizationID); err != nil {
+			db.AddError(err)
+		}
+	}
+
+	rv := db.Statement.ReflectValue
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			stamp(reflect.Indirect(rv.Index(i)))
+		}
+	case reflect.Struct:
+		stamp(rv)
+	}
+}
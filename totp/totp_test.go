@@ -0,0 +1,73 @@
+package totp_test
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+
+	"app/totp"
+)
+
+// rfcSecret is the SHA1 secret of RFC 6238 Appendix B, base32 encoded
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+// The vectors of RFC 6238 Appendix B for SHA1, truncated to six digits: the
+// codes are the same value modulo 10^6
+var vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},          // 94287082
+	{1111111109, "081804"},  // 07081804
+	{1111111111, "050471"},  // 14050471
+	{1234567890, "005924"},  // 89005924
+	{2000000000, "279037"},  // 69279037
+	{20000000000, "353130"}, // 65353130
+}
+
+func TestCode(t *testing.T) {
+	for _, v := range vectors {
+		code, err := totp.Code(rfcSecret, time.Unix(v.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != v.code {
+			t.Errorf("code at %d is %s, want %s", v.unix, code, v.code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	at := time.Unix(1111111111, 0)
+	step, ok := totp.Validate(rfcSecret, "050 471", at)
+	if !ok || step != totp.Step(at) {
+		t.Fatalf("current code: step %d, %t", step, ok)
+	}
+
+	// One period of clock skew is accepted either way, no more
+	for _, offset := range []int64{-30, 30} {
+		code, err := totp.Code(rfcSecret, at.Add(time.Duration(offset)*time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := totp.Validate(rfcSecret, code, at); !ok {
+			t.Errorf("code %d seconds away refused", offset)
+		}
+	}
+	code, err := totp.Code(rfcSecret, at.Add(-90*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := totp.Validate(rfcSecret, code, at); ok {
+		t.Error("code three periods old accepted")
+	}
+
+	for _, input := range []string{"", "05047", "0504711", "abcdef"} {
+		if _, ok := totp.Validate(rfcSecret, input, at); ok {
+			t.Errorf("input %q accepted", input)
+		}
+	}
+	if _, ok := totp.Validate("not base32!", "050471", at); ok {
+		t.Error("invalid secret accepted")
+	}
+}